@@ -0,0 +1,11 @@
+// Package assets holds the default shell, component library, schema and media
+// compiled into the binary, so the service runs without an assets directory.
+// Paths are relative to this directory, e.g. shell/template_shell.docx.
+package assets
+
+import "embed"
+
+// FS holds the shell, components, schemas and media directories
+//
+//go:embed shell components schemas media
+var FS embed.FS
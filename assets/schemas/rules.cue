@@ -1,18 +1,43 @@
 package docgen
 
-// 1. Centralized list of all valid component names.
+// 1. Centralized list of all valid component names. Component versions whose
+// props differ from the first are listed and given rules as <Name>@<N>, e.g.
+// "TestBlock@2"; versions not listed are validated as <Name>.
 #AllComponentNames:
 	"DocumentCategoryTitle" |
 	"DocumentTitle" |
 	"DocumentSubject" |
 	"TestBlock" |
-	"AuthorBlock"
+	"AuthorBlock" |
+	"ImageBlock" |
+	"MeasurementTable" |
+	"BulletList" |
+	"NumberedList" |
+	"Section" |
+	"PageBreak" |
+	"Heading" |
+	"TOC"
 
 // 2. Main document plan with compositional rules.
 #DocumentPlan: {
+	// Optional template to render with; defaults to the service's default template
+	template?: string & =~"^[A-Za-z0-9_-]+$"
 	// Optional document properties
 	doc_props?: {
-		filename?: string
+		filename?:    string
+		title?:       string
+		subject?:     string
+		creator?:     string
+		keywords?:    string
+		description?: string
+		category?:    string
+		revision?:    int & >=1
+		created?:     #Timestamp
+		modified?:    #Timestamp
+		header?:      #HeaderFooter
+		footer?:      #HeaderFooter
+		// Props written to the custom XML part content controls bind to
+		bound_props?: [...string & =~"^[A-Za-z_][\\w.-]*$"]
 		...
 	}
 	body: [...#ComponentInstance]
@@ -22,6 +47,10 @@ package docgen
 #ComponentInstance: {
 	component: #AllComponentNames
 	props:     {...}
+	// Optional shell insertion point (docgen:slot=<name>); defaults to "body"
+	slot?: string & =~"^[A-Za-z0-9_-]+$"
+	// Optional: lock the content controls the component fills against editing
+	lock_controls?: bool
 
 	// Specific prop validation using if statements
 	if component == "DocumentCategoryTitle" {
@@ -45,7 +74,7 @@ package docgen
 			test_date:       string & =~"^\\d{1,2}/\\d{1,2}/\\d{4}$"
 			serial_number:   string & !=""
 			test_result:     "PASS" | "FAIL" | "INCOMPLETE"
-			additional_info: string
+			additional_info: #RichText
 		}
 	}
 	if component == "AuthorBlock" {
@@ -60,4 +89,157 @@ package docgen
 			website:        string & !=""
 		}
 	}
-}
\ No newline at end of file
+	if component == "ImageBlock" {
+		props: {
+			image: #Image
+		}
+	}
+	if component == "MeasurementTable" {
+		props: {
+			rows: [#MeasurementRow, ...#MeasurementRow]
+		}
+	}
+	if component == "BulletList" || component == "NumberedList" {
+		props: {
+			items: [#ListItem, ...#ListItem]
+		}
+	}
+	if component == "Section" {
+		props: #Section
+	}
+	if component == "Heading" {
+		props: {
+			text:  #RichText & (string & !="" | [_, ...])
+			level: 1 | 2 | 3
+		}
+	}
+	if component == "TOC" {
+		props: {
+			title?: string & !=""
+		}
+	}
+}
+
+// 4. Reusable prop shapes.
+
+// Image prop: inline base64 data, or a path relative to the engine's media directory.
+#Image: #InlineImage | #MediaImage
+
+#InlineImage: {
+	filename:       string & =~"(?i)\\.(png|jpe?g|gif|bmp)$"
+	content_base64: string & !=""
+	alt_text?:      string
+	auto_size?:     bool
+}
+
+#MediaImage: {
+	path:       string & =~"(?i)\\.(png|jpe?g|gif|bmp)$"
+	filename?:  string & =~"(?i)\\.(png|jpe?g|gif|bmp)$"
+	alt_text?:  string
+	auto_size?: bool
+}
+
+// RFC 3339 timestamp or plain YYYY-MM-DD date for document properties
+#Timestamp: string & =~"^[0-9]{4}-[0-9]{2}-[0-9]{2}(T[0-9]{2}:[0-9]{2}:[0-9]{2}(\\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2}))?$"
+
+// A prop that is plain text or an array of rich-text spans
+#RichText: string | [...(string | #Span)]
+
+#Span: {
+	#NoteSpan
+	link?: string & =~"^(https?|mailto):"
+	// Footnote or endnote referenced after the span
+	footnote?: #NoteText
+	endnote?:  #NoteText
+}
+
+// The text of a footnote or endnote; notes cannot hold links or further notes
+#NoteText: string | [...(string | #NoteSpan)]
+
+#NoteSpan: {
+	text?:       string
+	bold?:       bool
+	italic?:     bool
+	underline?:  bool
+	vert_align?: "superscript" | "subscript"
+	style?:      string & !=""
+	break?:      bool
+}
+
+// One row of a MeasurementTable
+#MeasurementRow: {
+	parameter:    (string & !="") | [_, ...(string | #Span)]
+	expected:     #RichText
+	actual:       #RichText
+	result:       "PASS" | "FAIL" | "INCOMPLETE"
+	cell_styles?: {["parameter" | "expected" | "actual" | "result"]: #CellStyle}
+}
+
+// Formatting a table row applies to one of its cells
+#CellStyle: {
+	fill?:  string & =~"^[0-9A-Fa-f]{6}$"
+	color?: string & =~"^[0-9A-Fa-f]{6}$"
+	bold?:  bool
+}
+
+// A list item: plain or rich text, or an object with nested items one level deeper
+#ListItem: #RichText | {
+	text:   #RichText
+	items?: [...#ListItem]
+}
+
+// Page header or footer text; {{ page }} and {{ pages }} become page number fields
+#HeaderFooter: string | {
+	text:   string
+	align?: "left" | "center" | "right"
+}
+
+// Page setup of the section a Section component starts, in twentieths of a
+// point; anything omitted comes from the shell
+#Section: {
+	start?:       "next_page" | "odd_page" | "even_page" | "continuous"
+	page_size?:   "letter" | "legal" | "tabloid" | "a4" | "a3" | "a5"
+	orientation?: "portrait" | "landscape"
+	margins?: {
+		top?:    #Twips
+		right?:  #Twips
+		bottom?: #Twips
+		left?:   #Twips
+		header?: #Twips
+		footer?: #Twips
+		gutter?: #Twips
+	}
+	columns?:            int & >=1 & <=45
+	column_spacing?:     #Twips
+	page_number_start?:  int & >=0
+	page_number_format?: "decimal" | "lowerRoman" | "upperRoman" | "lowerLetter" | "upperLetter"
+
+	// With a known page size, the margins must leave room for text
+	_orientation: *"portrait" | "landscape"
+	if orientation != _|_ {
+		_orientation: orientation
+	}
+	_page: {
+		portrait: #PageSizes[page_size]
+		landscape: [portrait[1], portrait[0]]
+	}[_orientation]
+	if page_size != _|_ && margins.left != _|_ {
+		margins: right?: <(_page[0] - margins.left)
+	}
+	if page_size != _|_ && margins.top != _|_ {
+		margins: bottom?: <(_page[1] - margins.top)
+	}
+}
+
+// Portrait width and height of the named page sizes
+#PageSizes: {
+	letter:  [12240, 15840]
+	legal:   [12240, 20160]
+	tabloid: [15840, 24480]
+	a4:      [11906, 16838]
+	a3:      [16838, 23811]
+	a5:      [8391, 11906]
+}
+
+// A page measurement of at most four inches
+#Twips: int & >=0 & <=5760
\ No newline at end of file
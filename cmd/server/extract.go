@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"docgen-service/internal/docgen"
+)
+
+// runExtract cuts the components marked in an annotated master document out
+// into <Name>.component.xml files, writes starter CUE definitions for them
+// outside the component library, and reports the styles, lists and
+// relationships each depends on
+func runExtract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	inputPath := flags.String("input", "", "Path to the annotated master DOCX file")
+	outputDir := flags.String("output", "./assets/components", "Directory to write the components to")
+	schemasDir := flags.String("schemas", "./extracted_schemas", "Directory to write the starter CUE definitions to, for merging into the schema")
+	force := flags.Bool("force", false, "Overwrite existing component files")
+	flags.Parse(args)
+
+	if *inputPath == "" {
+		fmt.Fprintf(os.Stderr, "Usage: %s extract -input <path> [-output <dir>] [-schemas <dir>] [-force]\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+
+	master, err := docgen.LoadShell(*inputPath)
+	if err != nil {
+		log.Fatalf("Failed to load master document: %v", err)
+	}
+	components, err := docgen.ExtractComponents(master)
+	if err != nil {
+		log.Fatalf("Failed to extract components: %v", err)
+	}
+	if len(components) == 0 {
+		log.Fatalf("No components marked in %s: use Component_<Name> bookmarks or content controls tagged component:<Name>", *inputPath)
+	}
+
+	// The validator only loads the template's schema file, and everything in
+	// the component library is embedded in the binary, so the starter
+	// definitions are kept apart until they are merged into the schema
+	for _, dir := range []string{*outputDir, *schemasDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatalf("Failed to create output directory: %v", err)
+		}
+	}
+	for _, component := range components {
+		files := []struct{ path, content string }{
+			{filepath.Join(*outputDir, component.Name+".component.xml"), component.Template},
+			{filepath.Join(*schemasDir, component.Name+".cue"), component.Schema()},
+		}
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil && !*force {
+				log.Fatalf("%s already exists; use -force to overwrite it", f.path)
+			}
+		}
+		for _, f := range files {
+			if err := os.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+				log.Fatalf("Failed to write %s: %v", f.path, err)
+			}
+		}
+
+		fmt.Printf("%s: %s, %s\n", component.Name, files[0].path, files[1].path)
+		fmt.Printf("  props:         %s\n", listOrNone(component.Props))
+		fmt.Printf("  styles:        %s\n", listOrNone(component.Styles))
+		fmt.Printf("  numbering:     %s\n", listOrNone(component.NumIDs))
+		if len(component.Relationships) == 0 {
+			fmt.Printf("  relationships: none\n")
+		}
+		for i, rel := range component.Relationships {
+			label := ""
+			if i == 0 {
+				label = "relationships:"
+			}
+			target := rel.Target
+			if rel.TargetMode != "" {
+				target += " (" + rel.TargetMode + ")"
+			}
+			fmt.Printf("  %-14s %s %s %s\n", label, rel.ID, path.Base(rel.Type), target)
+		}
+	}
+}
+
+// listOrNone formats a list for the extraction report
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
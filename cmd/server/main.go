@@ -5,9 +5,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 
+	"docgen-service/assets"
 	"docgen-service/internal/docgen"
 )
 
@@ -18,12 +20,20 @@ func main() {
 		return
 	}
 
+	// Subcommands take their own flags
+	if os.Args[1] == "extract" {
+		runExtract(os.Args[2:])
+		return
+	}
+
 	// Define command-line flags for CLI mode
 	var (
 		serverMode     = flag.Bool("server", false, "Run in HTTP server mode")
-		shellPath      = flag.String("shell", "", "Path to the shell DOCX file")
-		componentsDir  = flag.String("components", "", "Directory containing component XML files")
-		schemaPath     = flag.String("schema", "./assets/schemas/rules.cue", "Path to the CUE schema file")
+		shellPath      = flag.String("shell", "", "Path to the shell DOCX file (default: the embedded shell)")
+		componentsDir  = flag.String("components", "", "Directory containing component XML files (default: the embedded components)")
+		schemaPath     = flag.String("schema", "", "Path to the CUE schema file used with -shell (default: ./assets/schemas/rules.cue)")
+		mediaDir       = flag.String("media", "", "Directory image props may reference by relative path (default: the embedded media without -shell)")
+		strict         = flag.Bool("strict", false, "Fail on unresolved placeholders and unused props")
 		planPath       = flag.String("plan", "", "Path to the JSON plan file")
 		outputPath     = flag.String("output", "", "Path where the generated DOCX should be saved")
 	)
@@ -35,29 +45,58 @@ func main() {
 		return
 	}
 
-	// CLI mode - validate required arguments
-	if *shellPath == "" || *componentsDir == "" || *planPath == "" || *outputPath == "" {
+	// CLI mode - validate required arguments. The shell and components come
+	// from disk together, or both from the embedded assets.
+	if (*shellPath == "") != (*componentsDir == "") || (*schemaPath != "" && *shellPath == "") || *planPath == "" || *outputPath == "" {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  Server mode: %s -server\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  CLI mode:    %s -shell <path> -components <dir> -schema <path> -plan <path> -output <path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  CLI mode:    %s [-shell <path> -components <dir> [-schema <path>]] [-media <dir>] [-strict] -plan <path> -output <path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  Extract:     %s extract -input <path> [-output <dir>] [-schemas <dir>] [-force]\n", os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	runCLI(*shellPath, *componentsDir, *schemaPath, *planPath, *outputPath)
+	runCLI(*shellPath, *componentsDir, *schemaPath, *mediaDir, *strict, *planPath, *outputPath)
 }
 
-func runCLI(shellPath, componentsDir, schemaPath, planPath, outputPath string) {
+func runCLI(shellPath, componentsDir, schemaPath, mediaDir string, strict bool, planPath, outputPath string) {
 	log.Printf("Starting DocGen CLI renderer...")
-	log.Printf("Shell: %s", shellPath)
-	log.Printf("Components: %s", componentsDir)
-	log.Printf("Schema: %s", schemaPath)
+
+	// Without a shell on disk the assets compiled into the binary are used
+	var fsys fs.FS = assets.FS
+	opts := []docgen.Option{docgen.WithStrictMode(strict)}
+	if shellPath != "" {
+		fsys = nil
+		if schemaPath == "" {
+			schemaPath = "./assets/schemas/rules.cue"
+		}
+		log.Printf("Shell: %s", shellPath)
+		log.Printf("Components: %s", componentsDir)
+		log.Printf("Schema: %s", schemaPath)
+	} else {
+		shellPath, componentsDir, schemaPath = "shell/template_shell.docx", "components", "schemas/rules.cue"
+		if mediaDir == "" {
+			media, _ := fs.Sub(assets.FS, "media")
+			opts = append(opts, docgen.WithMediaFS(media))
+		}
+		log.Printf("Assets: embedded")
+	}
+	log.Printf("Media: %s", mediaDir)
 	log.Printf("Plan: %s", planPath)
 	log.Printf("Output: %s", outputPath)
 
 	// Initialize the engine
 	log.Printf("Initializing DocGen engine...")
-	engine, err := docgen.NewEngine(shellPath, componentsDir, schemaPath)
+	if mediaDir != "" {
+		opts = append(opts, docgen.WithMediaDir(mediaDir))
+	}
+	var engine *docgen.Engine
+	var err error
+	if fsys != nil {
+		engine, err = docgen.NewEngineFS(fsys, shellPath, componentsDir, schemaPath, opts...)
+	} else {
+		engine, err = docgen.NewEngine(shellPath, componentsDir, schemaPath, opts...)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize engine: %v", err)
 	}
@@ -91,11 +130,15 @@ func runCLI(shellPath, componentsDir, schemaPath, planPath, outputPath string) {
 		log.Fatalf("Failed to assemble document: %v", err)
 	}
 
-	log.Printf("Document assembled successfully, size: %d bytes", len(result))
+	for _, warning := range result.Warnings {
+		log.Printf("Warning: %v", warning)
+	}
+
+	log.Printf("Document assembled successfully, size: %d bytes, sha256: %s", len(result.Document), result.SHA256)
 
 	// Write the result to the output file
 	log.Printf("Writing output file...")
-	if err := os.WriteFile(outputPath, result, 0644); err != nil {
+	if err := os.WriteFile(outputPath, result.Document, 0644); err != nil {
 		log.Fatalf("Failed to write output file: %v", err)
 	}
 
@@ -2,47 +2,205 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"docgen-service/assets"
 	"docgen-service/internal/api"
+	"docgen-service/internal/docgen"
 )
 
 // Config holds the server configuration
 type Config struct {
-	Port          string
+	Port string
+	// Assets holds the shell, components, schema and media: the copy compiled
+	// into the binary, or the directory named by AssetsDir
+	Assets    fs.FS
+	AssetsDir string
+	// ShellPath, ComponentsDir, SchemaPath and MediaDir are relative to
+	// Assets. Paths on disk, as given before the assets were embedded, are
+	// made relative to AssetsDir by LoadConfig.
 	ShellPath     string
 	ComponentsDir string
 	SchemaPath    string
+	MediaDir      string
+	Strict        bool
+	// TemplatesDir holds one subdirectory per template; when set it replaces
+	// ShellPath, ComponentsDir and SchemaPath
+	TemplatesDir    string
+	DefaultTemplate string
+	// AdminToken enables POST /admin/reload for clients presenting it
+	AdminToken string
+	// WatchInterval is how often the assets are checked for changes; zero
+	// disables the watcher
+	WatchInterval time.Duration
 }
 
 // LoadConfig loads configuration from environment variables with sensible defaults
-func LoadConfig() *Config {
+func LoadConfig() (*Config, error) {
 	config := &Config{
 		Port:          getEnv("PORT", "8080"),
-		ShellPath:     getEnv("DOCGEN_SHELL_PATH", "./assets/shell/template_shell.docx"),
-		ComponentsDir: getEnv("DOCGEN_COMPONENTS_DIR", "./assets/components/"),
-		SchemaPath:    getEnv("DOCGEN_SCHEMA_PATH", "./assets/schemas/rules.cue"),
+		Assets:        assets.FS,
+		AssetsDir:     getEnv("DOCGEN_ASSETS_DIR", ""),
+		ShellPath:     getEnv("DOCGEN_SHELL_PATH", "shell/template_shell.docx"),
+		ComponentsDir: getEnv("DOCGEN_COMPONENTS_DIR", "components"),
+		SchemaPath:    getEnv("DOCGEN_SCHEMA_PATH", "schemas/rules.cue"),
+		MediaDir:      getEnv("DOCGEN_MEDIA_DIR", "media"),
+		// Templates are optional; without them the single shell above is used
+		TemplatesDir:    getEnv("DOCGEN_TEMPLATES_DIR", ""),
+		DefaultTemplate: getEnv("DOCGEN_DEFAULT_TEMPLATE", ""),
+		AdminToken:      getEnv("DOCGEN_ADMIN_TOKEN", ""),
+	}
+
+	strict, err := strconv.ParseBool(getEnv("DOCGEN_STRICT", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCGEN_STRICT value: %w", err)
+	}
+	config.Strict = strict
+
+	watchInterval, err := time.ParseDuration(getEnv("DOCGEN_WATCH_INTERVAL", "0s"))
+	if err != nil || watchInterval < 0 {
+		return nil, fmt.Errorf("invalid DOCGEN_WATCH_INTERVAL value: %q", getEnv("DOCGEN_WATCH_INTERVAL", ""))
+	}
+	config.WatchInterval = watchInterval
+
+	if config.AssetsDir != "" {
+		if _, err := os.Stat(config.AssetsDir); err != nil {
+			return nil, fmt.Errorf("assets directory not found: %s", config.AssetsDir)
+		}
+		config.Assets = os.DirFS(config.AssetsDir)
+	}
+
+	if err := config.migrateDiskPaths(); err != nil {
+		return nil, err
+	}
+
+	// Paths name files of the assets, so "./components/" is "components"
+	for _, p := range []*string{&config.ShellPath, &config.ComponentsDir, &config.SchemaPath, &config.MediaDir} {
+		*p = path.Clean(filepath.ToSlash(*p))
+		if !fs.ValidPath(*p) {
+			return nil, fmt.Errorf("asset path %s must be relative to the assets directory", *p)
+		}
 	}
 
 	// Validate paths exist
-	if _, err := os.Stat(config.ShellPath); os.IsNotExist(err) {
-		log.Fatalf("Shell document not found: %s", config.ShellPath)
+	if config.TemplatesDir != "" {
+		if _, err := os.Stat(config.TemplatesDir); err != nil {
+			return nil, fmt.Errorf("templates directory not found: %s", config.TemplatesDir)
+		}
+	} else {
+		if _, err := fs.Stat(config.Assets, config.ShellPath); err != nil {
+			return nil, fmt.Errorf("shell document not found: %s", config.ShellPath)
+		}
+
+		if _, err := fs.Stat(config.Assets, config.ComponentsDir); err != nil {
+			return nil, fmt.Errorf("components directory not found: %s", config.ComponentsDir)
+		}
+
+		if _, err := fs.Stat(config.Assets, config.SchemaPath); err != nil {
+			return nil, fmt.Errorf("schema file not found: %s", config.SchemaPath)
+		}
 	}
 
-	if _, err := os.Stat(config.ComponentsDir); os.IsNotExist(err) {
-		log.Fatalf("Components directory not found: %s", config.ComponentsDir)
+	// The media directory is optional; without it image props must carry inline data
+	if _, err := fs.Stat(config.Assets, config.MediaDir); err != nil {
+		log.Printf("Media directory not found, image paths disabled: %s", config.MediaDir)
+		config.MediaDir = ""
 	}
 
-	if _, err := os.Stat(config.SchemaPath); os.IsNotExist(err) {
-		log.Fatalf("Schema file not found: %s", config.SchemaPath)
+	if config.embedded() && config.WatchInterval > 0 {
+		return nil, errors.New("DOCGEN_WATCH_INTERVAL requires DOCGEN_ASSETS_DIR or DOCGEN_TEMPLATES_DIR: " + errEmbeddedAssets.Error())
 	}
 
-	return config
+	return config, nil
+}
+
+// diskPath reports whether an asset path is a path on disk, absolute or
+// relative to the working directory like ./assets/components, which is how
+// the DOCGEN_*_PATH variables were given before the assets were embedded
+func diskPath(p string) bool {
+	p = filepath.ToSlash(p)
+	return filepath.IsAbs(p) || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../")
+}
+
+// migrateDiskPaths makes asset paths on disk relative to the assets
+// directory. Without DOCGEN_ASSETS_DIR, such paths keep reading every asset
+// from disk as before: the assets directory becomes the filesystem root, and
+// the paths not set default to their old location under ./assets.
+func (c *Config) migrateDiskPaths() error {
+	paths := []*string{&c.ShellPath, &c.ComponentsDir, &c.SchemaPath, &c.MediaDir}
+
+	onDisk := false
+	for _, p := range paths {
+		onDisk = onDisk || diskPath(*p)
+	}
+	if !onDisk {
+		return nil
+	}
+
+	root := c.AssetsDir
+	if root == "" {
+		log.Printf("DOCGEN_*_PATH values on disk are deprecated; reading the assets from disk instead of the embedded copy. Set DOCGEN_ASSETS_DIR and paths relative to it.")
+		for _, p := range paths {
+			if !diskPath(*p) {
+				*p = "./" + path.Join("assets", *p)
+			}
+		}
+		root = string(filepath.Separator)
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("invalid assets directory %s: %w", root, err)
+	}
+	for _, p := range paths {
+		if !diskPath(*p) {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return fmt.Errorf("invalid asset path %s: %w", *p, err)
+		}
+		rel, err := filepath.Rel(absRoot, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("asset path %s is outside the assets directory %s", *p, root)
+		}
+		*p = rel
+	}
+
+	if c.AssetsDir == "" {
+		c.AssetsDir = absRoot
+		c.Assets = os.DirFS(absRoot)
+	}
+	return nil
+}
+
+// errEmbeddedAssets rejects reloads of the assets compiled into the binary,
+// which cannot change while the server runs
+var errEmbeddedAssets = errors.New("the assets are embedded in the binary and cannot be reloaded; set DOCGEN_ASSETS_DIR to serve them from disk")
+
+// embedded reports whether the assets are the copy compiled into the binary
+func (c *Config) embedded() bool {
+	return c.AssetsDir == "" && c.TemplatesDir == ""
+}
+
+// assetsSource describes where the assets are loaded from
+func (c *Config) assetsSource() string {
+	if c.AssetsDir != "" {
+		return c.AssetsDir
+	}
+	return "embedded"
 }
 
 // getEnv returns environment variable value or default if not set
@@ -53,22 +211,107 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// templateConfigs finds the configured templates, or the single configured
+// shell as the default template. Templates are found again on every reload,
+// so templates added to the directory are picked up.
+func templateConfigs(config *Config) ([]docgen.TemplateConfig, error) {
+	if config.TemplatesDir == "" {
+		return []docgen.TemplateConfig{{
+			Name:          docgen.DefaultTemplate,
+			FS:            config.Assets,
+			ShellPath:     config.ShellPath,
+			ComponentsDir: config.ComponentsDir,
+			SchemaPath:    config.SchemaPath,
+		}}, nil
+	}
+	return docgen.LoadTemplateConfigs(config.TemplatesDir)
+}
+
+// watchSignals reloads the assets whenever the process receives SIGHUP
+func watchSignals(server *api.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Printf("SIGHUP received, reloading assets...")
+		if _, _, err := server.Reload(); err != nil {
+			log.Printf("Reload failed: %v", err)
+		}
+	}
+}
+
 func runServer() {
 	log.Printf("Starting DocGen HTTP Server...")
 
 	// Load configuration
-	config := LoadConfig()
+	config, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 	log.Printf("Configuration loaded:")
 	log.Printf("  Port: %s", config.Port)
-	log.Printf("  Shell: %s", config.ShellPath)
-	log.Printf("  Components: %s", config.ComponentsDir)
-	log.Printf("  Schema: %s", config.SchemaPath)
+	log.Printf("  Assets: %s", config.assetsSource())
+	if config.TemplatesDir != "" {
+		log.Printf("  Templates: %s", config.TemplatesDir)
+		log.Printf("  Default template: %s", config.DefaultTemplate)
+	} else {
+		log.Printf("  Shell: %s", config.ShellPath)
+		log.Printf("  Components: %s", config.ComponentsDir)
+		log.Printf("  Schema: %s", config.SchemaPath)
+	}
+	log.Printf("  Media: %s", config.MediaDir)
+	log.Printf("  Strict: %t", config.Strict)
+	log.Printf("  Admin reload: %t", config.AdminToken != "")
 
 	// Create API server
-	server, err := api.NewServer(config.ShellPath, config.ComponentsDir, config.SchemaPath)
+	opts := []docgen.Option{docgen.WithStrictMode(config.Strict)}
+	if config.MediaDir != "" {
+		media, err := fs.Sub(config.Assets, config.MediaDir)
+		if err != nil {
+			log.Fatalf("Failed to open media directory: %v", err)
+		}
+		opts = append(opts, docgen.WithMediaFS(media))
+	}
+	load := func() (*docgen.Registry, error) {
+		templates, err := templateConfigs(config)
+		if err != nil {
+			return nil, err
+		}
+		return docgen.NewRegistry(templates, config.DefaultTemplate, opts...)
+	}
+	if config.embedded() {
+		// Only the first load can succeed; SIGHUP and POST /admin/reload
+		// report that embedded assets cannot be reloaded
+		log.Printf("Assets are embedded: reloading is unavailable without DOCGEN_ASSETS_DIR")
+		initial := load
+		loaded := false
+		load = func() (*docgen.Registry, error) {
+			if loaded {
+				return nil, errEmbeddedAssets
+			}
+			loaded = true
+			return initial()
+		}
+	}
+	server, err := api.NewReloadableServer(load, config.AdminToken)
 	if err != nil {
 		log.Fatalf("Failed to create API server: %v", err)
 	}
+	log.Printf("Loaded assets version %s", server.AssetVersion())
+
+	// Reload the assets on SIGHUP and, if enabled, when they change on disk
+	go watchSignals(server)
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if config.WatchInterval > 0 {
+		log.Printf("Watching assets for changes every %v", config.WatchInterval)
+		go server.WatchAssets(watchCtx, config.WatchInterval, func() (string, error) {
+			templates, err := templateConfigs(config)
+			if err != nil {
+				return "", err
+			}
+			return docgen.AssetVersion(templates)
+		})
+	}
 
 	// Setup routes
 	mux := server.SetupRoutes()
@@ -94,6 +337,9 @@ func runServer() {
 		log.Printf("  POST /validate-plan - Validate document plan against schema")
 		log.Printf("  GET  /health        - Health check")
 		log.Printf("  GET  /components    - List available components")
+		if config.AdminToken != "" {
+			log.Printf("  POST /admin/reload  - Reload shell, components and schema")
+		}
 
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
@@ -2,30 +2,156 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"docgen-service/internal/docgen"
+	"docgen-service/internal/validator"
 )
 
 // Server holds the HTTP server dependencies
 type Server struct {
-	engine *docgen.Engine
+	// registry holds the engines of the current asset version. Reloads swap
+	// it as a whole, and each request uses the one it started with.
+	registry atomic.Pointer[docgen.Registry]
+	// load builds the registry from the assets; nil disables reloading
+	load func() (*docgen.Registry, error)
+	// adminToken authorizes POST /admin/reload; empty disables the endpoint
+	adminToken string
+	// reloadMu serializes reloads
+	reloadMu sync.Mutex
 }
 
-// NewServer creates a new API server with the DocGen engine
-func NewServer(shellPath, componentsDir, schemaPath string) (*Server, error) {
-	engine, err := docgen.NewEngine(shellPath, componentsDir, schemaPath)
+// NewServer creates a new API server rendering every plan with one DocGen engine
+func NewServer(shellPath, componentsDir, schemaPath string, opts ...docgen.Option) (*Server, error) {
+	return NewReloadableServer(func() (*docgen.Registry, error) {
+		return docgen.NewSingleTemplateRegistry(shellPath, componentsDir, schemaPath, opts...)
+	}, "")
+}
+
+// NewRegistryServer creates a new API server rendering each plan with the
+// engine of the template it selects. Its assets cannot be reloaded.
+func NewRegistryServer(registry *docgen.Registry) *Server {
+	server := &Server{}
+	server.registry.Store(registry)
+	return server
+}
+
+// NewReloadableServer creates a new API server with the registry load builds,
+// calling load again on every reload. A non-empty adminToken enables
+// POST /admin/reload for clients presenting it as a bearer token.
+func NewReloadableServer(load func() (*docgen.Registry, error), adminToken string) (*Server, error) {
+	registry, err := load()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create DocGen engine: %w", err)
 	}
 
-	return &Server{
-		engine: engine,
-	}, nil
+	server := NewRegistryServer(registry)
+	server.load = load
+	server.adminToken = adminToken
+	return server, nil
+}
+
+// assets returns the registry a request is served from, reporting its asset
+// version in the response
+func (s *Server) assets(w http.ResponseWriter) *docgen.Registry {
+	registry := s.registry.Load()
+	w.Header().Set(assetVersionHeader, registry.Version())
+	return registry
+}
+
+// planEngine returns the engine of the template a plan selects. An invalid or
+// unknown template is answered with a validation error response.
+func planEngine(w http.ResponseWriter, registry *docgen.Registry, planData map[string]interface{}, route string) (*docgen.Engine, bool) {
+	var engine *docgen.Engine
+	var err error
+	name, isString := planData["template"].(string)
+	if _, present := planData["template"]; present && !isString {
+		err = errors.New("template must be a string")
+	} else {
+		engine, err = registry.Engine(name)
+	}
+	if err == nil {
+		return engine, true
+	}
+
+	log.Printf("%s - Template selection failed: %v", route, err)
+	response := map[string]interface{}{
+		"status": "invalid",
+		"valid":  false,
+		"errors": []validator.ValidationError{{Path: "template", Message: err.Error()}},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("%s - Failed to encode template error response: %v", route, err)
+	}
+	return nil, false
+}
+
+// templateComponents returns the sorted component names of each template
+func templateComponents(registry *docgen.Registry) map[string][]string {
+	inventories := make(map[string][]string)
+	for _, name := range registry.Templates() {
+		engine, _ := registry.Engine(name)
+		components := engine.GetLoadedComponents()
+		sort.Strings(components)
+		inventories[name] = components
+	}
+	return inventories
+}
+
+// componentVersions returns the sorted versions of each component the named
+// templates have
+func componentVersions(registry *docgen.Registry, templates ...string) map[string][]int {
+	seen := make(map[string]map[int]bool)
+	for _, name := range templates {
+		engine, err := registry.Engine(name)
+		if err != nil {
+			continue
+		}
+		for component, versions := range engine.GetComponentVersions() {
+			if seen[component] == nil {
+				seen[component] = make(map[int]bool)
+			}
+			for _, version := range versions {
+				seen[component][version] = true
+			}
+		}
+	}
+
+	versions := make(map[string][]int, len(seen))
+	for component, set := range seen {
+		for version := range set {
+			versions[component] = append(versions[component], version)
+		}
+		sort.Ints(versions[component])
+	}
+	return versions
+}
+
+// allComponents returns the sorted names of the components any template has
+func allComponents(inventories map[string][]string) []string {
+	seen := make(map[string]bool)
+	var components []string
+	for _, inventory := range inventories {
+		for _, name := range inventory {
+			if !seen[name] {
+				seen[name] = true
+				components = append(components, name)
+			}
+		}
+	}
+	sort.Strings(components)
+	return components
 }
 
 // GenerateHandler handles POST /generate requests
@@ -37,6 +163,7 @@ func (s *Server) GenerateHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Log request start
 	log.Printf("POST /generate - Request started")
+	registry := s.assets(w)
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
@@ -55,8 +182,12 @@ func (s *Server) GenerateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the plan using CUE schema
-	validationResult := s.engine.ValidatePlan(planData)
+	// Validate the plan using the CUE schema of its template
+	engine, ok := planEngine(w, registry, planData, "POST /generate")
+	if !ok {
+		return
+	}
+	validationResult := engine.ValidatePlan(planData)
 	if !validationResult.Valid {
 		log.Printf("POST /generate - Plan validation failed with %d errors", len(validationResult.Errors))
 
@@ -82,14 +213,45 @@ func (s *Server) GenerateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate document using existing engine
-	result, err := s.engine.Assemble(plan)
+	// The strict query parameter overrides the engine's strict mode
+	var assembleOpts []docgen.AssembleOption
+	if value := r.URL.Query().Get("strict"); value != "" {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid strict parameter", http.StatusBadRequest)
+			return
+		}
+		assembleOpts = append(assembleOpts, docgen.Strict(strict))
+	}
+
+	// Generate document using the template's engine
+	result, err := engine.Assemble(plan, assembleOpts...)
 	if err != nil {
+		var strictErr *docgen.StrictRenderError
+		if errors.As(err, &strictErr) {
+			log.Printf("POST /generate - Strict render failed: %d component(s) with mismatches", len(strictErr.Mismatches))
+			response := map[string]interface{}{
+				"status": "render_error",
+				"errors": strictErr.Mismatches,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				log.Printf("POST /generate - Failed to encode render error response: %v", err)
+			}
+			return
+		}
+
 		log.Printf("POST /generate - Document assembly failed: %v", err)
 		http.Error(w, "Failed to generate document", http.StatusInternalServerError)
 		return
 	}
 
+	for _, warning := range result.Warnings {
+		log.Printf("POST /generate - Warning: %v", warning)
+		w.Header().Add("X-DocGen-Warning", warning.Error())
+	}
+
 	// Determine filename
 	filename := plan.DocProps.Filename
 	if filename == "" {
@@ -102,15 +264,16 @@ func (s *Server) GenerateHandler(w http.ResponseWriter, r *http.Request) {
 	// Set response headers
 	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(result)))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(result.Document)))
+	w.Header().Set("X-DocGen-SHA256", result.SHA256)
 
 	// Write document data
-	if _, err := w.Write(result); err != nil {
+	if _, err := w.Write(result.Document); err != nil {
 		log.Printf("POST /generate - Failed to write response: %v", err)
 		return
 	}
 
-	log.Printf("POST /generate - Document generated successfully: %s (%d bytes)", filename, len(result))
+	log.Printf("POST /generate - Document generated successfully: %s (%d bytes, sha256 %s)", filename, len(result.Document), result.SHA256)
 }
 
 // ValidatePlanHandler handles POST /validate-plan requests
@@ -122,6 +285,7 @@ func (s *Server) ValidatePlanHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Log request start
 	log.Printf("POST /validate-plan - Request started")
+	registry := s.assets(w)
 
 	// Read request body
 	body, err := io.ReadAll(r.Body)
@@ -140,8 +304,12 @@ func (s *Server) ValidatePlanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the plan using the engine's validator
-	validationResult := s.engine.ValidatePlan(planData)
+	// Validate the plan using the validator of its template's engine
+	engine, ok := planEngine(w, registry, planData, "POST /validate-plan")
+	if !ok {
+		return
+	}
+	validationResult := engine.ValidatePlan(planData)
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -180,14 +348,18 @@ func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if engine is available and components are loaded
-	components := s.engine.GetLoadedComponents()
+	// Check if the templates' engines are available and components are loaded
+	registry := s.assets(w)
+	components := allComponents(templateComponents(registry))
 
 	response := map[string]interface{}{
 		"status": "healthy",
 		"service": "docgen-service",
 		"components_loaded": len(components),
 		"available_components": components,
+		"templates": registry.Templates(),
+		"default_template": registry.DefaultTemplate(),
+		"asset_version": registry.Version(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -205,11 +377,37 @@ func (s *Server) ComponentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	components := s.engine.GetLoadedComponents()
+	// List the components of every template, or of the one the query names
+	registry := s.assets(w)
+	inventories := templateComponents(registry)
+	components := allComponents(inventories)
+	selected := registry.Templates()
+	if name := r.URL.Query().Get("template"); name != "" {
+		inventory, exists := inventories[name]
+		if !exists {
+			http.Error(w, fmt.Sprintf("Template not found: %s", name), http.StatusNotFound)
+			return
+		}
+		components = inventory
+		selected = []string{name}
+	}
+
+	templates := make(map[string]interface{})
+	for name, inventory := range inventories {
+		templates[name] = map[string]interface{}{
+			"components": inventory,
+			"count": len(inventory),
+			"versions": componentVersions(registry, name),
+		}
+	}
 
 	response := map[string]interface{}{
 		"components": components,
 		"count": len(components),
+		"versions": componentVersions(registry, selected...),
+		"templates": templates,
+		"default_template": registry.DefaultTemplate(),
+		"asset_version": registry.Version(),
 		"note": "Detailed component specifications available in /docs/components/",
 	}
 
@@ -229,6 +427,7 @@ func (s *Server) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("/validate-plan", s.ValidatePlanHandler)
 	mux.HandleFunc("/health", s.HealthHandler)
 	mux.HandleFunc("/components", s.ComponentsHandler)
+	mux.HandleFunc("/admin/reload", s.ReloadHandler)
 
 	return mux
 }
\ No newline at end of file
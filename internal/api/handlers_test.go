@@ -2,22 +2,37 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"docgen-service/assets"
 	"docgen-service/internal/docgen"
 )
 
 // setupTestServer creates a test server for HTTP integration tests
 func setupTestServer(t *testing.T) *Server {
-	server, err := NewServer("../../assets/shell/template_shell.docx", "../../assets/components/", "../../assets/schemas/rules.cue")
+	registry, err := docgen.NewRegistry([]docgen.TemplateConfig{{
+		Name:          docgen.DefaultTemplate,
+		FS:            assets.FS,
+		ShellPath:     "shell/template_shell.docx",
+		ComponentsDir: "components",
+		SchemaPath:    "schemas/rules.cue",
+	}}, "")
 	if err != nil {
 		t.Fatalf("Failed to create test server: %v", err)
 	}
-	return server
+	return NewRegistryServer(registry)
 }
 
 func TestGenerateHandler_Success(t *testing.T) {
@@ -83,6 +98,12 @@ func TestGenerateHandler_Success(t *testing.T) {
 		t.Error("Response body is empty")
 	}
 
+	// Check that the content hash matches the body
+	sum := sha256.Sum256(w.Body.Bytes())
+	if got := w.Header().Get("X-DocGen-SHA256"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected X-DocGen-SHA256 to match the document, got %q", got)
+	}
+
 	t.Logf("Generated document size: %d bytes", w.Body.Len())
 }
 
@@ -854,4 +875,405 @@ func TestGenerateHandler_MultipleDocumentTitles(t *testing.T) {
 	}
 
 	t.Log("Generate endpoint multiple DocumentTitle validation test passed")
-}
\ No newline at end of file
+}
+
+func TestGenerateHandler_StrictMode(t *testing.T) {
+	server := setupTestServer(t)
+
+	// category_titel is not used by DocumentCategoryTitle, nor subtitle by
+	// DocumentTitle
+	plan := docgen.DocumentPlan{
+		Body: []docgen.ComponentInstance{
+			{
+				Component: "DocumentTitle",
+				Props: map[string]interface{}{
+					"document_title": "Strict Test Document",
+					"subtitle":       "Unused",
+				},
+			},
+			{
+				Component: "DocumentCategoryTitle",
+				Props: map[string]interface{}{
+					"category_title": "HTTP API TEST",
+					"category_titel": "HTTP API TEST",
+				},
+			},
+		},
+	}
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Failed to marshal test plan: %v", err)
+	}
+
+	// Without strict mode the document is generated with a warning header
+	req := httptest.NewRequest(http.MethodPost, "/generate", bytes.NewBuffer(planJSON))
+	w := httptest.NewRecorder()
+	server.GenerateHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	warnings := w.Header().Values("X-DocGen-Warning")
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "DocumentCategoryTitle") || !strings.Contains(warnings[1], "category_titel") {
+		t.Errorf("Expected warnings about subtitle and category_titel, got %q", warnings)
+	}
+
+	// With strict=true the request is rejected with the findings of every
+	// component
+	req = httptest.NewRequest(http.MethodPost, "/generate?strict=true", bytes.NewBuffer(planJSON))
+	w = httptest.NewRecorder()
+	server.GenerateHandler(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+
+	var response struct {
+		Status string                         `json:"status"`
+		Errors []docgen.TemplateMismatchError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Status != "render_error" || len(response.Errors) != 2 {
+		t.Fatalf("Unexpected response: %s", w.Body.String())
+	}
+	if got := response.Errors[0]; got.Index != 0 || len(got.Unused) != 1 || got.Unused[0] != "subtitle" {
+		t.Errorf("Unexpected render error: %+v", got)
+	}
+	if got := response.Errors[1]; got.Index != 1 || len(got.Unused) != 1 || got.Unused[0] != "category_titel" {
+		t.Errorf("Unexpected render error: %+v", got)
+	}
+}
+
+// setupTemplateServer creates a test server with the test-report template as
+// default and a memo template with its own components and schema
+func setupTemplateServer(t *testing.T) *Server {
+	memo := t.TempDir()
+	files := map[string]string{
+		"components/DocumentTitle.component.xml": `<w:p><w:r><w:t>{{ document_title }}</w:t></w:r></w:p>`,
+		"components/MemoLine.component.xml":      `<w:p><w:r><w:t>To: {{ recipient }}</w:t></w:r></w:p>`,
+		"schema.cue": `package docgen
+
+#DocumentPlan: {
+	template?:  string
+	doc_props?: {...}
+	body: [...{component: "DocumentTitle" | "MemoLine", props: {...}}]
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(memo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	registry, err := docgen.NewRegistry([]docgen.TemplateConfig{
+		{
+			Name:          "test-report",
+			ShellPath:     "../../assets/shell/template_shell.docx",
+			ComponentsDir: "../../assets/components/",
+			SchemaPath:    "../../assets/schemas/rules.cue",
+		},
+		{
+			Name:          "memo",
+			ShellPath:     "../../assets/shell/template_shell.docx",
+			ComponentsDir: filepath.Join(memo, "components"),
+			SchemaPath:    filepath.Join(memo, "schema.cue"),
+		},
+	}, "test-report")
+	if err != nil {
+		t.Fatalf("Failed to create template registry: %v", err)
+	}
+	return NewRegistryServer(registry)
+}
+
+func TestGenerateHandler_TemplateSelection(t *testing.T) {
+	server := setupTemplateServer(t)
+	memoPlan := `{"body": [
+		{"component": "DocumentTitle", "props": {"document_title": "Memo"}},
+		{"component": "MemoLine", "props": {"recipient": "QA"}}
+	]`
+
+	testCases := []struct {
+		name     string
+		plan     string
+		status   int
+		errorMsg string
+	}{
+		{"memo template", `{"template": "memo", ` + memoPlan[1:], http.StatusOK, ""},
+		{"default template rejects memo components", memoPlan, http.StatusBadRequest, ""},
+		{"unknown template", `{"template": "cert-of-conformance", ` + memoPlan[1:], http.StatusBadRequest, "template not found: cert-of-conformance"},
+		{"template not a string", `{"template": 1, ` + memoPlan[1:], http.StatusBadRequest, "template must be a string"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(tc.plan+"}"))
+			w := httptest.NewRecorder()
+			server.GenerateHandler(w, req)
+
+			if w.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+			if tc.errorMsg == "" {
+				return
+			}
+			var response struct {
+				Errors []struct {
+					Path    string `json:"path"`
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if len(response.Errors) != 1 || response.Errors[0].Path != "template" || !strings.Contains(response.Errors[0].Message, tc.errorMsg) {
+				t.Errorf("Expected a template error containing %q, got %s", tc.errorMsg, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestComponentsHandler_Templates(t *testing.T) {
+	server := setupTemplateServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/components", nil)
+	w := httptest.NewRecorder()
+	server.ComponentsHandler(w, req)
+
+	var response struct {
+		Components      []string `json:"components"`
+		DefaultTemplate string   `json:"default_template"`
+		Templates       map[string]struct {
+			Components []string `json:"components"`
+			Count      int      `json:"count"`
+		} `json:"templates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse components response: %v", err)
+	}
+	if response.DefaultTemplate != "test-report" || len(response.Templates) != 2 {
+		t.Fatalf("Expected both templates with test-report as default, got %s", w.Body.String())
+	}
+	// Built-in components such as Heading are available in every template
+	if memo := response.Templates["memo"]; memo.Count != len(memo.Components) || !strings.Contains(strings.Join(memo.Components, ","), "DocumentTitle,Heading,MemoLine") || strings.Contains(strings.Join(memo.Components, ","), "TestBlock") {
+		t.Errorf("Expected the memo template's own components, got %+v", memo)
+	}
+	if report := response.Templates["test-report"]; !strings.Contains(strings.Join(report.Components, ","), "TestBlock") || !strings.Contains(strings.Join(response.Components, ","), "MemoLine") {
+		t.Errorf("Expected the test-report inventory and all components at the top level, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/components?template=memo", nil)
+	w = httptest.NewRecorder()
+	server.ComponentsHandler(w, req)
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse components response: %v", err)
+	}
+	if strings.Join(response.Components, ",") != strings.Join(response.Templates["memo"].Components, ",") {
+		t.Errorf("Expected the memo components for ?template=memo, got %v", response.Components)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/components?template=letter", nil)
+	w = httptest.NewRecorder()
+	server.ComponentsHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown template, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// setupReloadServer creates a reloadable test server whose components live in
+// a temporary directory the test can edit
+func setupReloadServer(t *testing.T, adminToken string) (*Server, string) {
+	componentsDir := t.TempDir()
+	writeTitleComponent(t, componentsDir, `<w:p><w:r><w:t>{{ document_title }}</w:t></w:r></w:p>`)
+
+	server, err := NewReloadableServer(func() (*docgen.Registry, error) {
+		return docgen.NewSingleTemplateRegistry("../../assets/shell/template_shell.docx", componentsDir, "../../assets/schemas/rules.cue")
+	}, adminToken)
+	if err != nil {
+		t.Fatalf("Failed to create test server: %v", err)
+	}
+	return server, componentsDir
+}
+
+// writeTitleComponent writes the DocumentTitle component of a reload test
+func writeTitleComponent(t *testing.T, componentsDir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(componentsDir, "DocumentTitle.component.xml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	server, componentsDir := setupReloadServer(t, "secret")
+	mux := server.SetupRoutes()
+
+	reload := func(authorization string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	generateVersion := func() string {
+		plan := `{"body": [{"component": "DocumentTitle", "props": {"document_title": "Reload Test"}}]}`
+		req := httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(plan))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		return w.Header().Get(assetVersionHeader)
+	}
+
+	initial := generateVersion()
+	if initial == "" || initial != server.AssetVersion() {
+		t.Fatalf("Expected responses to report asset version %q, got %q", server.AssetVersion(), initial)
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		if code, _ := reload(authorization); code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected status %d, got %d", authorization, http.StatusUnauthorized, code)
+		}
+	}
+
+	if code, response := reload("Bearer secret"); code != http.StatusOK || response["status"] != "unchanged" || response["asset_version"] != initial {
+		t.Errorf("Expected an unchanged reload, got %d %v", code, response)
+	}
+
+	writeTitleComponent(t, componentsDir, `<w:p><w:r><w:t>Title: {{ document_title }}</w:t></w:r></w:p>`)
+	code, response := reload("Bearer secret")
+	if code != http.StatusOK || response["status"] != "reloaded" || response["previous_version"] != initial || response["asset_version"] == initial {
+		t.Fatalf("Expected the edited component to be reloaded, got %d %v", code, response)
+	}
+	reloaded := generateVersion()
+	if reloaded != response["asset_version"] {
+		t.Errorf("Expected responses to report the reloaded version %v, got %s", response["asset_version"], reloaded)
+	}
+
+	// A broken component is rejected and the current assets keep serving
+	writeTitleComponent(t, componentsDir, `<w:p><w:r><w:t>{{ document_title }}</w:t></w:r>`)
+	code, response = reload("Bearer secret")
+	if code != http.StatusInternalServerError || response["status"] != "reload_failed" || response["asset_version"] != reloaded {
+		t.Errorf("Expected the broken component to be rejected, got %d %v", code, response)
+	}
+	if version := generateVersion(); version != reloaded {
+		t.Errorf("Expected version %s to keep serving, got %s", reloaded, version)
+	}
+
+	// Without an admin token the endpoint does not exist
+	server, _ = setupReloadServer(t, "")
+	req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	server.SetupRoutes().ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d without an admin token, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWatchAssets(t *testing.T) {
+	server, componentsDir := setupReloadServer(t, "")
+	initial := server.AssetVersion()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.WatchAssets(ctx, 10*time.Millisecond, func() (string, error) {
+		return docgen.AssetVersion([]docgen.TemplateConfig{{
+			Name:          docgen.DefaultTemplate,
+			ShellPath:     "../../assets/shell/template_shell.docx",
+			ComponentsDir: componentsDir,
+			SchemaPath:    "../../assets/schemas/rules.cue",
+		}})
+	})
+
+	writeTitleComponent(t, componentsDir, `<w:p><w:r><w:t>Title: {{ document_title }}</w:t></w:r></w:p>`)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.AssetVersion() == initial {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the watcher to reload the edited component")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestComponentVersions(t *testing.T) {
+	shell, err := fs.ReadFile(assets.FS, "shell/template_shell.docx")
+	if err != nil {
+		t.Fatalf("Failed to read embedded shell: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"shell.docx": {Data: shell},
+		"schema.cue": {Data: []byte(`package docgen
+
+#DocumentPlan: {
+	doc_props?: {...}
+	body: [...{component: "DocumentTitle" | "Stamp" | "Stamp@2", props: {...}}]
+}
+`)},
+		"components/DocumentTitle.component.xml": {Data: []byte(`<w:p><w:r><w:t>{{ document_title }}</w:t></w:r></w:p>`)},
+		"components/Stamp.component.xml":         {Data: []byte(`<w:p><w:r><w:t>Stamp v1: {{ text }}</w:t></w:r></w:p>`)},
+		"components/Stamp@2.component.xml":       {Data: []byte(`<w:p><w:r><w:t>Stamp v2: {{ text }}</w:t></w:r></w:p>`)},
+	}
+	registry, err := docgen.NewRegistry([]docgen.TemplateConfig{{
+		Name:          docgen.DefaultTemplate,
+		FS:            fsys,
+		ShellPath:     "shell.docx",
+		ComponentsDir: "components",
+		SchemaPath:    "schema.cue",
+	}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	server := NewRegistryServer(registry)
+
+	w := httptest.NewRecorder()
+	server.ComponentsHandler(w, httptest.NewRequest(http.MethodGet, "/components", nil))
+	var response struct {
+		Components []string         `json:"components"`
+		Versions   map[string][]int `json:"versions"`
+		Templates  map[string]struct {
+			Versions map[string][]int `json:"versions"`
+		} `json:"templates"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse components response: %v", err)
+	}
+	if versions := response.Versions["Stamp"]; len(versions) != 2 || versions[0] != 1 || versions[1] != 2 {
+		t.Errorf("Expected Stamp versions [1 2], got %s", w.Body.String())
+	}
+	if versions := response.Templates[docgen.DefaultTemplate].Versions["Stamp"]; len(versions) != 2 {
+		t.Errorf("Expected the template to list Stamp versions [1 2], got %s", w.Body.String())
+	}
+	if strings.Contains(strings.Join(response.Components, ","), "@") {
+		t.Errorf("Expected component names without versions, got %v", response.Components)
+	}
+
+	generate := func(component string) (int, string) {
+		plan := `{"body": [
+			{"component": "DocumentTitle", "props": {"document_title": "Versions"}},
+			{"component": "` + component + `", "props": {"text": "Approved"}}
+		]}`
+		w := httptest.NewRecorder()
+		server.GenerateHandler(w, httptest.NewRequest(http.MethodPost, "/generate", strings.NewReader(plan)))
+		return w.Code, w.Header().Get("X-DocGen-SHA256")
+	}
+	_, latest := generate("Stamp")
+	_, pinnedLatest := generate("Stamp@2")
+	_, pinnedFirst := generate("Stamp@1")
+	if latest == "" || latest != pinnedLatest || latest == pinnedFirst {
+		t.Errorf("Expected Stamp to render as Stamp@2 and differ from Stamp@1")
+	}
+	if status, _ := generate("Stamp@3"); status != http.StatusBadRequest {
+		t.Errorf("Expected a missing version to be rejected, got status %d", status)
+	}
+}
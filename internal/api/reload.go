@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// assetVersionHeader reports the asset version that produced a response
+const assetVersionHeader = "X-DocGen-Asset-Version"
+
+// AssetVersion returns the version of the assets requests are served from
+func (s *Server) AssetVersion() string {
+	return s.registry.Load().Version()
+}
+
+// Reload loads the assets again and swaps them in once every template has
+// loaded, so a broken component or schema leaves the current version serving.
+// Requests already in flight finish on the version they started with. It
+// returns the previous and the current asset version.
+func (s *Server) Reload() (string, string, error) {
+	if s.load == nil {
+		return "", "", errors.New("reloading is not configured")
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	previous := s.AssetVersion()
+	registry, err := s.load()
+	if err != nil {
+		return previous, previous, fmt.Errorf("new assets rejected, still serving version %s: %w", previous, err)
+	}
+	if registry.Version() == previous {
+		return previous, previous, nil
+	}
+
+	s.registry.Store(registry)
+	log.Printf("Assets reloaded: version %s replaces %s, templates %v", registry.Version(), previous, registry.Templates())
+	return previous, registry.Version(), nil
+}
+
+// ReloadHandler handles POST /admin/reload requests, which must carry the
+// admin token as a bearer token
+func (s *Server) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if s.adminToken == "" || s.load == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, isBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !isBearer || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		log.Printf("POST /admin/reload - Unauthorized")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	log.Printf("POST /admin/reload - Request started")
+	previous, current, err := s.Reload()
+
+	status := http.StatusOK
+	response := map[string]interface{}{
+		"status":           "reloaded",
+		"asset_version":    current,
+		"previous_version": previous,
+	}
+	switch {
+	case err != nil:
+		log.Printf("POST /admin/reload - Reload failed: %v", err)
+		status = http.StatusInternalServerError
+		response["status"] = "reload_failed"
+		response["error"] = err.Error()
+	case current == previous:
+		response["status"] = "unchanged"
+	}
+
+	w.Header().Set(assetVersionHeader, current)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("POST /admin/reload - Failed to encode response: %v", err)
+	}
+}
+
+// WatchAssets reloads the assets whenever version, which identifies the
+// assets on disk, differs from the version being served. It checks every
+// interval until ctx is done.
+func (s *Server) WatchAssets(ctx context.Context, interval time.Duration, version func() (string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Assets that failed to load are not retried until they change again
+	var rejected string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		onDisk, err := version()
+		if err != nil {
+			log.Printf("Asset watcher: %v", err)
+			continue
+		}
+		if onDisk == s.AssetVersion() || onDisk == rejected {
+			continue
+		}
+		if _, _, err := s.Reload(); err != nil {
+			log.Printf("Asset watcher: %v", err)
+			rejected = onDisk
+		}
+	}
+}
@@ -2,92 +2,261 @@ package docgen
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/beevik/etree"
 )
 
-// AssembleDocument assembles components into the shell document according to the plan
-func (e *Engine) AssembleDocument(plan DocumentPlan) ([]byte, error) {
-	// Create a working copy of the shell document
-	workingDoc := e.shell.Clone()
+// componentWrapper wraps component XML in a temporary root that declares the
+// namespaces used by components, so fragments with several top-level elements parse
+const componentWrapper = "<temp xmlns:w=\"http://schemas.openxmlformats.org/wordprocessingml/2006/main\" xmlns:mc=\"http://schemas.openxmlformats.org/markup-compatibility/2006\" xmlns:wp=\"http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing\" xmlns:wp14=\"http://schemas.microsoft.com/office/word/2010/wordprocessingDrawing\" xmlns:a=\"http://schemas.openxmlformats.org/drawingml/2006/main\" xmlns:wps=\"http://schemas.microsoft.com/office/word/2010/wordprocessingShape\" xmlns:a14=\"http://schemas.microsoft.com/office/drawing/2010/main\" xmlns:v=\"urn:schemas-microsoft-com:vml\" xmlns:w10=\"urn:schemas-microsoft-com:office:word\" xmlns:o=\"urn:schemas-microsoft-com:office:office\" xmlns:r=\"http://schemas.openxmlformats.org/officeDocument/2006/relationships\" xmlns:pic=\"http://schemas.openxmlformats.org/drawingml/2006/picture\">%s</temp>"
 
-	// Get the document.xml content
-	documentXML, exists := workingDoc["word/document.xml"]
-	if !exists {
-		return nil, NewDocGenError("assembly", fmt.Errorf("word/document.xml not found in shell document"))
-	}
+// assembly holds the state of a single document while a plan is rendered into it
+type assembly struct {
+	engine *Engine
+	docx   InMemoryDocx
+	doc    *etree.Document
+	body   *etree.Element
+	slots  map[string]*slot
+	// relationshipIDs caches relationships created for this document by type and target
+	relationshipIDs map[string]string
+	// images holds the images embedded in word/media by content hash
+	images map[string]*embeddedImage
+	// sectionBreaks holds the page setup requested by each Section component,
+	// keyed by the w:sectPr it rendered
+	sectionBreaks map[*etree.Element]*sectionSettings
+	// tableOfContents holds the placeholder paragraphs of TOC components
+	tableOfContents []*etree.Element
+	// styleIDs holds the styles the shell defines, read when first needed
+	styleIDs map[string]bool
+	// importedComponents records the directory components whose styles,
+	// lists and relationships have been added to the document
+	importedComponents map[string]*importedComponent
+}
+
+// newAssembly prepares a working copy of the shell for rendering a plan
+func (e *Engine) newAssembly() (*assembly, error) {
+	// Create a working copy of the shell document
+	workingDoc := e.shell.workingCopy()
 
-	// Parse the document XML
-	doc := etree.NewDocument()
-	if err := doc.ReadFromBytes(documentXML); err != nil {
-		return nil, NewDocGenError("assembly", fmt.Errorf("failed to parse document.xml: %w", err))
+	// Copy the document XML parsed at load, which is much cheaper than
+	// parsing it again
+	var doc *etree.Document
+	if e.document != nil {
+		doc = e.document.Copy()
+	} else {
+		var err error
+		if doc, err = parseShellDocument(workingDoc); err != nil {
+			return nil, err
+		}
 	}
 
 	// Find the document body
 	body := doc.FindElement("//w:body")
 	if body == nil {
-		return nil, NewDocGenError("assembly", fmt.Errorf("w:body element not found in document.xml"))
+		return nil, fmt.Errorf("w:body element not found in document.xml")
 	}
 
-	// Process each component in the plan
-	for _, componentInstance := range plan.Body {
-		if err := e.addComponentToBody(body, componentInstance); err != nil {
-			return nil, NewDocGenError("assembly", fmt.Errorf("failed to add component %s: %w", componentInstance.Component, err))
+	// Drop the shell's empty _GoBack paragraph so content starts at the top
+	removePlaceholderParagraphs(body)
+
+	slots, err := findSlots(body)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := slots[DefaultSlot]; !exists {
+		slots[DefaultSlot] = defaultBodySlot(body)
+	}
+
+	return &assembly{
+		engine:             e,
+		docx:               workingDoc,
+		doc:                doc,
+		body:               body,
+		slots:              slots,
+		relationshipIDs:    make(map[string]string),
+		images:             make(map[string]*embeddedImage),
+		sectionBreaks:      make(map[*etree.Element]*sectionSettings),
+		importedComponents: make(map[string]*importedComponent),
+	}, nil
+}
+
+// AssembleDocument assembles components into the shell document according to the plan
+func (e *Engine) AssembleDocument(plan DocumentPlan) ([]byte, error) {
+	document, _, err := e.assemble(plan, assembleSettings{strict: e.strict})
+	return document, err
+}
+
+// assemble renders the plan and returns the DOCX bytes together with the
+// template mismatches found outside strict mode
+func (e *Engine) assemble(plan DocumentPlan, settings assembleSettings) ([]byte, []*TemplateMismatchError, error) {
+	asm, err := e.newAssembly()
+	if err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
+	}
+
+	// Process each component in the plan, collecting the mismatches of all of
+	// them so a strict render reports every finding at once
+	var mismatches []*TemplateMismatchError
+	for index, componentInstance := range plan.Body {
+		report, err := asm.addComponent(componentInstance)
+		if err != nil {
+			return nil, nil, NewDocGenError("assembly", fmt.Errorf("failed to add component %s: %w", componentInstance.Component, err))
+		}
+
+		if len(report.unresolved) == 0 && len(report.unused) == 0 {
+			continue
 		}
+		mismatches = append(mismatches, &TemplateMismatchError{
+			Component:  componentInstance.Component,
+			Index:      index,
+			Unresolved: report.unresolved,
+			Unused:     report.unused,
+		})
+	}
+	if settings.strict && len(mismatches) > 0 {
+		return nil, nil, NewDocGenError("assembly", &StrictRenderError{Mismatches: mismatches})
+	}
+
+	// Remove slot placeholders now that they have been filled
+	for _, s := range asm.slots {
+		s.close()
+	}
+
+	// Repeated components carry the same IDs; make them unique document-wide
+	asm.uniquifyIDs()
+
+	// Replace the shell's metadata with the plan's document properties
+	if err := asm.writeDocProps(plan.DocProps); err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
+	}
+
+	// Write the props to the custom XML part bound content controls show
+	if err := asm.writeCustomXMLProps(plan); err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
+	}
+
+	// Give the sections started by Section components their page setup
+	if err := asm.finishSections(); err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
+	}
+
+	// Bookmark the headings and list them in the tables of contents
+	if err := asm.finishTableOfContents(); err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
+	}
+
+	// Add the plan's header and footer to every section
+	if err := asm.writeHeadersAndFooters(plan, settings); err != nil {
+		return nil, nil, NewDocGenError("assembly", err)
 	}
 
 	// Serialize the modified document back to bytes
-	doc.Indent(2)
-	modifiedXML, err := doc.WriteToBytes()
+	asm.doc.Indent(2)
+	modifiedXML, err := asm.doc.WriteToBytes()
 	if err != nil {
-		return nil, NewDocGenError("assembly", fmt.Errorf("failed to serialize modified document.xml: %w", err))
+		return nil, nil, NewDocGenError("assembly", fmt.Errorf("failed to serialize modified document.xml: %w", err))
 	}
 
 	// Update the document.xml in our working copy
-	workingDoc["word/document.xml"] = modifiedXML
+	asm.docx["word/document.xml"] = modifiedXML
 
 	// Convert back to DOCX bytes
-	result, err := workingDoc.ToBytes()
+	result, err := asm.docx.ToBytes()
 	if err != nil {
-		return nil, NewDocGenError("assembly", fmt.Errorf("failed to create final DOCX: %w", err))
+		return nil, nil, NewDocGenError("assembly", fmt.Errorf("failed to create final DOCX: %w", err))
 	}
 
-	return result, nil
+	return result, mismatches, nil
 }
 
-// addComponentToBody adds a rendered component to the document body
-func (e *Engine) addComponentToBody(body *etree.Element, componentInstance ComponentInstance) error {
-	// Get the component template
-	template, err := e.GetComponent(componentInstance.Component)
+// addComponent renders a component and inserts it at its target slot
+func (a *assembly) addComponent(componentInstance ComponentInstance) (*templateReport, error) {
+	slotName := componentInstance.Slot
+	if slotName == "" {
+		slotName = DefaultSlot
+	}
+	target, exists := a.slots[slotName]
+	if !exists {
+		return nil, &SlotNotFoundError{SlotName: slotName}
+	}
+
+	// Select the version of the component the instance pins, or the latest
+	component, err := a.engine.resolveComponent(componentInstance.Component)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Render the component with props
-	renderedXML, err := RenderComponent(template, componentInstance.Props)
+	// Tables and lists are built from their metadata rather than a template
+	if spec, exists := a.engine.specs[component]; exists {
+		elements, report, err := spec.build(a, componentInstance.Props)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build component: %w", err)
+		}
+		for _, element := range elements {
+			target.insert(element)
+		}
+		return report, nil
+	}
+
+	// Get a copy of the component template, wrapped in a temporary root to
+	// handle multiple top-level elements
+	tempRoot, err := a.engine.componentTree(component)
 	if err != nil {
-		return fmt.Errorf("failed to render component: %w", err)
+		return nil, err
 	}
 
-	// Parse the rendered component XML
-	componentDoc := etree.NewDocument()
+	// Directory components bring their styles, lists and relationships along
+	if err := a.importComponent(component, tempRoot); err != nil {
+		return nil, fmt.Errorf("failed to import component resources: %w", err)
+	}
 
-	// Wrap the component XML in a temporary root to handle multiple top-level elements
-	wrappedXML := fmt.Sprintf("<temp xmlns:w=\"http://schemas.openxmlformats.org/wordprocessingml/2006/main\" xmlns:mc=\"http://schemas.openxmlformats.org/markup-compatibility/2006\" xmlns:wp=\"http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing\" xmlns:wp14=\"http://schemas.microsoft.com/office/word/2010/wordprocessingDrawing\" xmlns:a=\"http://schemas.openxmlformats.org/drawingml/2006/main\" xmlns:wps=\"http://schemas.microsoft.com/office/word/2010/wordprocessingShape\" xmlns:a14=\"http://schemas.microsoft.com/office/drawing/2010/main\" xmlns:v=\"urn:schemas-microsoft-com:vml\" xmlns:w10=\"urn:schemas-microsoft-com:office:word\" xmlns:o=\"urn:schemas-microsoft-com:office:office\">%s</temp>", renderedXML)
+	// Render the component with props. Relationship and image placeholders
+	// and rich-text links create their package parts as they are resolved.
+	autoSizedImages := make(map[string]*embeddedImage)
+	ctx := templateContext{
+		funcs: map[string]templateFunc{
+			"rel":  a.relationshipPlaceholder,
+			"rId":  a.imagePlaceholder(autoSizedImages),
+			"prop": a.imageAltTextPlaceholder,
+		},
+		hyperlink:    a.hyperlink,
+		note:         a.addNote,
+		lockControls: componentInstance.LockControls,
+	}
+	report, err := renderTemplate(tempRoot, componentInstance.Props, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render component: %w", err)
+	}
 
-	if err := componentDoc.ReadFromString(wrappedXML); err != nil {
-		return fmt.Errorf("failed to parse rendered component XML: %w", err)
+	// Insert all children of the temporary root at the slot
+	a.applyImageSizes(tempRoot, autoSizedImages)
+	for _, child := range tempRoot.ChildElements() {
+		target.insert(child)
 	}
 
-	// Find the temporary root and add all its children to the body
-	tempRoot := componentDoc.Root()
-	if tempRoot != nil {
-		for _, child := range tempRoot.ChildElements() {
-			// Clone the element to avoid modifying the original
-			clonedChild := child.Copy()
-			body.AddChild(clonedChild)
+	return report, nil
+}
+
+// spanContext connects the rich text of metadata and built-in components to
+// the document
+func (a *assembly) spanContext() templateContext {
+	return templateContext{hyperlink: a.hyperlink, note: a.addNote}
+}
+
+// elementsInOrder returns the elements with any of the given tags under root
+// in document order, which FindElements does not promise
+func elementsInOrder(root *etree.Element, tags ...string) []*etree.Element {
+	var found []*etree.Element
+	var walk func(element *etree.Element)
+	walk = func(element *etree.Element) {
+		for _, child := range element.ChildElements() {
+			if slices.Contains(tags, child.FullTag()) {
+				found = append(found, child)
+			}
+			walk(child)
 		}
 	}
-
-	return nil
-}
\ No newline at end of file
+	walk(root)
+	return found
+}
@@ -0,0 +1,151 @@
+package docgen
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"testing"
+
+	"docgen-service/assets"
+)
+
+// The benchmarks track the cost of a request: run them with
+//
+//	go test -run '^$' -bench . -benchmem ./internal/docgen
+//
+// and compare allocs/op before and after changes to the assembly path.
+
+// benchmarkPlan returns the full integration plan with a table, a list, a
+// heading, a table of contents and an inline image added, so every kind of
+// component is rendered
+func benchmarkPlan(b testing.TB) DocumentPlan {
+	b.Helper()
+	plan := loadTestPlan(b, "full_integration_test.json")
+	logo, err := fs.ReadFile(assets.FS, "media/docgen_logo.png")
+	if err != nil {
+		b.Fatalf("Failed to read embedded media: %v", err)
+	}
+
+	plan.Body = append(plan.Body,
+		ComponentInstance{Component: "TOC", Props: map[string]interface{}{}},
+		ComponentInstance{Component: "Heading", Props: map[string]interface{}{"text": "Measurements", "level": 1}},
+		ComponentInstance{Component: "MeasurementTable", Props: map[string]interface{}{"rows": []interface{}{
+			map[string]interface{}{"parameter": "Transmission", "expected": "> 85%", "actual": "87.2%", "result": "PASS"},
+			map[string]interface{}{"parameter": "Haze", "expected": "< 2%", "actual": "1.4%", "result": "PASS"},
+			map[string]interface{}{"parameter": "Switching time", "expected": "< 500 ms", "actual": "620 ms", "result": "FAIL"},
+		}}},
+		ComponentInstance{Component: "BulletList", Props: map[string]interface{}{"items": []interface{}{
+			"Samples conditioned for 24 hours",
+			map[string]interface{}{"text": "Equipment", "items": []interface{}{"Spectrophotometer", "Haze meter"}},
+		}}},
+		ComponentInstance{Component: "ImageBlock", Props: map[string]interface{}{"image": map[string]interface{}{
+			"filename":       "docgen_logo.png",
+			"content_base64": base64.StdEncoding.EncodeToString(logo),
+			"alt_text":       "DocGen logo",
+		}}},
+	)
+	return plan
+}
+
+// planToMap converts a plan to the generic form plans are validated in
+func planToMap(b *testing.B, plan DocumentPlan) map[string]interface{} {
+	b.Helper()
+	data, err := json.Marshal(plan)
+	if err != nil {
+		b.Fatalf("Failed to encode plan: %v", err)
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		b.Fatalf("Failed to decode plan: %v", err)
+	}
+	return generic
+}
+
+func BenchmarkAssemble(b *testing.B) {
+	engine := setupTestEngine(b)
+	plan := benchmarkPlan(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.Assemble(plan); err != nil {
+			b.Fatalf("Failed to assemble document: %v", err)
+		}
+	}
+}
+
+func BenchmarkAssembleParallel(b *testing.B) {
+	engine := setupTestEngine(b)
+	plan := benchmarkPlan(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := engine.Assemble(plan); err != nil {
+				b.Errorf("Failed to assemble document: %v", err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkValidatePlan(b *testing.B) {
+	engine := setupTestEngine(b)
+	plan := planToMap(b, benchmarkPlan(b))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if result := engine.ValidatePlan(plan); !result.Valid {
+			b.Fatalf("Expected plan to be valid, got errors: %v", result.Errors)
+		}
+	}
+}
+
+func BenchmarkNewAssembly(b *testing.B) {
+	engine := setupTestEngine(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.newAssembly(); err != nil {
+			b.Fatalf("Failed to prepare assembly: %v", err)
+		}
+	}
+}
+
+func BenchmarkShellWorkingCopy(b *testing.B) {
+	engine := setupTestEngine(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.shell.workingCopy()
+	}
+}
+
+func BenchmarkComponentTree(b *testing.B) {
+	engine := setupTestEngine(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.componentTree("TestBlock"); err != nil {
+			b.Fatalf("Failed to copy component: %v", err)
+		}
+	}
+}
+
+func BenchmarkParseComponent(b *testing.B) {
+	engine := setupTestEngine(b)
+	template := engine.components["TestBlock"]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseComponent(template); err != nil {
+			b.Fatalf("Failed to parse component: %v", err)
+		}
+	}
+}
@@ -1,35 +1,61 @@
 package docgen
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
-	"html"
-	"io"
-	"os"
+	"io/fs"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/beevik/etree"
 )
 
-// LoadComponents loads all .component.xml files from the specified directory
+// LoadComponents loads the components in the specified directory: each
+// <Name>.component.xml file, and each <Name>/document.xml saved from Word
 func LoadComponents(componentsDir string) (map[string]string, error) {
+	return LoadComponentsFS(osFS{}, filepath.ToSlash(componentsDir))
+}
+
+// LoadComponentsFS loads the components in the directory componentsDir of fsys
+func LoadComponentsFS(fsys fs.FS, componentsDir string) (map[string]string, error) {
 	components := make(map[string]string)
 
-	err := filepath.Walk(componentsDir, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(fsys, componentsDir, func(filePath string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".component.xml") {
+		var componentName, content string
+		switch {
+		case entry.IsDir():
+			return nil
+		case strings.HasSuffix(entry.Name(), ".component.xml"):
 			// Extract component name from filename (remove .component.xml extension)
-			componentName := strings.TrimSuffix(info.Name(), ".component.xml")
-
-			content, err := readComponentFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to read component %s: %w", componentName, err)
-			}
+			componentName = strings.TrimSuffix(entry.Name(), ".component.xml")
+			content, err = readComponentFile(fsys, filePath)
+		case isComponentDocument(componentsDir, filePath):
+			// Directory components are named after their directory
+			componentName = path.Base(path.Dir(filePath))
+			content, err = readComponentDocument(fsys, filePath)
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read component %s: %w", componentName, err)
+		}
+		if _, exists := components[componentName]; exists {
+			return fmt.Errorf("component %s is defined more than once", componentName)
+		}
 
-			components[componentName] = content
+		// Undo the run fragmentation Word leaves in exported XML
+		content, err = normalizeComponent(content)
+		if err != nil {
+			return fmt.Errorf("failed to normalize component %s: %w", componentName, err)
 		}
 
+		components[componentName] = content
 		return nil
 	})
 
@@ -41,45 +67,111 @@ func LoadComponents(componentsDir string) (map[string]string, error) {
 }
 
 // readComponentFile reads the content of a component file
-func readComponentFile(path string) (string, error) {
-	file, err := os.Open(path)
+func readComponentFile(fsys fs.FS, filePath string) (string, error) {
+	content, err := fs.ReadFile(fsys, filePath)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return "", err
+	return string(content), nil
+}
+
+// parseComponent parses a component template, wrapped in a temporary root
+// that declares the namespaces components use
+func parseComponent(template string) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(fmt.Sprintf(componentWrapper, template)); err != nil {
+		return nil, fmt.Errorf("failed to parse component XML: %w", err)
 	}
+	return doc.Root(), nil
+}
 
-	return string(content), nil
+// parseComponents parses every component template once, so assemblies render
+// copies of the trees instead of parsing the templates again
+func parseComponents(components map[string]string) (map[string]*etree.Element, error) {
+	trees := make(map[string]*etree.Element, len(components))
+	for name, template := range components {
+		tree, err := parseComponent(template)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		trees[name] = tree
+	}
+	return trees, nil
 }
 
-// RenderComponent renders a component template with the given props
-func RenderComponent(template string, props map[string]interface{}) (string, error) {
-	if len(props) == 0 {
-		return template, nil
+// componentTree returns a copy of a loaded component's template, wrapped in a
+// temporary root, for an assembly to render
+func (e *Engine) componentTree(name string) (*etree.Element, error) {
+	// The parsed trees are shared by every assembly and never modified
+	if tree, exists := e.trees[name]; exists {
+		return tree.Copy(), nil
+	}
+	template, exists := e.components[name]
+	if !exists {
+		return nil, &ComponentNotFoundError{ComponentName: name}
+	}
+	return parseComponent(template)
+}
+
+// RenderComponent renders a component template with the given props and
+// returns the resulting XML fragment. With Strict(true), unresolved
+// placeholders or unused props fail the render with a *TemplateMismatchError;
+// otherwise they are returned as a warning.
+func RenderComponent(template string, props map[string]interface{}, opts ...AssembleOption) (string, *TemplateMismatchError, error) {
+	var settings assembleSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(fmt.Sprintf(componentWrapper, template)); err != nil {
+		return "", nil, fmt.Errorf("failed to parse component template: %w", err)
 	}
 
-	// Build replacement pairs for strings.NewReplacer
-	var replacements []string
-	for key, value := range props {
-		placeholder := fmt.Sprintf("{{ %s }}", key)
-		// Convert value to string and XML-escape it
-		valueStr := fmt.Sprintf("%v", value)
-		escapedValue := html.EscapeString(valueStr)
+	root := doc.Root()
+	report, err := renderTemplate(root, props, templateContext{})
+	if err != nil {
+		return "", nil, err
+	}
 
-		replacements = append(replacements, placeholder, escapedValue)
+	var warning *TemplateMismatchError
+	if len(report.unresolved) > 0 || len(report.unused) > 0 {
+		warning = &TemplateMismatchError{Unresolved: report.unresolved, Unused: report.unused}
+		if settings.strict {
+			return "", nil, warning
+		}
 	}
 
-	replacer := strings.NewReplacer(replacements...)
-	return replacer.Replace(template), nil
+	fragment, err := writeFragment(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	return fragment, warning, nil
 }
 
-// GetComponent retrieves a component template by name
+// writeFragment serializes the content of a wrapped component document
+// without the temporary root element
+func writeFragment(doc *etree.Document) (string, error) {
+	var fragment bytes.Buffer
+	writer := bufio.NewWriter(&fragment)
+	for _, token := range doc.Root().Child {
+		token.WriteTo(writer, &doc.WriteSettings)
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	return fragment.String(), nil
+}
+
+// GetComponent retrieves a component template by name, pinned to a version
+// as TestBlock@2 or the latest version
 func (e *Engine) GetComponent(componentName string) (string, error) {
-	template, exists := e.components[componentName]
+	key, err := e.resolveComponent(componentName)
+	if err != nil {
+		return "", err
+	}
+	template, exists := e.components[key]
 	if !exists {
 		return "", &ComponentNotFoundError{ComponentName: componentName}
 	}
@@ -0,0 +1,440 @@
+package docgen
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// A component may be a directory holding the parts of a Word document saved
+// from the component's source document:
+//
+//	<Name>/document.xml                 the component content (required)
+//	<Name>/styles.xml                   styles the content uses
+//	<Name>/numbering.xml                lists the content uses
+//	<Name>/_rels/document.xml.rels      hyperlinks and pictures
+//	<Name>/media/...                    the pictures' files
+//
+// The body of document.xml, without its final section properties, becomes the
+// component template. When a document uses the component, the styles and
+// lists it references that the shell lacks are copied into the document, and
+// its hyperlinks and pictures get relationships of their own.
+
+// componentDocumentPart is the file that makes a directory a component
+const componentDocumentPart = "document.xml"
+
+// componentResources are the parts a directory component brings along
+type componentResources struct {
+	// styles holds the component's style definitions by style ID
+	styles map[string]*etree.Element
+	// numbering is the component's numbering part, if it has one
+	numbering *etree.Element
+	// relationships holds the relationships the template references, by ID
+	relationships map[string]componentRelationship
+}
+
+// componentRelationship is a relationship of a directory component
+type componentRelationship struct {
+	Relationship
+	// media holds the target's bytes for pictures stored in the component
+	media []byte
+}
+
+// isComponentDocument reports whether path is the document.xml of a component
+// directory directly inside componentsDir
+func isComponentDocument(componentsDir, filePath string) bool {
+	return path.Base(filePath) == componentDocumentPart &&
+		path.Dir(path.Dir(filePath)) == path.Clean(componentsDir)
+}
+
+// readComponentDocument returns the body content of a component's
+// document.xml without its final section properties
+func readComponentDocument(fsys fs.FS, filePath string) (string, error) {
+	content, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return "", err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", componentDocumentPart, err)
+	}
+	body := doc.FindElement("/w:document/w:body")
+	if body == nil {
+		return "", fmt.Errorf("%s has no w:body", componentDocumentPart)
+	}
+	children := body.ChildElements()
+	if n := len(children); n > 0 && children[n-1].FullTag() == "w:sectPr" {
+		body.RemoveChild(children[n-1])
+	}
+
+	fragment := etree.NewDocument()
+	fragment.SetRoot(body)
+	return writeFragment(fragment)
+}
+
+// LoadComponentResources loads the styles, numbering and relationships of the
+// directory components in componentsDir, keyed by component name. Components
+// that need none of them are left out.
+func LoadComponentResources(componentsDir string, components map[string]string) (map[string]*componentResources, error) {
+	return LoadComponentResourcesFS(osFS{}, filepath.ToSlash(componentsDir), components)
+}
+
+// LoadComponentResourcesFS loads the styles, numbering and relationships of
+// the directory components in the directory componentsDir of fsys
+func LoadComponentResourcesFS(fsys fs.FS, componentsDir string, components map[string]string) (map[string]*componentResources, error) {
+	resources := make(map[string]*componentResources)
+
+	entries, err := fs.ReadDir(fsys, componentsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components from %s: %w", componentsDir, err)
+	}
+	for _, entry := range entries {
+		dir := path.Join(componentsDir, entry.Name())
+		if _, err := fs.Stat(fsys, path.Join(dir, componentDocumentPart)); !entry.IsDir() || err != nil {
+			continue
+		}
+
+		res, err := loadComponentResources(fsys, dir, components[entry.Name()])
+		if err != nil {
+			return nil, fmt.Errorf("invalid component %s: %w", entry.Name(), err)
+		}
+		if res != nil {
+			resources[entry.Name()] = res
+		}
+	}
+	return resources, nil
+}
+
+// loadComponentResources reads the optional parts of a component directory
+func loadComponentResources(fsys fs.FS, dir, template string) (*componentResources, error) {
+	res := &componentResources{
+		styles:        make(map[string]*etree.Element),
+		relationships: make(map[string]componentRelationship),
+	}
+	found := false
+
+	readPart := func(name string) (*etree.Element, error) {
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		doc := etree.NewDocument()
+		if err == nil {
+			err = doc.ReadFromBytes(content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		found = true
+		return doc.Root(), nil
+	}
+
+	styles, err := readPart("styles.xml")
+	if err != nil {
+		return nil, err
+	}
+	if styles != nil {
+		for _, style := range styles.SelectElements("w:style") {
+			res.styles[style.SelectAttrValue("w:styleId", "")] = style
+		}
+	}
+
+	if res.numbering, err = readPart("numbering.xml"); err != nil {
+		return nil, err
+	}
+
+	rels, err := readPart("_rels/document.xml.rels")
+	if err != nil {
+		return nil, err
+	}
+	referenced := referencedRelationships(template)
+	if rels != nil {
+		for _, element := range rels.SelectElements("Relationship") {
+			rel := componentRelationship{Relationship: Relationship{
+				ID:         element.SelectAttrValue("Id", ""),
+				Type:       element.SelectAttrValue("Type", ""),
+				Target:     element.SelectAttrValue("Target", ""),
+				TargetMode: element.SelectAttrValue("TargetMode", ""),
+			}}
+			if !referenced[rel.ID] {
+				continue
+			}
+
+			switch {
+			case rel.TargetMode == TargetModeExternal && (rel.Type == RelTypeHyperlink || rel.Type == RelTypeImage):
+			case rel.Type == RelTypeImage:
+				extension := strings.TrimPrefix(strings.ToLower(path.Ext(rel.Target)), ".")
+				if _, ok := imageContentTypes[extension]; !ok {
+					return nil, fmt.Errorf("relationship %s: unsupported image format %q", rel.ID, extension)
+				}
+				if !filepath.IsLocal(filepath.FromSlash(rel.Target)) {
+					return nil, fmt.Errorf("relationship %s: target %q is outside the component", rel.ID, rel.Target)
+				}
+				if rel.media, err = fs.ReadFile(fsys, path.Join(dir, rel.Target)); err != nil {
+					return nil, fmt.Errorf("relationship %s: %w", rel.ID, err)
+				}
+			default:
+				return nil, fmt.Errorf("relationship %s of type %s is not supported in components", rel.ID, rel.Type)
+			}
+			res.relationships[rel.ID] = rel
+			delete(referenced, rel.ID)
+		}
+	}
+	if len(referenced) > 0 {
+		missing := make([]string, 0, len(referenced))
+		for id := range referenced {
+			missing = append(missing, id)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("relationships %s are referenced but not defined", strings.Join(missing, ", "))
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return res, nil
+}
+
+// referencedRelationships returns the relationship IDs a template references
+// in r: attributes, leaving out placeholders the engine resolves
+func referencedRelationships(template string) map[string]bool {
+	referenced := make(map[string]bool)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(fmt.Sprintf(componentWrapper, template)); err != nil {
+		return referenced
+	}
+	for _, element := range doc.FindElements("//*") {
+		for _, attr := range element.Attr {
+			if attr.Space == "r" && !placeholderPattern.MatchString(attr.Value) {
+				referenced[attr.Value] = true
+			}
+		}
+	}
+	return referenced
+}
+
+// importedComponent records how a directory component's resources were added
+// to the document being assembled
+type importedComponent struct {
+	// relationshipIDs maps the component's relationship IDs to the document's
+	relationshipIDs map[string]string
+	// numIDs maps the component's list numbering IDs to the document's
+	numIDs map[string]string
+}
+
+// importComponent adds the resources of a directory component to the document
+// the first time the component is used, and points the references in a parsed
+// instance of the component at them
+func (a *assembly) importComponent(name string, root *etree.Element) error {
+	res, exists := a.engine.resources[name]
+	if !exists {
+		return nil
+	}
+
+	imported, done := a.importedComponents[name]
+	if !done {
+		var err error
+		if imported, err = a.addComponentResources(res, root); err != nil {
+			return err
+		}
+		a.importedComponents[name] = imported
+	}
+
+	for _, element := range root.FindElements(".//*") {
+		for i, attr := range element.Attr {
+			switch {
+			case attr.Space == "r":
+				if id, exists := imported.relationshipIDs[attr.Value]; exists {
+					element.Attr[i].Value = id
+				}
+			case element.FullTag() == "w:numId" && attr.FullKey() == "w:val":
+				if id, exists := imported.numIDs[attr.Value]; exists {
+					element.Attr[i].Value = id
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addComponentResources copies the lists, styles and relationships a
+// component uses into the document
+func (a *assembly) addComponentResources(res *componentResources, root *etree.Element) (*importedComponent, error) {
+	imported := &importedComponent{relationshipIDs: make(map[string]string), numIDs: make(map[string]string)}
+
+	// Styles the shell already defines keep the shell's formatting
+	styles := a.missingComponentStyles(res, root)
+
+	numIDs := make(map[string]bool)
+	for _, element := range root.FindElements(".//w:numId") {
+		numIDs[element.SelectAttrValue("w:val", "")] = true
+	}
+	for _, style := range styles {
+		for _, element := range style.FindElements(".//w:numId") {
+			numIDs[element.SelectAttrValue("w:val", "")] = true
+		}
+	}
+	delete(numIDs, "0")
+	if len(numIDs) > 0 && res.numbering != nil {
+		if err := a.importNumbering(res.numbering, numIDs, imported.numIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(styles) > 0 {
+		err := a.docx.updatePart(stylesPart, func(stylesRoot *etree.Element) error {
+			for _, style := range styles {
+				for _, element := range style.FindElements(".//w:numId") {
+					if id, exists := imported.numIDs[element.SelectAttrValue("w:val", "")]; exists {
+						element.CreateAttr("w:val", id)
+					}
+				}
+				stylesRoot.AddChild(style)
+				a.styleIDs[style.SelectAttrValue("w:styleId", "")] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(res.relationships))
+	for id := range res.relationships {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rel := res.relationships[id]
+		var newID string
+		var err error
+		if rel.media == nil {
+			newID, err = a.externalRelationship(rel.Type, rel.Target)
+		} else {
+			var embedded *embeddedImage
+			embedded, err = a.embedImage(&imageProp{
+				filename:  path.Base(rel.Target),
+				extension: strings.TrimPrefix(strings.ToLower(path.Ext(rel.Target)), "."),
+				data:      rel.media,
+			})
+			if embedded != nil {
+				newID = embedded.relID
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("relationship %s: %w", id, err)
+		}
+		imported.relationshipIDs[id] = newID
+	}
+
+	return imported, nil
+}
+
+// missingComponentStyles returns copies of the component styles a template
+// uses, directly or through basedOn, link and next, that the shell lacks
+func (a *assembly) missingComponentStyles(res *componentResources, root *etree.Element) []*etree.Element {
+	var pending []string
+	for _, element := range root.FindElements(".//*") {
+		switch element.FullTag() {
+		case "w:pStyle", "w:rStyle", "w:tblStyle":
+			pending = append(pending, element.SelectAttrValue("w:val", ""))
+		}
+	}
+
+	var styles []*etree.Element
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+		style, exists := res.styles[id]
+		if seen[id] || !exists || a.styleDefined(id) {
+			continue
+		}
+		seen[id] = true
+
+		styles = append(styles, style.Copy())
+		for _, tag := range []string{"w:basedOn", "w:link", "w:next"} {
+			if element := style.SelectElement(tag); element != nil {
+				pending = append(pending, element.SelectAttrValue("w:val", ""))
+			}
+		}
+	}
+	return styles
+}
+
+// importNumbering copies the component lists with the given numbering IDs,
+// and their abstract definitions, into the document's numbering part under
+// new IDs, recording the new numbering IDs in numIDs
+func (a *assembly) importNumbering(numbering *etree.Element, used map[string]bool, numIDs map[string]string) error {
+	if _, exists := a.docx[numberingPart]; !exists {
+		return fmt.Errorf("component lists require %s in the shell document", numberingPart)
+	}
+
+	return a.docx.updatePart(numberingPart, func(root *etree.Element) error {
+		highestAbstract, highestNum := -1, 0
+		var lastAbstract *etree.Element
+		for _, abstract := range root.SelectElements("w:abstractNum") {
+			if n, err := strconv.Atoi(abstract.SelectAttrValue("w:abstractNumId", "")); err == nil && n > highestAbstract {
+				highestAbstract = n
+			}
+			lastAbstract = abstract
+		}
+		for _, num := range root.SelectElements("w:num") {
+			if n, err := strconv.Atoi(num.SelectAttrValue("w:numId", "")); err == nil && n > highestNum {
+				highestNum = n
+			}
+		}
+
+		abstractIDs := make(map[string]string)
+		for _, num := range numbering.SelectElements("w:num") {
+			oldID := num.SelectAttrValue("w:numId", "")
+			if !used[oldID] {
+				continue
+			}
+			abstractRef := num.SelectElement("w:abstractNumId")
+			if abstractRef == nil {
+				return fmt.Errorf("component list %s has no abstract numbering", oldID)
+			}
+			oldAbstractID := abstractRef.SelectAttrValue("w:val", "")
+
+			newAbstractID, exists := abstractIDs[oldAbstractID]
+			if !exists {
+				abstract := numbering.FindElement(fmt.Sprintf("w:abstractNum[@w:abstractNumId='%s']", oldAbstractID))
+				if abstract == nil {
+					return fmt.Errorf("component abstract numbering %s is not defined", oldAbstractID)
+				}
+				highestAbstract++
+				newAbstractID = strconv.Itoa(highestAbstract)
+				abstractIDs[oldAbstractID] = newAbstractID
+
+				// Abstract definitions precede every w:num
+				copied := abstract.Copy()
+				copied.CreateAttr("w:abstractNumId", newAbstractID)
+				switch first := root.SelectElement("w:num"); {
+				case lastAbstract != nil:
+					root.InsertChildAt(lastAbstract.Index()+1, copied)
+				case first != nil:
+					root.InsertChild(first, copied)
+				default:
+					root.AddChild(copied)
+				}
+				lastAbstract = copied
+			}
+
+			highestNum++
+			copied := num.Copy()
+			copied.CreateAttr("w:numId", strconv.Itoa(highestNum))
+			copied.SelectElement("w:abstractNumId").CreateAttr("w:val", newAbstractID)
+			insertNumberingInstance(root, copied)
+			numIDs[oldID] = strconv.Itoa(highestNum)
+		}
+		return nil
+	})
+}
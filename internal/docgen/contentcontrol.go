@@ -0,0 +1,240 @@
+package docgen
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Content controls (w:sdt) built in Word's Developer tab are filled from the
+// prop their tag names, or their title (w:alias) when the tag is empty. Titles
+// and tags written as words name the prop in lowercase with underscores, as
+// extraction does, so a control titled "Tester Name" is filled from
+// tester_name. The content becomes the prop's value in the formatting of the
+// control's first run:
+//
+//   - a plain text control (w:text) holds the value's text; unless it allows
+//     several lines, line breaks become spaces
+//   - a rich text control holds rich text as runs, links and notes
+//   - a control around paragraphs or a table cell keeps only its first
+//     paragraph for the value
+//
+// Controls bound to document properties (w:dataBinding) and pictures, building
+// blocks and other special controls are left alone. A control whose tag names
+// a missing prop is reported as unresolved.
+//
+// Once its content has been filled, by binding or by placeholders inside it,
+// a control no longer shows its placeholder text, and when the component asks
+// for it, it is locked against editing.
+
+// sdtPropertyOrder is the sequence the schema requires for the children of
+// w:sdtPr, up to the element that sets the control's type
+var sdtPropertyOrder = []string{
+	"w:rPr", "w:alias", "w:tag", "w:id", "w:lock", "w:placeholder", "w:temporary",
+	"w:showingPlcHdr", "w:dataBinding", "w:label", "w:tabIndex", "w:docPartObj",
+}
+
+// placeholderTextStyle is the character style of a content control's placeholder text
+const placeholderTextStyle = "PlaceholderText"
+
+// unboundControlTypes are the sdtPr children of controls that never hold a prop's text
+var unboundControlTypes = []string{
+	"w:dataBinding", "w:picture", "w:docPartObj", "w:docPartList", "w:group",
+	"w:citation", "w:bibliography", "w:equation", "w14:checkbox",
+}
+
+// contentControlProp returns the prop a content control is filled from and
+// whether the name comes from its tag
+func contentControlProp(sdt *etree.Element) (string, bool, bool) {
+	sdtPr := sdt.SelectElement("w:sdtPr")
+	if sdtPr == nil {
+		return "", false, false
+	}
+	for _, tag := range unboundControlTypes {
+		if sdtPr.SelectElement(tag) != nil {
+			return "", false, false
+		}
+	}
+
+	name, fromTag := contentControlTag(sdt), true
+	if name == "" {
+		if alias := sdtPr.SelectElement("w:alias"); alias != nil {
+			name, fromTag = alias.SelectAttrValue("w:val", ""), false
+		}
+	}
+	if !propPathPattern.MatchString(name) {
+		name = propName(name)
+	}
+	if name == "" {
+		return "", false, false
+	}
+	return name, fromTag, true
+}
+
+// renderContentControl renders a content control, filling it from its prop
+// when it has one
+func (r *templateRenderer) renderContentControl(sdt *etree.Element, scope *templateScope) error {
+	content := sdt.SelectElement("w:sdtContent")
+	if content == nil {
+		return r.render(sdt, scope)
+	}
+
+	name, fromTag, bindable := contentControlProp(sdt)
+	var value interface{}
+	if bindable {
+		value, _ = scope.lookup(name)
+	}
+	if value == nil {
+		// Controls whose text holds placeholders are filled by those
+		hasPlaceholders := placeholderPattern.MatchString(paragraphText(content))
+		if err := r.render(sdt, scope); err != nil {
+			return err
+		}
+		switch {
+		case hasPlaceholders:
+			r.markFilled(sdt)
+		case bindable && fromTag:
+			r.addUnresolved("{{ " + name + " }}")
+		}
+		return nil
+	}
+
+	var runs []*etree.Element
+	var err error
+	rPr := controlRunProperties(sdt)
+	if sdt.FindElement("w:sdtPr/w:text") != nil {
+		runs, err = r.spanElements([]textSpan{{Text: controlText(sdt, formatValue(value))}}, rPr, false)
+	} else {
+		runs, err = r.valueRuns(value, rPr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !setControlContent(content, runs) {
+		// Rows and tables cannot hold a single value
+		return r.render(sdt, scope)
+	}
+	r.markFilled(sdt)
+	return nil
+}
+
+// controlRunProperties returns the formatting a content control's value
+// takes: that of the control's first run, without the grey placeholder text
+// style a control showing its placeholder gives it
+func controlRunProperties(sdt *etree.Element) *etree.Element {
+	rPr := sdt.FindElement("w:sdtPr/w:rPr")
+	if run := sdt.FindElement("w:sdtContent//w:r"); run != nil && run.SelectElement("w:rPr") != nil {
+		rPr = run.SelectElement("w:rPr")
+	}
+	if rPr == nil || rPr.FindElement("w:rStyle[@w:val='"+placeholderTextStyle+"']") == nil {
+		return rPr
+	}
+
+	rPr = rPr.Copy()
+	rPr.RemoveChild(rPr.SelectElement("w:rStyle"))
+	if len(rPr.ChildElements()) == 0 {
+		return nil
+	}
+	return rPr
+}
+
+// controlText returns the text a plain text content control holds for a
+// value: unless the control allows several lines, line breaks become spaces
+func controlText(sdt *etree.Element, text string) string {
+	textPr := sdt.FindElement("w:sdtPr/w:text")
+	if textPr == nil {
+		return text
+	}
+	switch textPr.SelectAttrValue("w:multiLine", "") {
+	case "1", "true", "on":
+		return text
+	}
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+}
+
+// setControlContent replaces the content of a content control with runs. A
+// control around paragraphs or a cell keeps its first paragraph for them. It
+// reports false, changing nothing, for controls around rows or tables.
+func setControlContent(content *etree.Element, runs []*etree.Element) bool {
+	children := content.ChildElements()
+	switch first := firstOrNil(children); {
+	case first != nil && first.FullTag() == "w:p":
+		fillParagraph(first, runs)
+		removeAllBut(content, first)
+	case first != nil && first.FullTag() == "w:tc":
+		paragraph := first.SelectElement("w:p")
+		if paragraph == nil {
+			paragraph = first.CreateElement("w:p")
+		}
+		for _, p := range first.SelectElements("w:p") {
+			if p != paragraph {
+				first.RemoveChild(p)
+			}
+		}
+		fillParagraph(paragraph, runs)
+		removeAllBut(content, first)
+	case first != nil && (first.FullTag() == "w:tr" || first.FullTag() == "w:tbl"):
+		return false
+	default:
+		for _, child := range children {
+			content.RemoveChild(child)
+		}
+		for _, run := range runs {
+			content.AddChild(run)
+		}
+	}
+	return true
+}
+
+// markFilled stops a filled content control from showing its placeholder
+// text and locks it if the component asks for that
+func (r *templateRenderer) markFilled(sdt *etree.Element) {
+	sdtPr := sdt.SelectElement("w:sdtPr")
+	if sdtPr == nil {
+		return
+	}
+	hidePlaceholderText(sdtPr)
+	if r.lockControls {
+		lock := etree.NewElement("w:lock")
+		lock.CreateAttr("w:val", "sdtContentLocked")
+		setOrderedChild(sdtPr, lock, sdtPropertyOrder)
+	}
+}
+
+// hidePlaceholderText stops a content control from showing its content as
+// placeholder text
+func hidePlaceholderText(sdtPr *etree.Element) {
+	if showing := sdtPr.SelectElement("w:showingPlcHdr"); showing != nil {
+		sdtPr.RemoveChild(showing)
+	}
+}
+
+// fillParagraph replaces the content of a paragraph with runs
+func fillParagraph(p *etree.Element, runs []*etree.Element) {
+	for _, child := range p.ChildElements() {
+		if child.FullTag() != "w:pPr" {
+			p.RemoveChild(child)
+		}
+	}
+	for _, run := range runs {
+		p.AddChild(run)
+	}
+}
+
+// removeAllBut removes the child elements of parent other than keep
+func removeAllBut(parent, keep *etree.Element) {
+	for _, child := range parent.ChildElements() {
+		if child != keep {
+			parent.RemoveChild(child)
+		}
+	}
+}
+
+// firstOrNil returns the first element of a list, or nil if it is empty
+func firstOrNil(elements []*etree.Element) *etree.Element {
+	if len(elements) == 0 {
+		return nil
+	}
+	return elements[0]
+}
@@ -0,0 +1,84 @@
+package docgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const contentTypesPart = "[Content_Types].xml"
+
+// AddDefaultContentType registers the content type for a file extension in
+// [Content_Types].xml unless the extension already has one
+func (shell InMemoryDocx) AddDefaultContentType(extension, contentType string) error {
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+
+	return shell.updateContentTypes(func(root *etree.Element) bool {
+		for _, def := range root.SelectElements("Default") {
+			if strings.EqualFold(def.SelectAttrValue("Extension", ""), extension) {
+				return false
+			}
+		}
+
+		def := etree.NewElement("Default")
+		def.CreateAttr("Extension", extension)
+		def.CreateAttr("ContentType", contentType)
+
+		// Defaults precede Overrides by convention
+		if firstOverride := root.SelectElement("Override"); firstOverride != nil {
+			root.InsertChild(firstOverride, def)
+		} else {
+			root.AddChild(def)
+		}
+		return true
+	})
+}
+
+// AddOverrideContentType registers the content type of a single package part
+// in [Content_Types].xml, replacing any override the part already has
+func (shell InMemoryDocx) AddOverrideContentType(part, contentType string) error {
+	partName := "/" + strings.TrimPrefix(part, "/")
+
+	return shell.updateContentTypes(func(root *etree.Element) bool {
+		for _, override := range root.SelectElements("Override") {
+			if strings.EqualFold(override.SelectAttrValue("PartName", ""), partName) {
+				root.RemoveChild(override)
+			}
+		}
+
+		override := root.CreateElement("Override")
+		override.CreateAttr("PartName", partName)
+		override.CreateAttr("ContentType", contentType)
+		return true
+	})
+}
+
+// updateContentTypes parses [Content_Types].xml, applies update and writes the
+// part back if update reports a change
+func (shell InMemoryDocx) updateContentTypes(update func(root *etree.Element) bool) error {
+	content, exists := shell[contentTypesPart]
+	if !exists {
+		return fmt.Errorf("%s not found in document", contentTypesPart)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", contentTypesPart, err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Types" {
+		return fmt.Errorf("%s has no Types root element", contentTypesPart)
+	}
+
+	if !update(root) {
+		return nil
+	}
+
+	updated, err := doc.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", contentTypesPart, err)
+	}
+	shell[contentTypesPart] = updated
+	return nil
+}
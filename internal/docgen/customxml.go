@@ -0,0 +1,330 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// The plan's props are written to a custom XML part DocGen owns, so content
+// controls bound to it (w:dataBinding) show the props and a value edited in
+// one bound control updates every control bound to the same element. The
+// part holds a props element in the DocGen namespace with one child per prop:
+//
+//	<props xmlns="urn:docgen-service:props">
+//	  <tester_name>Jane Engineer</tester_name>
+//	  <address><city>Springfield</city></address>
+//	</props>
+//
+// A prop used by several components takes the value of its first use. Objects
+// become nested elements, lists become item elements, and rich text its plain
+// text. Word binds a control to /ns0:props[1]/ns0:tester_name[1] with the
+// prefix mapping xmlns:ns0='urn:docgen-service:props'; controls mapping a
+// prefix to the namespace are bound to the part whatever store ID they name.
+
+const (
+	// docgenPropsNamespace is the namespace of the props custom XML part
+	docgenPropsNamespace = "urn:docgen-service:props"
+
+	// docgenPropsStoreItemID is the data store ID of the props custom XML part
+	docgenPropsStoreItemID = "{5E0D1C4B-7A3F-4B8E-9C21-D0C6E4A15B7F}"
+
+	customXMLNamespace             = "http://schemas.openxmlformats.org/officeDocument/2006/customXml"
+	customXMLPropertiesContentType = "application/vnd.openxmlformats-officedocument.customXmlProperties+xml"
+
+	// RelTypeCustomXML is the relationship type of a custom XML part
+	RelTypeCustomXML = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXml"
+	// RelTypeCustomXMLProps is the relationship type of a custom XML part's properties
+	RelTypeCustomXMLProps = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/customXmlProps"
+)
+
+var (
+	// customXMLItemPattern matches the custom XML parts of a package
+	customXMLItemPattern = regexp.MustCompile(`^customXml/item\d+\.xml$`)
+
+	// prefixMappingPattern extracts the prefixes of w:prefixMappings
+	prefixMappingPattern = regexp.MustCompile(`xmlns:(\w+)\s*=\s*['"]([^'"]*)['"]`)
+
+	// xpathStepPattern matches one step of a binding's XPath, such as ns0:tester_name[1]
+	xpathStepPattern = regexp.MustCompile(`^(?:(\w+):)?([A-Za-z_][\w.-]*)(?:\[(\d+)\])?$`)
+
+	// xmlNamePattern matches the prop names that can be written as elements
+	xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][\w.-]*$`)
+)
+
+// writeCustomXMLProps writes the plan's props to the DocGen custom XML part and
+// fills the content controls bound to it. Without doc_props.bound_props the
+// part is written only when the document has controls bound to it.
+func (a *assembly) writeCustomXMLProps(plan DocumentPlan) error {
+	bindings := a.docgenBindings()
+	if len(bindings) == 0 && len(plan.DocProps.BoundProps) == 0 {
+		return nil
+	}
+
+	part := etree.NewDocument()
+	part.CreateProcInst("xml", `version="1.0" encoding="UTF-8" standalone="yes"`)
+	root := part.CreateElement("props")
+	root.CreateAttr("xmlns", docgenPropsNamespace)
+	for _, prop := range boundPlanProps(plan) {
+		addPropElement(root, prop.name, prop.value)
+	}
+
+	for _, binding := range bindings {
+		fillBoundControl(binding, root)
+	}
+
+	content, err := part.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to serialize the props custom XML part: %w", err)
+	}
+	return a.addCustomXMLPart(docgenPropsStoreItemID, docgenPropsNamespace, content)
+}
+
+// planProp is a prop written to the props custom XML part
+type planProp struct {
+	name  string
+	value interface{}
+}
+
+// boundPlanProps lists the props written to the custom XML part: those named
+// by doc_props.bound_props, or every prop of the plan's components. A prop
+// takes its value from the first component that has it.
+func boundPlanProps(plan DocumentPlan) []planProp {
+	values := make(map[string]interface{})
+	var names []string
+	for _, instance := range plan.Body {
+		keys := make([]string, 0, len(instance.Props))
+		for name := range instance.Props {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		for _, name := range keys {
+			if _, exists := values[name]; !exists && xmlNamePattern.MatchString(name) {
+				values[name] = instance.Props[name]
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(plan.DocProps.BoundProps) > 0 {
+		// Props no component has are written empty, ready to be filled in Word
+		names = plan.DocProps.BoundProps
+	}
+	props := make([]planProp, 0, len(names))
+	for _, name := range names {
+		props = append(props, planProp{name, values[name]})
+	}
+	return props
+}
+
+// addPropElement adds the element holding a prop value to parent
+func addPropElement(parent *etree.Element, name string, value interface{}) {
+	element := parent.CreateElement(name)
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			// Embedded image data has no place in the data store
+			if key != "content_base64" && xmlNamePattern.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			addPropElement(element, key, v[key])
+		}
+	case []interface{}:
+		if spans, ok, err := richTextSpans(v); ok && err == nil {
+			element.SetText(spansText(spans))
+			return
+		}
+		for _, item := range v {
+			addPropElement(element, "item", item)
+		}
+	default:
+		element.SetText(formatValue(v))
+	}
+}
+
+// docgenBindings returns the data bindings of the content controls bound to
+// the props custom XML part, pointing those that only map a prefix to its
+// namespace at the part's store ID
+func (a *assembly) docgenBindings() []*etree.Element {
+	var bindings []*etree.Element
+	for _, binding := range a.body.FindElements(".//w:sdtPr/w:dataBinding") {
+		if !strings.EqualFold(binding.SelectAttrValue("w:storeItemID", ""), docgenPropsStoreItemID) {
+			if _, ok := docgenPrefixes(binding); !ok {
+				continue
+			}
+			binding.CreateAttr("w:storeItemID", docgenPropsStoreItemID)
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings
+}
+
+// docgenPrefixes returns the prefixes a data binding maps to the DocGen
+// namespace and whether there are any
+func docgenPrefixes(binding *etree.Element) (map[string]bool, bool) {
+	prefixes := make(map[string]bool)
+	for _, match := range prefixMappingPattern.FindAllStringSubmatch(binding.SelectAttrValue("w:prefixMappings", ""), -1) {
+		if match[2] == docgenPropsNamespace {
+			prefixes[match[1]] = true
+		}
+	}
+	return prefixes, len(prefixes) > 0
+}
+
+// boundElement finds the element of the props part a data binding's XPath
+// selects. Only paths of child steps in the DocGen namespace, such as
+// /ns0:props[1]/ns0:address[1]/ns0:city[1], are understood.
+func boundElement(binding *etree.Element, root *etree.Element) *etree.Element {
+	prefixes, _ := docgenPrefixes(binding)
+	xpath := binding.SelectAttrValue("w:xpath", "")
+	if !strings.HasPrefix(xpath, "/") {
+		return nil
+	}
+
+	var element *etree.Element
+	for _, step := range strings.Split(xpath[1:], "/") {
+		match := xpathStepPattern.FindStringSubmatch(step)
+		if match == nil || !prefixes[match[1]] {
+			return nil
+		}
+		position := 1
+		if match[3] != "" {
+			position, _ = strconv.Atoi(match[3])
+		}
+
+		var candidates []*etree.Element
+		if element == nil {
+			candidates = []*etree.Element{root}
+		} else {
+			candidates = element.ChildElements()
+		}
+		element = nil
+		for _, candidate := range candidates {
+			if candidate.Tag != match[2] {
+				continue
+			}
+			if position--; position == 0 {
+				element = candidate
+				break
+			}
+		}
+		if element == nil {
+			return nil
+		}
+	}
+	return element
+}
+
+// fillBoundControl sets the content of a bound content control to the text of
+// the element it is bound to, as Word does when it opens the document.
+// Controls bound to missing, empty or structured elements keep their content.
+func fillBoundControl(binding *etree.Element, root *etree.Element) {
+	element := boundElement(binding, root)
+	if element == nil || len(element.ChildElements()) > 0 || element.Text() == "" {
+		return
+	}
+	sdtPr := binding.Parent()
+	sdt := sdtPr.Parent()
+	content := sdt.SelectElement("w:sdtContent")
+	if content == nil {
+		return
+	}
+
+	run := newRun(controlRunProperties(sdt))
+	addSpanText(run, controlText(sdt, element.Text()))
+	if setControlContent(content, []*etree.Element{run}) {
+		hidePlaceholderText(sdtPr)
+	}
+}
+
+// addCustomXMLPart writes a custom XML part with the given store ID, replacing
+// the content of the part that already has it
+func (a *assembly) addCustomXMLPart(storeItemID, schema string, content []byte) error {
+	existing, err := a.docx.customXMLPart(storeItemID)
+	if err != nil {
+		return err
+	}
+	if existing != "" {
+		a.docx[existing] = content
+		return nil
+	}
+
+	// Use the first free customXml/itemN.xml and customXml/itemPropsN.xml
+	var part, propsPart string
+	for n := 1; ; n++ {
+		part = fmt.Sprintf("customXml/item%d.xml", n)
+		propsPart = fmt.Sprintf("customXml/itemProps%d.xml", n)
+		_, partExists := a.docx[part]
+		_, propsExists := a.docx[propsPart]
+		if !partExists && !propsExists {
+			break
+		}
+	}
+
+	props := etree.NewDocument()
+	props.CreateProcInst("xml", `version="1.0" encoding="UTF-8" standalone="no"`)
+	item := props.CreateElement("ds:datastoreItem")
+	item.CreateAttr("ds:itemID", storeItemID)
+	item.CreateAttr("xmlns:ds", customXMLNamespace)
+	item.CreateElement("ds:schemaRefs").CreateElement("ds:schemaRef").CreateAttr("ds:uri", schema)
+	propsContent, err := props.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", propsPart, err)
+	}
+
+	a.docx[part] = content
+	a.docx[propsPart] = propsContent
+	if err := a.docx.AddDefaultContentType("xml", "application/xml"); err != nil {
+		return err
+	}
+	if err := a.docx.AddOverrideContentType(propsPart, customXMLPropertiesContentType); err != nil {
+		return err
+	}
+	if _, err := a.docx.AddRelationship(part, Relationship{
+		Type:   RelTypeCustomXMLProps,
+		Target: strings.TrimPrefix(propsPart, "customXml/"),
+	}); err != nil {
+		return err
+	}
+	_, err = a.docx.AddRelationship("word/document.xml", Relationship{
+		Type:   RelTypeCustomXML,
+		Target: "../" + part,
+	})
+	return err
+}
+
+// customXMLPart returns the custom XML part whose properties give it a store
+// ID, or "" if the package has none
+func (shell InMemoryDocx) customXMLPart(storeItemID string) (string, error) {
+	for part := range shell {
+		if !customXMLItemPattern.MatchString(part) {
+			continue
+		}
+		rels, err := shell.Relationships(part)
+		if err != nil {
+			return "", err
+		}
+		for _, rel := range rels {
+			if rel.Type != RelTypeCustomXMLProps {
+				continue
+			}
+			props := etree.NewDocument()
+			if err := props.ReadFromBytes(shell["customXml/"+rel.Target]); err != nil {
+				continue
+			}
+			if props.Root() != nil && strings.EqualFold(props.Root().SelectAttrValue("ds:itemID", ""), storeItemID) {
+				return part, nil
+			}
+		}
+	}
+	return "", nil
+}
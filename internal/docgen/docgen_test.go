@@ -1,10 +1,29 @@
 package docgen
 
 import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+
+	"github.com/beevik/etree"
+
+	"docgen-service/assets"
 )
 
 func TestEngineInitialization(t *testing.T) {
@@ -49,7 +68,7 @@ func TestComponentRendering(t *testing.T) {
 		"place": "DocGen",
 	}
 
-	result, err := RenderComponent(template, props)
+	result, _, err := RenderComponent(template, props)
 	if err != nil {
 		t.Fatalf("Failed to render component: %v", err)
 	}
@@ -66,7 +85,7 @@ func TestComponentRenderingWithXMLEscaping(t *testing.T) {
 		"title": "Test & Demo <Example>",
 	}
 
-	result, err := RenderComponent(template, props)
+	result, _, err := RenderComponent(template, props)
 	if err != nil {
 		t.Fatalf("Failed to render component: %v", err)
 	}
@@ -106,16 +125,16 @@ func TestDocumentAssembly(t *testing.T) {
 		t.Fatalf("Failed to assemble document: %v", err)
 	}
 
-	if len(result) == 0 {
+	if len(result.Document) == 0 {
 		t.Fatal("Generated document is empty")
 	}
 
-	t.Logf("Generated document size: %d bytes", len(result))
+	t.Logf("Generated document size: %d bytes", len(result.Document))
 
 	// Write test output for manual verification
 	outputPath := "../../output/test_output.docx"
 	os.MkdirAll(filepath.Dir(outputPath), 0755)
-	if err := os.WriteFile(outputPath, result, 0644); err != nil {
+	if err := os.WriteFile(outputPath, result.Document, 0644); err != nil {
 		t.Logf("Warning: Could not write test output file: %v", err)
 	} else {
 		t.Logf("Test output written to: %s", outputPath)
@@ -152,11 +171,87 @@ func TestShellCloning(t *testing.T) {
 	if string(shell["test1.xml"]) == "modified" {
 		t.Error("Modifying clone affected original")
 	}
+
+	// Parts are deep copies, so changing one in place leaves the original intact
+	clone["test2.xml"][0] = 'X'
+	if string(shell["test2.xml"]) != "content2" {
+		t.Errorf("Modifying a cloned part in place affected original: %s", shell["test2.xml"])
+	}
+}
+
+func TestShellWorkingCopy(t *testing.T) {
+	shell := InMemoryDocx{
+		"test1.xml": []byte("content1"),
+		"test2.xml": []byte("content2"),
+	}
+
+	working := shell.workingCopy()
+
+	// Parts are shared until they are replaced
+	if &working["test1.xml"][0] != &shell["test1.xml"][0] {
+		t.Error("Expected the working copy to share unchanged parts")
+	}
+	working["test1.xml"] = []byte("modified")
+	working["test3.xml"] = []byte("added")
+	if string(shell["test1.xml"]) != "content1" || len(shell) != 2 {
+		t.Errorf("Replacing parts of the working copy affected original: %v", shell)
+	}
+}
+
+func TestConcurrentAssemblySharesParsedTrees(t *testing.T) {
+	engine := setupTestEngine(t)
+	plan := benchmarkPlan(t)
+
+	serialize := func(element *etree.Element) string {
+		doc := etree.NewDocument()
+		doc.SetRoot(element.Copy())
+		content, err := doc.WriteToString()
+		if err != nil {
+			t.Fatalf("Failed to serialize tree: %v", err)
+		}
+		return content
+	}
+	document := serialize(engine.document.Root())
+	testBlock := serialize(engine.trees["TestBlock"])
+	styles := engine.shell["word/styles.xml"]
+
+	expected, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	hashes := make([]string, 8)
+	for i := range hashes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := engine.Assemble(plan)
+			if err != nil {
+				t.Errorf("Failed to assemble document: %v", err)
+				return
+			}
+			hashes[i] = result.SHA256
+		}(i)
+	}
+	wg.Wait()
+
+	for i, hash := range hashes {
+		if hash != expected.SHA256 {
+			t.Errorf("Assembly %d: expected hash %s, got %s", i, expected.SHA256, hash)
+		}
+	}
+	if serialize(engine.document.Root()) != document || serialize(engine.trees["TestBlock"]) != testBlock {
+		t.Error("Expected assembly to leave the parsed shell and components unchanged")
+	}
+	if !bytes.Equal(engine.shell["word/styles.xml"], styles) {
+		t.Error("Expected assembly to leave the shell's parts unchanged")
+	}
 }
 
 // setupTestEngine creates a test engine for use in unit tests
-func setupTestEngine(t *testing.T) *Engine {
-	engine, err := NewEngine("../../assets/shell/template_shell.docx", "../../assets/components/", "../../assets/schemas/rules.cue")
+func setupTestEngine(t testing.TB) *Engine {
+	engine, err := NewEngineFS(assets.FS, "shell/template_shell.docx", "components", "schemas/rules.cue")
 	if err != nil {
 		t.Fatalf("Failed to create test engine: %v", err)
 	}
@@ -327,14 +422,2281 @@ func TestAssembleComponents(t *testing.T) {
 				t.Fatalf("Failed to assemble document for %s: %v", tc.name, err)
 			}
 
-			if len(result) == 0 {
+			if len(result.Document) == 0 {
 				t.Fatalf("Generated document is empty for %s", tc.name)
 			}
 
-			t.Logf("%s: Generated document size: %d bytes", tc.name, len(result))
+			t.Logf("%s: Generated document size: %d bytes", tc.name, len(result.Document))
 
 			// Write test output for manual verification
-			writeTestOutput(t, tc.name, result)
+			writeTestOutput(t, tc.name, result.Document)
 		})
 	}
-}
\ No newline at end of file
+}
+
+// readDocxPart extracts a single part from generated DOCX bytes
+func readDocxPart(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open generated DOCX: %v", err)
+	}
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(content)
+	}
+	t.Fatalf("Part %s not found in generated DOCX", name)
+	return ""
+}
+
+const slotTestShell = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+	`<w:sdt><w:sdtPr><w:tag w:val="docgen:slot=cover"/></w:sdtPr><w:sdtContent><w:p><w:r><w:t>Cover placeholder</w:t></w:r></w:p></w:sdtContent></w:sdt>` +
+	`<w:p><w:r><w:t>Fixed layout</w:t></w:r></w:p>` +
+	`<w:p><w:bookmarkStart w:id="1" w:name="docgen_slot_appendix"/><w:bookmarkEnd w:id="1"/></w:p>` +
+	`<w:p><w:bookmarkStart w:id="0" w:name="_GoBack"/><w:bookmarkEnd w:id="0"/></w:p>` +
+	`<w:sectPr><w:pgSz w:w="12240" w:h="15840"/></w:sectPr></w:body></w:document>`
+
+func TestAssembleIntoSlots(t *testing.T) {
+	engine := &Engine{
+		shell: InMemoryDocx{"word/document.xml": []byte(slotTestShell)},
+		components: map[string]string{
+			"Para": `<w:p><w:r><w:t>{{ text }}</w:t></w:r></w:p>`,
+		},
+	}
+
+	plan := DocumentPlan{Body: []ComponentInstance{
+		{Component: "Para", Props: map[string]interface{}{"text": "Appendix A"}, Slot: "appendix"},
+		{Component: "Para", Props: map[string]interface{}{"text": "Cover 1"}, Slot: "cover"},
+		{Component: "Para", Props: map[string]interface{}{"text": "Body text"}},
+		{Component: "Para", Props: map[string]interface{}{"text": "Cover 2"}, Slot: "cover"},
+	}}
+
+	result, err := engine.AssembleDocument(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	documentXML := readDocxPart(t, result, "word/document.xml")
+
+	for _, removed := range []string{"Cover placeholder", "docgen:slot=cover", "docgen_slot_appendix", "_GoBack"} {
+		if strings.Contains(documentXML, removed) {
+			t.Errorf("Expected %q to be removed from the document", removed)
+		}
+	}
+
+	order := []string{"Cover 1", "Cover 2", "Fixed layout", "Appendix A", "Body text", "<w:sectPr>"}
+	last := -1
+	for _, text := range order {
+		index := strings.Index(documentXML, text)
+		if index < 0 {
+			t.Fatalf("Expected %q in document.xml", text)
+		}
+		if index < last {
+			t.Errorf("Expected %q to follow the previous slot content, document: %s", text, documentXML)
+		}
+		last = index
+	}
+}
+
+func TestAssembleUnknownSlot(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	_, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Title"}, Slot: "cover"},
+	}})
+
+	var slotErr *SlotNotFoundError
+	if !errors.As(err, &slotErr) || slotErr.SlotName != "cover" {
+		t.Fatalf("Expected SlotNotFoundError for slot cover, got %v", err)
+	}
+}
+
+func TestAddRelationshipAllocatesFreshID(t *testing.T) {
+	shell, err := LoadShell("../../assets/shell/template_shell.docx")
+	if err != nil {
+		t.Fatalf("Failed to load shell: %v", err)
+	}
+
+	id, err := shell.AddRelationship("word/document.xml", Relationship{
+		Type:       RelTypeHyperlink,
+		Target:     "https://example.com",
+		TargetMode: TargetModeExternal,
+	})
+	if err != nil {
+		t.Fatalf("Failed to add relationship: %v", err)
+	}
+	if id != "rId10" {
+		t.Errorf("Expected rId10 after the shell's rId1..rId9, got %s", id)
+	}
+
+	relationships, err := shell.Relationships("word/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to read relationships: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, rel := range relationships {
+		if seen[rel.ID] {
+			t.Errorf("Duplicate relationship ID %s", rel.ID)
+		}
+		seen[rel.ID] = true
+	}
+	if !seen["rId8"] || !seen[id] {
+		t.Errorf("Expected existing and new relationships, got %+v", relationships)
+	}
+
+	if _, err := shell.AddRelationship("word/document.xml", Relationship{ID: "rId8", Type: RelTypeHyperlink, Target: "x"}); err == nil {
+		t.Error("Expected an error when reusing an existing relationship ID")
+	}
+}
+
+func TestAuthorBlockHyperlinkRelationship(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{
+			Component: "AuthorBlock",
+			Props: map[string]interface{}{
+				"author_name":    "Ryan McCarty",
+				"company_name":   "Innoflight",
+				"address_line1":  "9985 Pacific Heights Blvd.",
+				"address_line2":  "Suite 250",
+				"city_state_zip": "San Diego, CA 92121",
+				"phone":          "(858) 638-1580",
+				"fax":            "(858) 638-1581",
+				"website":        "https://www.innoflight.com",
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+	relsXML := readDocxPart(t, result.Document, "word/_rels/document.xml.rels")
+
+	if strings.Contains(documentXML, `r:id="rId8"`) || strings.Contains(documentXML, "{{rel:") {
+		t.Errorf("Expected the hyperlink to use a freshly allocated relationship")
+	}
+	if !strings.Contains(documentXML, `r:id="rId10"`) {
+		t.Errorf("Expected hyperlink r:id rId10 in document.xml")
+	}
+	if !strings.Contains(relsXML, `Id="rId10" Type="`+RelTypeHyperlink+`" Target="https://www.innoflight.com" TargetMode="External"`) {
+		t.Errorf("Expected external hyperlink relationship, got %s", relsXML)
+	}
+}
+
+// testPNG encodes a solid PNG of the given pixel size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("Failed to encode test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssembleImageBlock(t *testing.T) {
+	engine := setupTestEngine(t)
+	content := base64.StdEncoding.EncodeToString(testPNG(t, 200, 100))
+
+	plan := DocumentPlan{Body: []ComponentInstance{
+		{
+			Component: "ImageBlock",
+			Props: map[string]interface{}{
+				"image": map[string]interface{}{
+					"filename":       "test setup.png",
+					"content_base64": content,
+					"alt_text":       "Test setup & fixtures",
+					"auto_size":      true,
+				},
+			},
+		},
+		{
+			Component: "ImageBlock",
+			Props: map[string]interface{}{
+				"image": map[string]interface{}{
+					"filename":       "test setup.png",
+					"content_base64": content,
+				},
+			},
+		},
+	}}
+
+	result, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+	relsXML := readDocxPart(t, result.Document, "word/_rels/document.xml.rels")
+	contentTypes := readDocxPart(t, result.Document, "[Content_Types].xml")
+	readDocxPart(t, result.Document, "word/media/test_setup.png")
+
+	if !strings.Contains(relsXML, `Type="`+RelTypeImage+`" Target="media/test_setup.png"`) {
+		t.Errorf("Expected image relationship, got %s", relsXML)
+	}
+	if strings.Count(relsXML, RelTypeImage) != 1 {
+		t.Errorf("Expected identical images to share one relationship, got %s", relsXML)
+	}
+	if !strings.Contains(contentTypes, `<Default Extension="png" ContentType="image/png"/>`) {
+		t.Errorf("Expected png content type default, got %s", contentTypes)
+	}
+	if strings.Count(documentXML, `r:embed="rId10"`) != 2 {
+		t.Errorf("Expected both blips to embed rId10")
+	}
+	if !strings.Contains(documentXML, `descr="Test setup &amp; fixtures"`) {
+		t.Errorf("Expected alt text in docPr description")
+	}
+	if !strings.Contains(documentXML, `<wp:extent cx="1905000" cy="952500"/>`) {
+		t.Errorf("Expected auto-sized extent of 200x100 pixels at 96 DPI")
+	}
+	if !strings.Contains(documentXML, `<wp:extent cx="1828800" cy="1828800"/>`) {
+		t.Errorf("Expected the second image to keep the component's extent")
+	}
+}
+
+func TestImageFromMediaDir(t *testing.T) {
+	engine, err := NewEngine("../../assets/shell/template_shell.docx", "../../assets/components/", "../../assets/schemas/rules.cue", WithMediaDir("../../assets/media"))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	imageProps := func(path string) []ComponentInstance {
+		return []ComponentInstance{{
+			Component: "ImageBlock",
+			Props:     map[string]interface{}{"image": map[string]interface{}{"path": path}},
+		}}
+	}
+
+	result, err := engine.Assemble(DocumentPlan{Body: imageProps("docgen_logo.png")})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	readDocxPart(t, result.Document, "word/media/docgen_logo.png")
+
+	if _, err := engine.Assemble(DocumentPlan{Body: imageProps("../shell/template_shell.docx.png")}); err == nil {
+		t.Error("Expected paths outside the media directory to be rejected")
+	}
+
+	if _, err := setupTestEngine(t).Assemble(DocumentPlan{Body: imageProps("docgen_logo.png")}); err == nil {
+		t.Error("Expected image paths to be rejected without a media directory")
+	}
+}
+
+func TestAssembleRepeatedComponentsHaveUniqueIDs(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	testBlock := ComponentInstance{
+		Component: "TestBlock",
+		Props: map[string]interface{}{
+			"tester_name":     "Sarah Chen",
+			"test_date":       "9/18/2024",
+			"serial_number":   "PCA-1153-SN-001",
+			"test_result":     "PASS",
+			"additional_info": "First run",
+		},
+	}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{testBlock, testBlock, testBlock}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+
+	sdtIDs := make(map[string]bool)
+	for _, id := range doc.FindElements("//w:sdtPr/w:id") {
+		value := id.SelectAttrValue("w:val", "")
+		if sdtIDs[value] {
+			t.Errorf("Duplicate content control ID %s", value)
+		}
+		sdtIDs[value] = true
+	}
+	if len(sdtIDs) != 15 {
+		t.Errorf("Expected 15 content controls, got %d", len(sdtIDs))
+	}
+	if len(doc.FindElements("//w:bookmarkStart")) != 0 || len(doc.FindElements("//w:bookmarkEnd")) != 0 {
+		t.Error("Expected _GoBack bookmarks to be removed")
+	}
+	if len(doc.FindElements("//w:placeholder")) != 0 {
+		t.Error("Expected placeholder references to missing building blocks to be removed")
+	}
+}
+
+func TestRenumberBookmarks(t *testing.T) {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<w:body xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:p><w:bookmarkStart w:id="1" w:name="Results"/><w:r/><w:bookmarkEnd w:id="1"/></w:p>` +
+		`<w:p><w:bookmarkStart w:id="1" w:name="Results"/><w:r/><w:bookmarkEnd w:id="1"/></w:p>` +
+		`<w:p><w:bookmarkStart w:id="2" w:name="Other"/><w:bookmarkEnd w:id="2"/></w:p>` +
+		`</w:body>`)
+	if err != nil {
+		t.Fatalf("Failed to parse test XML: %v", err)
+	}
+
+	renumberBookmarks(doc.Root())
+
+	var got []string
+	for _, element := range doc.FindElements("//*[@w:id]") {
+		got = append(got, element.Tag+":"+element.SelectAttrValue("w:id", "")+":"+element.SelectAttrValue("w:name", ""))
+	}
+	expected := []string{
+		"bookmarkStart:1:Results", "bookmarkEnd:1:",
+		"bookmarkStart:3:Results_2", "bookmarkEnd:3:",
+		"bookmarkStart:2:Other", "bookmarkEnd:2:",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestBookmarksAtDifferentDepths(t *testing.T) {
+	// A component whose bookmarks start inside a paragraph and end at body
+	// level, repeated twice
+	instance := `<w:p><w:bookmarkStart w:id="0" w:name="_GoBack"/><w:bookmarkStart w:id="1" w:name="Results"/><w:r/></w:p>` +
+		`<w:bookmarkEnd w:id="1"/><w:bookmarkEnd w:id="0"/>`
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<w:body xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		instance + instance + `</w:body>`)
+	if err != nil {
+		t.Fatalf("Failed to parse test XML: %v", err)
+	}
+
+	removeGoBackBookmarks(doc.Root())
+	renumberBookmarks(doc.Root())
+
+	var got []string
+	for _, element := range elementsInOrder(doc.Root(), "w:bookmarkStart", "w:bookmarkEnd") {
+		got = append(got, element.Tag+":"+element.SelectAttrValue("w:id", "")+":"+element.SelectAttrValue("w:name", ""))
+	}
+	expected := []string{
+		"bookmarkStart:1:Results", "bookmarkEnd:1:",
+		"bookmarkStart:2:Results_2", "bookmarkEnd:2:",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// loadTestPlan reads a plan from assets/plans
+func loadTestPlan(t testing.TB, name string) DocumentPlan {
+	t.Helper()
+	planData, err := os.ReadFile(filepath.Join("../../assets/plans", name))
+	if err != nil {
+		t.Fatalf("Failed to read plan %s: %v", name, err)
+	}
+	var plan DocumentPlan
+	if err := json.Unmarshal(planData, &plan); err != nil {
+		t.Fatalf("Failed to parse plan %s: %v", name, err)
+	}
+	return plan
+}
+
+func TestAssembleIsReproducible(t *testing.T) {
+	engine := setupTestEngine(t)
+	plan := loadTestPlan(t, "full_integration_test.json")
+
+	first, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	second, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	if !bytes.Equal(first.Document, second.Document) || first.SHA256 != second.SHA256 {
+		t.Fatalf("Expected identical output for the same plan, got hashes %s and %s", first.SHA256, second.SHA256)
+	}
+	sum := sha256.Sum256(first.Document)
+	if first.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 does not match the document bytes")
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(first.Document), int64(len(first.Document)))
+	if err != nil {
+		t.Fatalf("Failed to open generated DOCX: %v", err)
+	}
+	if reader.File[0].Name != "[Content_Types].xml" || reader.File[1].Name != "_rels/.rels" {
+		t.Errorf("Expected [Content_Types].xml and _rels/.rels first, got %s, %s", reader.File[0].Name, reader.File[1].Name)
+	}
+	for _, file := range reader.File {
+		if !file.Modified.Equal(zipModifiedTime) {
+			t.Errorf("Expected fixed modification time for %s, got %v", file.Name, file.Modified)
+		}
+	}
+}
+
+func TestAssembleGoldenDocument(t *testing.T) {
+	engine := setupTestEngine(t)
+	result, err := engine.Assemble(loadTestPlan(t, "full_integration_test.json"))
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+
+	goldenPath := filepath.Join("testdata", "golden", "full_integration_test.document.xml")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0755); err != nil {
+			t.Fatalf("Failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, []byte(documentXML), 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+
+	golden, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+	}
+	if documentXML != string(golden) {
+		t.Errorf("document.xml differs from %s; run go test -update after verifying the change", goldenPath)
+	}
+}
+
+func TestAssembleWritesDocProps(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{
+		DocProps: DocProps{
+			Filename: "docprops.docx",
+			Title:    "Thermal Vacuum Test Report",
+			Subject:  "DOC-0042, Rev B",
+			Creator:  "Jane Engineer",
+			Keywords: "thermal; vacuum",
+			Revision: 4,
+			Created:  "2025-03-01T09:30:00-05:00",
+			Modified: "2025-03-02",
+		},
+		Body: []ComponentInstance{
+			{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Thermal Vacuum Test Report"}},
+		},
+	}
+
+	result, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	core := readDocxPart(t, result.Document, "docProps/core.xml")
+	for _, want := range []string{
+		"<dc:title>Thermal Vacuum Test Report</dc:title>",
+		"<dc:subject>DOC-0042, Rev B</dc:subject>",
+		"<dc:creator>Jane Engineer</dc:creator>",
+		"<cp:lastModifiedBy>Jane Engineer</cp:lastModifiedBy>",
+		"<cp:keywords>thermal; vacuum</cp:keywords>",
+		"<cp:revision>4</cp:revision>",
+		`<dcterms:created xsi:type="dcterms:W3CDTF">2025-03-01T14:30:00Z</dcterms:created>`,
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">2025-03-02T00:00:00Z</dcterms:modified>`,
+	} {
+		if !strings.Contains(core, want) {
+			t.Errorf("core.xml missing %s:\n%s", want, core)
+		}
+	}
+	for _, stale := range []string{"Ryan McCarty", "lastPrinted", "Acceptance Test Procedure", "contentStatus", "DOC-XXXX"} {
+		if strings.Contains(core, stale) {
+			t.Errorf("core.xml still contains shell value %q", stale)
+		}
+	}
+
+	app := readDocxPart(t, result.Document, "docProps/app.xml")
+	if !strings.Contains(app, "<vt:lpstr>Thermal Vacuum Test Report</vt:lpstr>") {
+		t.Errorf("app.xml TitlesOfParts not updated:\n%s", app)
+	}
+	for _, stale := range []string{"Innoflight", "<Company>", "<HLinks>", "Kyocera.bmp", "Safe To Mate"} {
+		if strings.Contains(app, stale) {
+			t.Errorf("app.xml still contains shell value %q", stale)
+		}
+	}
+}
+
+func TestDocPropsFallBackToBoundContentControls(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{
+		Body: []ComponentInstance{
+			{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Bound Title"}},
+			{Component: "AuthorBlock", Props: map[string]interface{}{
+				"author_name":    "Bound Author",
+				"company_name":   "Example Corp",
+				"address_line1":  "1 Main St",
+				"address_line2":  "Suite 2",
+				"city_state_zip": "Springfield, ST 00000",
+				"phone":          "555-0100",
+				"fax":            "555-0101",
+				"website":        "https://example.com",
+			}},
+		},
+	}
+
+	result, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	core := readDocxPart(t, result.Document, "docProps/core.xml")
+	for _, want := range []string{
+		"<dc:title>Bound Title</dc:title>",
+		"<dc:creator>Bound Author</dc:creator>",
+		"<cp:revision>1</cp:revision>",
+	} {
+		if !strings.Contains(core, want) {
+			t.Errorf("core.xml missing %s:\n%s", want, core)
+		}
+	}
+	if strings.Contains(core, "dcterms:created") || strings.Contains(core, "DOC-2145") {
+		t.Errorf("core.xml kept shell values:\n%s", core)
+	}
+}
+
+func TestRenderComponentTemplateLanguage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		props    map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "DefaultForMissingProp",
+			template: `<w:p><w:r><w:t>{{ phone | default "n/a" }}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{},
+			expected: `<w:p><w:r><w:t>n/a</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "DefaultNotUsedWhenSet",
+			template: `<w:p><w:r><w:t>{{ phone | default "n/a" }}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{"phone": "555-0100"},
+			expected: `<w:p><w:r><w:t>555-0100</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "IfRemovesWholeParagraph",
+			template: `<w:p><w:r><w:t>A</w:t></w:r></w:p><w:p><w:r><w:t>{{#if fax}}Fax: {{ fax }}{{/if}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{},
+			expected: `<w:p><w:r><w:t>A</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "IfKeepsParagraph",
+			template: `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>{{#if fax}}Fax: {{ fax }}{{/if}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{"fax": "555-0101"},
+			expected: `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>Fax: 555-0101</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "UnlessInsideParagraph",
+			template: `<w:p><w:r><w:t>Status{{#unless passed}}: FAILED{{/unless}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{"passed": false},
+			expected: `<w:p><w:r><w:t>Status</w:t></w:r><w:r><w:t>: FAILED</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "IfAcrossParagraphsDropsMarkerParagraphs",
+			template: `<w:p><w:r><w:t>{{#if notes}}</w:t></w:r></w:p><w:p><w:r><w:t>Notes</w:t></w:r></w:p><w:p><w:r><w:t>{{/if}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{"notes": true},
+			expected: `<w:p><w:r><w:t>Notes</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "EachRepeatsParagraph",
+			template: `<w:p><w:r><w:t>{{#each steps}}{{ @number }}. {{ this }}{{/each}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{"steps": []interface{}{"Power on", "Measure"}},
+			expected: `<w:p><w:r><w:t>1. Power on</w:t></w:r></w:p><w:p><w:r><w:t>2. Measure</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "EachRepeatsTableRow",
+			template: `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>{{#each rows}}{{ name }}</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>{{ value }}{{/each}}</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`,
+			props: map[string]interface{}{"rows": []interface{}{
+				map[string]interface{}{"name": "V1", "value": "3.3"},
+				map[string]interface{}{"name": "V2", "value": 5.0},
+			}},
+			expected: `<w:tbl><w:tr><w:tc><w:p><w:r><w:t>V1</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>3.3</w:t></w:r></w:p></w:tc></w:tr><w:tr><w:tc><w:p><w:r><w:t>V2</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>5</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`,
+		},
+		{
+			name:     "EachOverMissingPropRendersNothing",
+			template: `<w:p><w:r><w:t>{{#each steps}}{{ this }}{{/each}}</w:t></w:r></w:p>`,
+			props:    map[string]interface{}{},
+			expected: ``,
+		},
+		{
+			name:     "NestedBlocksInOneParagraph",
+			template: `<w:p><w:r><w:t>{{#each people}}{{#if email}}{{ name }} &lt;{{ email }}&gt;{{/if}}{{/each}}</w:t></w:r></w:p>`,
+			props: map[string]interface{}{"people": []interface{}{
+				map[string]interface{}{"name": "Ada", "email": "ada@example.com"},
+				map[string]interface{}{"name": "Bob"},
+			}},
+			expected: `<w:p><w:r><w:t>Ada &lt;ada@example.com&gt;</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "OuterPropsVisibleInLoop",
+			template: `<w:p><w:r><w:t>{{#each items}}{{ prefix }}-{{ this.id }}{{/each}}</w:t></w:r></w:p>`,
+			props: map[string]interface{}{
+				"prefix": "DOC",
+				"items":  []interface{}{map[string]interface{}{"id": "7"}},
+			},
+			expected: `<w:p><w:r><w:t>DOC-7</w:t></w:r></w:p>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, _, err := RenderComponent(tc.template, tc.props)
+			if err != nil {
+				t.Fatalf("Failed to render component: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestRenderComponentTemplateErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		errText  string
+	}{
+		{"Unclosed", `<w:p><w:r><w:t>{{#if fax}}Fax</w:t></w:r></w:p>`, "is not closed"},
+		{"Mismatched", `<w:p><w:r><w:t>{{#if fax}}Fax{{/each}}</w:t></w:r></w:p>`, "closes"},
+		{"UnknownFilter", `<w:p><w:r><w:t>{{ fax | upper }}</w:t></w:r></w:p>`, "unknown filter"},
+		{"EachOverString", `<w:p><w:r><w:t>{{#each fax}}x{{/each}}</w:t></w:r></w:p>`, "requires an array"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := RenderComponent(tc.template, map[string]interface{}{"fax": "555-0101"})
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("Expected error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
+
+func TestLoadComponentsJoinsSplitPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	// As exported by Word: revision IDs, a spell-check mark and a placeholder
+	// split over three runs, the last of which is formatted differently
+	component := `<w:p w:rsidR="00A1" w:rsidRDefault="00B2"><w:r w:rsidRPr="00C3"><w:rPr><w:noProof/></w:rPr><w:t>Tester: {{ tes</w:t></w:r><w:proofErr w:type="spellStart"/><w:r w:rsidR="00D4"><w:rPr><w:noProof/></w:rPr><w:t>ter_na</w:t></w:r><w:proofErr w:type="spellEnd"/><w:r><w:rPr><w:b/></w:rPr><w:t>me }} (lead)</w:t></w:r></w:p>`
+	if err := os.WriteFile(filepath.Join(dir, "Split.component.xml"), []byte(component), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+
+	components, err := LoadComponents(dir)
+	if err != nil {
+		t.Fatalf("Failed to load components: %v", err)
+	}
+
+	expected := `<w:p><w:r><w:rPr><w:noProof/></w:rPr><w:t>Tester: {{ tester_name }}</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve"> (lead)</w:t></w:r></w:p>`
+	if components["Split"] != expected {
+		t.Errorf("Expected normalized component:\n%s\ngot:\n%s", expected, components["Split"])
+	}
+
+	rendered, _, err := RenderComponent(components["Split"], map[string]interface{}{"tester_name": "Jane"})
+	if err != nil {
+		t.Fatalf("Failed to render component: %v", err)
+	}
+	if !strings.Contains(rendered, "<w:t>Tester: Jane</w:t>") {
+		t.Errorf("Placeholder was not replaced: %s", rendered)
+	}
+}
+
+func TestLoadComponentsJoinsPlaceholdersSplitAcrossNestedRuns(t *testing.T) {
+	dir := t.TempDir()
+	// Placeholders split across a tracked insertion and a hyperlink, so the
+	// runs holding them sit at different depths
+	component := `<w:p><w:r><w:t>Name: {{ tester_</w:t></w:r><w:ins w:id="1" w:author="Jane"><w:r><w:t>name }}</w:t></w:r></w:ins><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve"> (lead) </w:t></w:r><w:hyperlink r:id="rId1"><w:r><w:t>{{ site_</w:t></w:r></w:hyperlink><w:r><w:t>url }}</w:t></w:r></w:p>`
+	if err := os.WriteFile(filepath.Join(dir, "Nested.component.xml"), []byte(component), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+
+	components, err := LoadComponents(dir)
+	if err != nil {
+		t.Fatalf("Failed to load components: %v", err)
+	}
+
+	expected := `<w:p><w:r><w:t>Name: {{ tester_name }}</w:t></w:r><w:ins w:id="1" w:author="Jane"/><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve"> (lead) </w:t></w:r><w:hyperlink r:id="rId1"><w:r><w:t>{{ site_url }}</w:t></w:r></w:hyperlink></w:p>`
+	if components["Nested"] != expected {
+		t.Errorf("Expected normalized component:\n%s\ngot:\n%s", expected, components["Nested"])
+	}
+}
+
+func TestStrictModeReportsTemplateMismatches(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{
+		Body: []ComponentInstance{
+			{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Strict Mode"}},
+			{Component: "TestBlock", Props: map[string]interface{}{
+				"tester_nmae":     "Jane Engineer", // Typo for tester_name
+				"test_date":       "1/2/2025",
+				"serial_number":   "SN-1",
+				"test_result":     "PASS",
+				"additional_info": "",
+			}},
+		},
+	}
+	twice := DocumentPlan{Body: append(plan.Body, plan.Body[1])}
+
+	// Non-strict assembly succeeds and reports the mismatch as a warning
+	result, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if len(result.Warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %v", result.Warnings)
+	}
+	warning := result.Warnings[0]
+	if warning.Component != "TestBlock" || warning.Index != 1 {
+		t.Errorf("Expected warning for TestBlock at body[1], got %s at body[%d]", warning.Component, warning.Index)
+	}
+	if len(warning.Unresolved) != 1 || warning.Unresolved[0] != "{{ tester_name }}" {
+		t.Errorf("Expected unresolved {{ tester_name }}, got %v", warning.Unresolved)
+	}
+	if len(warning.Unused) != 1 || warning.Unused[0] != "tester_nmae" {
+		t.Errorf("Expected unused tester_nmae, got %v", warning.Unused)
+	}
+
+	// Strict assembly fails with the same findings
+	_, err = engine.Assemble(plan, Strict(true))
+	var mismatch *TemplateMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected TemplateMismatchError, got %v", err)
+	}
+	if mismatch.Component != "TestBlock" || mismatch.Index != 1 {
+		t.Errorf("Expected error for TestBlock at body[1], got %s at body[%d]", mismatch.Component, mismatch.Index)
+	}
+	if !strings.Contains(err.Error(), "{{ tester_name }}") || !strings.Contains(err.Error(), "tester_nmae") {
+		t.Errorf("Error does not list the findings: %v", err)
+	}
+
+	// Every mismatching instance is reported, not only the first
+	_, err = engine.Assemble(twice, Strict(true))
+	var strictErr *StrictRenderError
+	if !errors.As(err, &strictErr) {
+		t.Fatalf("Expected StrictRenderError, got %v", err)
+	}
+	if len(strictErr.Mismatches) != 2 || strictErr.Mismatches[0].Index != 1 || strictErr.Mismatches[1].Index != 2 {
+		t.Errorf("Expected mismatches at body[1] and body[2], got %v", strictErr.Mismatches)
+	}
+}
+
+func TestRenderComponentStrictMode(t *testing.T) {
+	template := `<w:p><w:r><w:t>{{ tester_name }}</w:t></w:r></w:p>`
+	props := map[string]interface{}{"tester_nmae": "Jane"}
+
+	// Without strict mode the fragment is rendered and the findings returned
+	fragment, warning, err := RenderComponent(template, props)
+	if err != nil {
+		t.Fatalf("RenderComponent failed: %v", err)
+	}
+	if !strings.Contains(fragment, "<w:t></w:t>") {
+		t.Errorf("Expected the unresolved placeholder to render empty, got %s", fragment)
+	}
+	if warning == nil || len(warning.Unresolved) != 1 || len(warning.Unused) != 1 || warning.Unused[0] != "tester_nmae" {
+		t.Errorf("Expected a warning listing the findings, got %v", warning)
+	}
+
+	// Strict mode fails with the same findings
+	_, _, err = RenderComponent(template, props, Strict(true))
+	var mismatch *TemplateMismatchError
+	if !errors.As(err, &mismatch) || len(mismatch.Unresolved) != 1 || len(mismatch.Unused) != 1 {
+		t.Fatalf("Expected TemplateMismatchError, got %v", err)
+	}
+
+	// A template whose props all resolve has no findings
+	if _, warning, err := RenderComponent(template, map[string]interface{}{"tester_name": "Jane"}, Strict(true)); err != nil || warning != nil {
+		t.Errorf("Expected a clean render, got warning %v, error %v", warning, err)
+	}
+}
+
+func TestStrictModeAcceptsOmittedConditionalProps(t *testing.T) {
+	engine, err := NewEngine("../../assets/shell/template_shell.docx", "../../assets/components", "../../assets/schemas/rules.cue", WithStrictMode(true))
+	if err != nil {
+		t.Fatalf("Failed to initialize engine: %v", err)
+	}
+
+	// The integration plan omits AuthorBlock's optional fax
+	result, err := engine.Assemble(loadTestPlan(t, "full_integration_test.json"))
+	if err != nil {
+		t.Fatalf("Strict assembly failed: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", result.Warnings)
+	}
+}
+
+func TestRenderComponentRichText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "StringStaysSingleRun",
+			template: `<w:p><w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t>Note: {{ info }}</w:t></w:r></w:p>`,
+			value:    "plain",
+			expected: `<w:p><w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t>Note: plain</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "SpansInheritRunProperties",
+			template: `<w:p><w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t>Note: {{ info }}.</w:t></w:r></w:p>`,
+			value: []interface{}{
+				"See ",
+				map[string]interface{}{"text": "H", "bold": true, "italic": true},
+				map[string]interface{}{"text": "2", "vert_align": "subscript"},
+				map[string]interface{}{"text": "O", "underline": true, "style": "Emphasis"},
+			},
+			expected: `<w:p>` +
+				`<w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t xml:space="preserve">Note: </w:t></w:r>` +
+				`<w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t xml:space="preserve">See </w:t></w:r>` +
+				`<w:r><w:rPr><w:b/><w:i/><w:sz w:val="20"/></w:rPr><w:t>H</w:t></w:r>` +
+				`<w:r><w:rPr><w:sz w:val="20"/><w:vertAlign w:val="subscript"/></w:rPr><w:t>2</w:t></w:r>` +
+				`<w:r><w:rPr><w:rStyle w:val="Emphasis"/><w:sz w:val="20"/><w:u w:val="single"/></w:rPr><w:t>O</w:t></w:r>` +
+				`<w:r><w:rPr><w:sz w:val="20"/></w:rPr><w:t>.</w:t></w:r>` +
+				`</w:p>`,
+		},
+		{
+			name:     "LineBreaksAndTabs",
+			template: `<w:p><w:r><w:t>{{ info }}</w:t></w:r></w:p>`,
+			value: []interface{}{
+				map[string]interface{}{"text": "Line 1", "break": true},
+				"Line 2\nKey\tValue",
+			},
+			expected: `<w:p><w:r><w:t>Line 1</w:t><w:br/></w:r><w:r><w:t>Line 2</w:t><w:br/><w:t>Key</w:t><w:tab/><w:t>Value</w:t></w:r></w:p>`,
+		},
+		{
+			name:     "PlainTextInAttributes",
+			template: `<w:p><w:r><w:t>{{ other }}</w:t></w:r><w:bookmarkStart w:id="0" w:name="{{ info }}"/></w:p>`,
+			value:    []interface{}{"A", map[string]interface{}{"text": "B", "bold": true}},
+			expected: `<w:p><w:r><w:t>x</w:t></w:r><w:bookmarkStart w:id="0" w:name="AB"/></w:p>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, _, err := RenderComponent(tc.template, map[string]interface{}{"info": tc.value, "other": "x"})
+			if err != nil {
+				t.Fatalf("RenderComponent failed: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Unexpected output:\n got: %s\nwant: %s", result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRenderComponentRichTextErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		value   interface{}
+		errText string
+	}{
+		{"UnknownField", []interface{}{map[string]interface{}{"text": "x", "colour": "red"}}, `unknown field "colour"`},
+		{"WrongType", []interface{}{map[string]interface{}{"bold": "yes"}}, `field "bold" has the wrong type`},
+		{"BadVertAlign", []interface{}{map[string]interface{}{"vert_align": "raised"}}, "superscript or subscript"},
+		{"NotASpan", []interface{}{42.0}, "must be a string or an object"},
+		{"LinkOutsideDocument", []interface{}{map[string]interface{}{"text": "x", "link": "https://example.com"}}, "can only be rendered into a document"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := RenderComponent(`<w:p><w:r><w:t>{{ info }}</w:t></w:r></w:p>`, map[string]interface{}{"info": tc.value})
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("Expected error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
+
+func TestAssembleRichTextHyperlink(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{
+			Component: "TestBlock",
+			Props: map[string]interface{}{
+				"tester_name":   "John Doe",
+				"test_date":     "12/25/2024",
+				"serial_number": "SN123456",
+				"test_result":   "PASS",
+				"additional_info": []interface{}{
+					"Tested per ",
+					map[string]interface{}{"text": "MIL-STD-810H", "link": "https://example.com/810h"},
+				},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+	relsXML := readDocxPart(t, result.Document, "word/_rels/document.xml.rels")
+
+	match := regexp.MustCompile(`<w:hyperlink r:id="(rId\d+)" w:history="1">\s*<w:r>\s*<w:rPr>\s*<w:rStyle w:val="Hyperlink"/>\s*<w:szCs w:val="24"/>\s*</w:rPr>\s*<w:t>MIL-STD-810H</w:t>`).FindStringSubmatch(documentXML)
+	if match == nil {
+		t.Fatalf("Expected a hyperlink run inheriting the placeholder formatting, got %s", documentXML)
+	}
+	if !strings.Contains(relsXML, `Id="`+match[1]+`" Type="`+RelTypeHyperlink+`" Target="https://example.com/810h" TargetMode="External"`) {
+		t.Errorf("Expected external hyperlink relationship %s, got %s", match[1], relsXML)
+	}
+	if !strings.Contains(documentXML, `<w:t xml:space="preserve">Tested per </w:t>`) {
+		t.Errorf("Expected the plain span as its own run")
+	}
+}
+
+func TestAssembleMeasurementTable(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{
+			Component: "MeasurementTable",
+			Props: map[string]interface{}{
+				"rows": []interface{}{
+					map[string]interface{}{"parameter": "Supply voltage", "expected": "3.3 V", "actual": "3.31 V", "result": "PASS"},
+					map[string]interface{}{
+						"parameter":   "Ripple",
+						"expected":    "< 50 mV",
+						"actual":      "62 mV",
+						"result":      "FAIL",
+						"cell_styles": map[string]interface{}{"actual": map[string]interface{}{"fill": "ffeb9c", "bold": true}},
+					},
+				},
+			},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", result.Warnings)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	table := doc.FindElement("//w:tbl")
+	if table == nil {
+		t.Fatal("Expected a table in document.xml")
+	}
+
+	var widths []string
+	for _, col := range table.FindElements("w:tblGrid/w:gridCol") {
+		widths = append(widths, col.SelectAttrValue("w:w", ""))
+	}
+	if strings.Join(widths, ",") != "3240,2160,2160,1800" {
+		t.Errorf("Expected column widths from metadata, got %v", widths)
+	}
+
+	rows := table.SelectElements("w:tr")
+	if len(rows) != 3 {
+		t.Fatalf("Expected a header row and 2 data rows, got %d rows", len(rows))
+	}
+	if rows[0].FindElement("w:trPr/w:tblHeader") == nil || rows[1].FindElement("w:trPr/w:tblHeader") != nil {
+		t.Errorf("Expected only the header row to repeat across pages")
+	}
+	if style := rows[0].FindElement("w:tc/w:p/w:pPr/w:pStyle"); style == nil || style.SelectAttrValue("w:val", "") != "Tableheading" {
+		t.Errorf("Expected header cells to use the Tableheading style")
+	}
+
+	cellText := func(row, column int) string {
+		var text strings.Builder
+		for _, element := range rows[row].SelectElements("w:tc")[column].FindElements(".//w:t") {
+			text.WriteString(element.Text())
+		}
+		return text.String()
+	}
+	cellFill := func(row, column int) string {
+		shd := rows[row].SelectElements("w:tc")[column].FindElement("w:tcPr/w:shd")
+		if shd == nil {
+			return ""
+		}
+		return shd.SelectAttrValue("w:fill", "")
+	}
+
+	if cellText(0, 3) != "Result" || cellText(2, 1) != "< 50 mV" {
+		t.Errorf("Unexpected cell text %q, %q", cellText(0, 3), cellText(2, 1))
+	}
+	if cellFill(1, 3) != "C6EFCE" || cellFill(2, 3) != "FFC7CE" {
+		t.Errorf("Expected result cells shaded by value, got %q and %q", cellFill(1, 3), cellFill(2, 3))
+	}
+	if cellFill(2, 2) != "FFEB9C" || rows[2].SelectElements("w:tc")[2].FindElement(".//w:rPr/w:b") == nil {
+		t.Errorf("Expected the row's cell style on the actual cell")
+	}
+	if cellFill(1, 2) != "" {
+		t.Errorf("Expected unstyled cells to have no shading")
+	}
+}
+
+func TestTableComponentReportsMismatches(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{Body: []ComponentInstance{
+		{Component: "MeasurementTable", Props: map[string]interface{}{"caption": "Table 1"}},
+	}}
+	_, err := engine.Assemble(plan, Strict(true))
+
+	var mismatch *TemplateMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a TemplateMismatchError, got %v", err)
+	}
+	if strings.Join(mismatch.Unresolved, ",") != "{{ rows }}" || strings.Join(mismatch.Unused, ",") != "caption" {
+		t.Errorf("Unexpected mismatch: %v", mismatch)
+	}
+}
+
+func TestSetParagraphStyle(t *testing.T) {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<w:p xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:pPr><w:spacing w:after="0"/><w:pStyle w:val="Normal"/><w:jc w:val="center"/></w:pPr><w:r/></w:p>`)
+	if err != nil {
+		t.Fatalf("Failed to parse test XML: %v", err)
+	}
+
+	setParagraphStyle(doc.Root(), "Heading1")
+
+	var got []string
+	for _, child := range doc.Root().SelectElement("w:pPr").ChildElements() {
+		got = append(got, child.Tag+":"+child.SelectAttrValue("w:val", ""))
+	}
+	expected := []string{"pStyle:Heading1", "spacing:", "jc:center"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestParseComponentSpecErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		metadata string
+		errText  string
+	}{
+		{"UnknownType", `{"type": "chart", "rows_prop": "rows", "columns": [{"key": "a", "width": 100}]}`, "unsupported component type"},
+		{"UnknownField", `{"type": "table", "rows_prop": "rows", "colums": []}`, "unknown field"},
+		{"NoColumns", `{"type": "table", "rows_prop": "rows", "columns": []}`, "no columns"},
+		{"DuplicateKey", `{"type": "table", "rows_prop": "rows", "columns": [{"key": "a", "width": 100}, {"key": "a", "width": 100}]}`, "duplicate key"},
+		{"ZeroWidth", `{"type": "table", "rows_prop": "rows", "columns": [{"key": "a"}]}`, "width must be positive"},
+		{"BadFill", `{"type": "table", "rows_prop": "rows", "columns": [{"key": "a", "width": 100, "cell_styles": {"x": {"fill": "red"}}}]}`, "not an RRGGBB colour"},
+		{"ListWithoutItemsProp", `{"type": "list", "abstract_num_id": 9}`, "is not a prop name"},
+		{"ListUnknownField", `{"type": "list", "items_prop": "items", "numId": 3}`, "unknown field"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseComponentSpec([]byte(tc.metadata))
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("Expected error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
+
+func TestAssembleListsRestartNumbering(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	steps := []interface{}{
+		"Connect the supply",
+		map[string]interface{}{
+			"text":  []interface{}{"Measure ", map[string]interface{}{"text": "ripple", "italic": true}},
+			"items": []interface{}{"At no load", map[string]interface{}{"text": "At full load", "items": []interface{}{"After 10 minutes"}}},
+		},
+		"Record the results",
+	}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{Component: "NumberedList", Props: map[string]interface{}{"items": steps}},
+		{Component: "BulletList", Props: map[string]interface{}{"items": []interface{}{"First", "Second"}}},
+		{Component: "NumberedList", Props: map[string]interface{}{"items": []interface{}{"Again from one"}}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	var levels, numIDs []string
+	for _, numPr := range doc.FindElements("//w:p/w:pPr/w:numPr") {
+		levels = append(levels, numPr.SelectElement("w:ilvl").SelectAttrValue("w:val", ""))
+		numIDs = append(numIDs, numPr.SelectElement("w:numId").SelectAttrValue("w:val", ""))
+	}
+	if strings.Join(levels, ",") != "0,0,1,1,2,0,0,0,0" {
+		t.Errorf("Unexpected list levels %v", levels)
+	}
+	if strings.Join(numIDs, ",") != "16,16,16,16,16,16,17,17,18" {
+		t.Errorf("Expected a numbering instance per list, got %v", numIDs)
+	}
+
+	numbering := etree.NewDocument()
+	if err := numbering.ReadFromString(readDocxPart(t, result.Document, "word/numbering.xml")); err != nil {
+		t.Fatalf("Failed to parse numbering.xml: %v", err)
+	}
+	root := numbering.Root()
+	for id, abstract := range map[string]string{"16": "14", "17": "9", "18": "14"} {
+		num := root.FindElement("w:num[@w:numId='" + id + "']")
+		if num == nil {
+			t.Fatalf("Expected w:num %s in numbering.xml", id)
+		}
+		if got := num.SelectElement("w:abstractNumId").SelectAttrValue("w:val", ""); got != abstract {
+			t.Errorf("Expected w:num %s to use abstractNum %s, got %s", id, abstract, got)
+		}
+		if num.FindElement("w:lvlOverride/w:startOverride[@w:val='1']") == nil {
+			t.Errorf("Expected w:num %s to restart at 1", id)
+		}
+	}
+	if last := root.ChildElements()[len(root.ChildElements())-1]; last.FullTag() != "w:numIdMacAtCleanup" {
+		t.Errorf("Expected numIdMacAtCleanup to stay last, got %s", last.FullTag())
+	}
+}
+
+func TestAssembleHeaderAndFooter(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	var plan DocumentPlan
+	if err := json.Unmarshal([]byte(`{
+		"doc_props": {
+			"title": "Power Supply Qualification",
+			"header": "{{ title }}",
+			"footer": {"text": "{{ DocumentSubject.document_subject }}, Page {{ page }} of {{pages}}", "align": "center"}
+		},
+		"body": [
+			{"component": "DocumentSubject", "props": {"document_subject": "DOC-3421, Rev B"}}
+		]
+	}`), &plan); err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+
+	result, err := engine.Assemble(plan, Strict(true))
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	header := readDocxPart(t, result.Document, "word/header1.xml")
+	if !strings.Contains(header, `<w:pStyle w:val="Header"/>`) || !strings.Contains(header, "<w:t>Power Supply Qualification</w:t>") {
+		t.Errorf("Unexpected header part: %s", header)
+	}
+
+	footer := readDocxPart(t, result.Document, "word/footer1.xml")
+	for _, expected := range []string{
+		`<w:jc w:val="center"/>`,
+		`<w:t xml:space="preserve">DOC-3421, Rev B, Page </w:t>`,
+		`<w:fldSimple w:instr=" PAGE ">`,
+		`<w:t xml:space="preserve"> of </w:t>`,
+		`<w:fldSimple w:instr=" NUMPAGES ">`,
+	} {
+		if !strings.Contains(footer, expected) {
+			t.Errorf("Expected footer to contain %s, got %s", expected, footer)
+		}
+	}
+
+	contentTypes := readDocxPart(t, result.Document, "[Content_Types].xml")
+	if !strings.Contains(contentTypes, `<Override PartName="/word/footer1.xml" ContentType="`+footerContentType+`"/>`) {
+		t.Errorf("Expected a content type override for the footer")
+	}
+
+	rels := InMemoryDocx{"word/_rels/document.xml.rels": []byte(readDocxPart(t, result.Document, "word/_rels/document.xml.rels"))}
+	relationships, err := rels.Relationships("word/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to read relationships: %v", err)
+	}
+	targets := make(map[string]string)
+	for _, rel := range relationships {
+		targets[rel.ID] = rel.Target
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	sectPr := doc.FindElement("//w:body/w:sectPr")
+	children := sectPr.ChildElements()
+	if children[0].FullTag() != "w:headerReference" || children[1].FullTag() != "w:footerReference" {
+		t.Fatalf("Expected header and footer references first in sectPr, got %s, %s", children[0].FullTag(), children[1].FullTag())
+	}
+	if target := targets[children[0].SelectAttrValue("r:id", "")]; target != "header1.xml" {
+		t.Errorf("Expected header reference to header1.xml, got %q", target)
+	}
+	if target := targets[children[1].SelectAttrValue("r:id", "")]; target != "footer1.xml" {
+		t.Errorf("Expected footer reference to footer1.xml, got %q", target)
+	}
+}
+
+func TestHeaderFooterStrictModeRejectsUnresolvedPlaceholders(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{
+		DocProps: DocProps{Footer: &HeaderFooter{Text: "{{ DocumentSubject.document_subject }}, Page {{ page }}"}},
+		Body:     []ComponentInstance{{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Report"}}},
+	}
+	if _, err := engine.Assemble(plan, Strict(true)); err == nil || !strings.Contains(err.Error(), "DocumentSubject.document_subject") {
+		t.Errorf("Expected strict mode to reject the unresolved footer placeholder, got %v", err)
+	}
+	if _, err := engine.Assemble(plan, Strict(false)); err != nil {
+		t.Errorf("Expected lenient mode to render the footer, got %v", err)
+	}
+}
+
+func TestAssembleSections(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	var plan DocumentPlan
+	if err := json.Unmarshal([]byte(`{
+		"doc_props": {"footer": "Page {{ page }}"},
+		"body": [
+			{"component": "DocumentTitle", "props": {"document_title": "Report"}},
+			{"component": "Section", "props": {
+				"orientation": "landscape",
+				"margins": {"left": 720, "right": 720},
+				"columns": 2,
+				"column_spacing": 360,
+				"page_number_start": 1,
+				"page_number_format": "lowerRoman"
+			}},
+			{"component": "DocumentSubject", "props": {"document_subject": "Wide Data"}},
+			{"component": "Section", "props": {"start": "odd_page", "page_size": "a4"}},
+			{"component": "PageBreak", "props": {}},
+			{"component": "DocumentSubject", "props": {"document_subject": "Appendix"}}
+		]
+	}`), &plan); err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+
+	result, err := engine.Assemble(plan, Strict(true))
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	sections := elementsInOrder(doc.Root(), "w:sectPr")
+	if len(sections) != 3 {
+		t.Fatalf("Expected 3 sections, got %d", len(sections))
+	}
+
+	// The first section keeps the shell's page setup
+	first := sections[0]
+	if first.Parent().FullTag() != "w:pPr" {
+		t.Errorf("Expected the first section to end in a paragraph")
+	}
+	if pgSz := first.SelectElement("w:pgSz"); pgSz.SelectAttrValue("w:w", "") != "12240" || pgSz.SelectAttrValue("w:orient", "") != "" {
+		t.Errorf("Expected the first section to be portrait letter")
+	}
+
+	// The second section is the landscape one
+	second := sections[1]
+	pgSz := second.SelectElement("w:pgSz")
+	if pgSz.SelectAttrValue("w:w", "") != "15840" || pgSz.SelectAttrValue("w:h", "") != "12240" || pgSz.SelectAttrValue("w:orient", "") != "landscape" {
+		t.Errorf("Expected a landscape letter page, got w=%s h=%s", pgSz.SelectAttrValue("w:w", ""), pgSz.SelectAttrValue("w:h", ""))
+	}
+	if pgMar := second.SelectElement("w:pgMar"); pgMar.SelectAttrValue("w:left", "") != "720" || pgMar.SelectAttrValue("w:top", "") != "1440" {
+		t.Errorf("Expected the section's margins on top of the shell's")
+	}
+	if cols := second.SelectElement("w:cols"); cols.SelectAttrValue("w:num", "") != "2" || cols.SelectAttrValue("w:space", "") != "360" {
+		t.Errorf("Expected two columns spaced 360 apart")
+	}
+	if pgNumType := second.SelectElement("w:pgNumType"); pgNumType.SelectAttrValue("w:fmt", "") != "lowerRoman" {
+		t.Errorf("Expected lower roman page numbers")
+	}
+
+	// The last section starts over from the shell's setup
+	last := sections[2]
+	if last.Parent().FullTag() != "w:body" {
+		t.Errorf("Expected the last section properties at the end of the body")
+	}
+	if last.SelectElement("w:type").SelectAttrValue("w:val", "") != "oddPage" {
+		t.Errorf("Expected the last section to start on an odd page")
+	}
+	if pgSz := last.SelectElement("w:pgSz"); pgSz.SelectAttrValue("w:w", "") != "11906" || pgSz.SelectAttrValue("w:code", "") != "" {
+		t.Errorf("Expected an A4 page without the shell's paper code")
+	}
+	if last.SelectElement("w:cols").SelectAttrValue("w:num", "") != "" {
+		t.Errorf("Expected the last section not to inherit the columns of the one before")
+	}
+
+	// Every section is in schema order and carries the footer
+	for i, sectPr := range sections {
+		if sectPr.SelectElement("w:footerReference") == nil {
+			t.Errorf("Expected section %d to reference the footer", i)
+		}
+		var tags []string
+		for _, child := range sectPr.ChildElements() {
+			tags = append(tags, child.FullTag())
+		}
+		if strings.Join(tags, " ") != strings.Join(orderedTags(tags, sectionPropertyOrder), " ") {
+			t.Errorf("Section %d properties out of order: %v", i, tags)
+		}
+	}
+
+	if doc.FindElement(`//w:br[@w:type='page']`) == nil {
+		t.Errorf("Expected PageBreak to render a page break")
+	}
+}
+
+// orderedTags sorts tags by their position in order
+func orderedTags(tags []string, order []string) []string {
+	var sorted []string
+	for _, known := range order {
+		for _, tag := range tags {
+			if tag == known {
+				sorted = append(sorted, tag)
+			}
+		}
+	}
+	return sorted
+}
+
+func TestSectionRejectsInvalidPageSetup(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	for _, tc := range []struct {
+		name     string
+		props    map[string]interface{}
+		expected string
+	}{
+		{"UnknownProp", map[string]interface{}{"paper": "letter"}, "unknown field"},
+		{"UnknownStart", map[string]interface{}{"start": "new_column"}, "unknown section start"},
+		{"UnknownPageSize", map[string]interface{}{"page_size": "b5"}, "unknown page size"},
+		{"NegativeMargin", map[string]interface{}{"margins": map[string]interface{}{"top": -10}}, "must not be negative"},
+		{"MarginsWiderThanPage", map[string]interface{}{"margins": map[string]interface{}{"left": 6000, "right": 6240}}, "no room"},
+		{"TooManyColumns", map[string]interface{}{"columns": 50}, "columns"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := DocumentPlan{Body: []ComponentInstance{
+				{Component: "Section", Props: tc.props},
+				{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Report"}},
+			}}
+			if _, err := engine.AssembleDocument(plan); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestAssembleTableOfContents(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	var plan DocumentPlan
+	if err := json.Unmarshal([]byte(`{
+		"body": [
+			{"component": "DocumentTitle", "props": {"document_title": "Procedure"}},
+			{"component": "TOC", "props": {"title": "Contents"}},
+			{"component": "Heading", "props": {"text": "Scope", "level": 1}},
+			{"component": "Heading", "props": {"text": "Equipment", "level": 1}},
+			{"component": "Heading", "props": {"text": ["Bench ", {"text": "Supply", "bold": true}], "level": 2}},
+			{"component": "Heading", "props": {"text": "Calibration", "level": 3}},
+			{"component": "Heading", "props": {"text": "Probes", "level": 2}}
+		]
+	}`), &plan); err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+
+	result, err := engine.Assemble(plan, Strict(true))
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+
+	instructions := elementsInOrder(doc.Root(), "w:instrText")
+	if len(instructions) == 0 || instructions[0].Text() != tocInstruction {
+		t.Fatalf("Expected the document to start a TOC field")
+	}
+
+	// Every heading is bookmarked and listed, with its number, in document order
+	expected := []struct{ style, text string }{
+		{"TOC1", "1.Scope"},
+		{"TOC1", "2.Equipment"},
+		{"TOC2", "2.1Bench Supply"},
+		{"TOC3", "2.1.1Calibration"},
+		{"TOC2", "2.2Probes"},
+	}
+	hyperlinks := doc.FindElements("//w:hyperlink[@w:anchor]")
+	if len(hyperlinks) != len(expected) {
+		t.Fatalf("Expected %d TOC entries, got %d", len(expected), len(hyperlinks))
+	}
+	bookmarks := make(map[string]string)
+	for _, bookmark := range doc.FindElements("//w:bookmarkStart") {
+		bookmarks[bookmark.SelectAttrValue("w:name", "")] = paragraphText(bookmark.Parent())
+	}
+	for i, hyperlink := range hyperlinks {
+		if style := hyperlink.Parent().FindElement("w:pPr/w:pStyle").SelectAttrValue("w:val", ""); style != expected[i].style {
+			t.Errorf("Entry %d: expected style %s, got %s", i, expected[i].style, style)
+		}
+		if text := paragraphText(hyperlink); !strings.HasPrefix(text, expected[i].text) {
+			t.Errorf("Entry %d: expected text %q, got %q", i, expected[i].text, text)
+		}
+		anchor := hyperlink.SelectAttrValue("w:anchor", "")
+		if heading, exists := bookmarks[anchor]; !exists || !strings.HasSuffix(expected[i].text, heading) {
+			t.Errorf("Entry %d: anchor %s does not mark heading %q, got %q", i, anchor, expected[i].text, heading)
+		}
+	}
+
+	settings := readDocxPart(t, result.Document, "word/settings.xml")
+	if !regexp.MustCompile(`<w:updateFields w:val="true"/>\s*<w:hdrShapeDefaults`).MatchString(settings) {
+		t.Errorf("Expected w:updateFields before w:hdrShapeDefaults in settings.xml")
+	}
+}
+
+func TestTableOfContentsWithoutHeadings(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	plan := DocumentPlan{Body: []ComponentInstance{
+		{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Report"}},
+		{Component: "TOC", Props: map[string]interface{}{}},
+	}}
+	document, err := engine.AssembleDocument(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if documentXML := readDocxPart(t, document, "word/document.xml"); !strings.Contains(documentXML, "No table of contents entries found.") {
+		t.Errorf("Expected an empty table of contents")
+	}
+
+	plan.Body[1] = ComponentInstance{Component: "Heading", Props: map[string]interface{}{"text": "Scope", "level": 4}}
+	if _, err := engine.AssembleDocument(plan); err == nil || !strings.Contains(err.Error(), "heading level") {
+		t.Errorf("Expected an error for heading level 4, got %v", err)
+	}
+}
+
+func TestAssembleFootnotesAndEndnotes(t *testing.T) {
+	engine := setupTestEngine(t)
+
+	testBlock := func(info interface{}) ComponentInstance {
+		return ComponentInstance{
+			Component: "TestBlock",
+			Props: map[string]interface{}{
+				"tester_name":     "John Doe",
+				"test_date":       "12/25/2024",
+				"serial_number":   "SN123456",
+				"test_result":     "PASS",
+				"additional_info": info,
+			},
+		}
+	}
+
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		testBlock([]interface{}{
+			map[string]interface{}{"text": "Tested per MIL-STD-810H", "footnote": "Department of Defense, 2019."},
+			map[string]interface{}{"text": " and IEC 60068-2-6", "footnote": []interface{}{map[string]interface{}{"text": "Edition 7.0", "italic": true}}},
+			map[string]interface{}{"endnote": "Results reviewed by QA."},
+		}),
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+	for _, pattern := range []string{
+		`MIL-STD-810H</w:t>\s*</w:r>\s*<w:r>\s*<w:rPr>\s*<w:rStyle w:val="FootnoteReference"/>\s*<w:szCs w:val="24"/>\s*</w:rPr>\s*<w:footnoteReference w:id="1"/>`,
+		`60068-2-6</w:t>\s*</w:r>\s*<w:r>\s*<w:rPr>\s*<w:rStyle w:val="FootnoteReference"/>\s*<w:szCs w:val="24"/>\s*</w:rPr>\s*<w:footnoteReference w:id="2"/>`,
+		// The shell has no EndnoteReference style
+		`<w:vertAlign w:val="superscript"/>\s*</w:rPr>\s*<w:endnoteReference w:id="1"/>`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(documentXML) {
+			t.Errorf("Expected document.xml to match %s", pattern)
+		}
+	}
+
+	footnotes := etree.NewDocument()
+	if err := footnotes.ReadFromString(readDocxPart(t, result.Document, "word/footnotes.xml")); err != nil {
+		t.Fatalf("Failed to parse footnotes.xml: %v", err)
+	}
+	notes := footnotes.Root().SelectElements("w:footnote")
+	if len(notes) != 4 {
+		t.Fatalf("Expected the two separators and two footnotes, got %d notes", len(notes))
+	}
+	first := notes[2]
+	if first.SelectAttrValue("w:id", "") != "1" || first.FindElement(".//w:pStyle[@w:val='FootnoteText']") == nil || first.FindElement(".//w:footnoteRef") == nil {
+		t.Errorf("Expected footnote 1 in the FootnoteText style with a footnote mark")
+	}
+	if text := paragraphText(first); text != "Department of Defense, 2019." {
+		t.Errorf("Unexpected footnote text %q", text)
+	}
+	if notes[3].FindElement(".//w:i") == nil {
+		t.Errorf("Expected the rich-text footnote to keep its formatting")
+	}
+
+	endnotes := readDocxPart(t, result.Document, "word/endnotes.xml")
+	if !regexp.MustCompile(`<w:endnote w:id="1">.*<w:endnoteRef/>.*Results reviewed by QA\.`).MatchString(endnotes) {
+		t.Errorf("Expected endnote 1 in endnotes.xml")
+	}
+
+	for _, info := range []interface{}{
+		[]interface{}{map[string]interface{}{"text": "Spec", "footnote": []interface{}{map[string]interface{}{"text": "Link", "link": "https://example.com"}}}},
+		[]interface{}{map[string]interface{}{"text": "Spec", "footnote": []interface{}{map[string]interface{}{"text": "Nested", "footnote": "Again"}}}},
+		[]interface{}{map[string]interface{}{"text": "Spec", "footnote": 3}},
+	} {
+		if _, err := engine.AssembleDocument(DocumentPlan{Body: []ComponentInstance{testBlock(info)}}); err == nil {
+			t.Errorf("Expected an error for footnote %v", info)
+		}
+	}
+}
+
+// writeComponentDir writes the parts of a directory component
+func writeComponentDir(t *testing.T, dir string, parts map[string][]byte) {
+	for name, content := range parts {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestAssembleDirectoryComponent(t *testing.T) {
+	dir := t.TempDir()
+	dot := new(bytes.Buffer)
+	if err := png.Encode(dot, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+
+	// As saved by Word: revision IDs, the final section properties, and a
+	// style, list, hyperlink and picture of the component's own. Its rId1
+	// clashes with a relationship of the shell.
+	writeComponentDir(t, filepath.Join(dir, "Callout"), map[string][]byte{
+		"document.xml": []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><w:body>` +
+			`<w:p w:rsidR="00A1" w:rsidRDefault="00B2"><w:pPr><w:pStyle w:val="CalloutText"/><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r w:rsidRPr="00C3"><w:t>{{ note }}</w:t></w:r>` +
+			`<w:hyperlink r:id="rId1" w:history="1"><w:r><w:rPr><w:rStyle w:val="Hyperlink"/></w:rPr><w:t>details</w:t></w:r></w:hyperlink></w:p>` +
+			`<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:drawing><wp:inline><wp:extent cx="9525" cy="9525"/><wp:docPr id="1" name="Dot"/><a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic><pic:nvPicPr><pic:cNvPr id="0" name="dot.png"/><pic:cNvPicPr/></pic:nvPicPr><pic:blipFill><a:blip r:embed="rId2"/></pic:blipFill><pic:spPr/></pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>` +
+			`<w:sectPr w:rsidR="00A1"><w:pgSz w:w="12240" w:h="15840"/></w:sectPr></w:body></w:document>`),
+		"styles.xml": []byte(`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:rPr><w:color w:val="FF0000"/></w:rPr></w:style>` +
+			`<w:style w:type="paragraph" w:customStyle="1" w:styleId="CalloutText"><w:name w:val="Callout Text"/><w:basedOn w:val="CalloutBase"/><w:pPr><w:numPr><w:numId w:val="1"/></w:numPr></w:pPr></w:style>` +
+			`<w:style w:type="paragraph" w:customStyle="1" w:styleId="CalloutBase"><w:name w:val="Callout Base"/><w:basedOn w:val="Normal"/></w:style>` +
+			`<w:style w:type="paragraph" w:customStyle="1" w:styleId="Unused"><w:name w:val="Unused"/></w:style></w:styles>`),
+		"numbering.xml": []byte(`<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+			`<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="upperLetter"/><w:lvlText w:val="%1)"/></w:lvl></w:abstractNum>` +
+			`<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num></w:numbering>`),
+		"_rels/document.xml.rels": []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/callout" TargetMode="External"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/dot.png"/>` +
+			`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/theme" Target="theme/theme1.xml"/></Relationships>`),
+		"media/dot.png": dot.Bytes(),
+	})
+
+	components, err := LoadComponents(dir)
+	if err != nil {
+		t.Fatalf("Failed to load components: %v", err)
+	}
+	if template := components["Callout"]; strings.Contains(template, "rsid") || strings.Contains(template, "sectPr") || !strings.Contains(template, "{{ note }}") {
+		t.Errorf("Expected the body content without revision IDs or section properties, got:\n%s", template)
+	}
+
+	engine, err := NewEngine("../../assets/shell/template_shell.docx", dir, "../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	callout := ComponentInstance{Component: "Callout", Props: map[string]interface{}{"note": "Check the torque"}}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{callout, callout}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	// Styles the shell lacks are added once, with the styles they are based on
+	styles := readDocxPart(t, result.Document, "word/styles.xml")
+	for id, count := range map[string]int{"CalloutText": 1, "CalloutBase": 1, "Title": 1, "Unused": 0} {
+		if n := strings.Count(styles, `w:styleId="`+id+`"`); n != count {
+			t.Errorf("Expected %d %s styles in styles.xml, got %d", count, id, n)
+		}
+	}
+	if strings.Contains(styles, "FF0000") {
+		t.Errorf("Expected the shell's Title style to be kept")
+	}
+
+	document := etree.NewDocument()
+	if err := document.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	numbering := etree.NewDocument()
+	if err := numbering.ReadFromString(readDocxPart(t, result.Document, "word/numbering.xml")); err != nil {
+		t.Fatalf("Failed to parse numbering.xml: %v", err)
+	}
+	rels, err := InMemoryDocx{"word/_rels/document.xml.rels": []byte(readDocxPart(t, result.Document, "word/_rels/document.xml.rels"))}.Relationships("word/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to read relationships: %v", err)
+	}
+	targets := make(map[string]Relationship)
+	for _, rel := range rels {
+		targets[rel.ID] = rel
+	}
+
+	// Both instances point at the same new list, which uses the component's format
+	numIDs := document.FindElements("//w:numId")
+	if len(numIDs) != 2 || numIDs[0].SelectAttrValue("w:val", "") != numIDs[1].SelectAttrValue("w:val", "") {
+		t.Fatalf("Expected both instances to use one list, got %d list references", len(numIDs))
+	}
+	numID := numIDs[0].SelectAttrValue("w:val", "")
+	num := numbering.FindElement("//w:num[@w:numId='" + numID + "']")
+	if numID == "1" || num == nil {
+		t.Fatalf("Expected the component list to get a new numbering ID, got %s", numID)
+	}
+	abstractID := num.SelectElement("w:abstractNumId").SelectAttrValue("w:val", "")
+	if numbering.FindElement("//w:abstractNum[@w:abstractNumId='"+abstractID+"']/w:lvl/w:numFmt[@w:val='upperLetter']") == nil {
+		t.Errorf("Expected the list to use the component's abstract numbering, got %s", abstractID)
+	}
+	if !strings.Contains(styles, `<w:numId w:val="`+numID+`"/>`) {
+		t.Errorf("Expected the imported style to refer to list %s", numID)
+	}
+
+	// The hyperlink and picture get relationships of the document
+	for _, hyperlink := range document.FindElements("//w:hyperlink") {
+		if rel := targets[hyperlink.SelectAttrValue("r:id", "")]; rel.Target != "https://example.com/callout" || rel.TargetMode != TargetModeExternal {
+			t.Errorf("Expected the hyperlink to target https://example.com/callout, got %+v", rel)
+		}
+	}
+	blips := document.FindElements("//a:blip")
+	if len(blips) != 2 {
+		t.Fatalf("Expected 2 pictures, got %d", len(blips))
+	}
+	for _, blip := range blips {
+		rel := targets[blip.SelectAttrValue("r:embed", "")]
+		if rel.Type != RelTypeImage || !bytes.Equal([]byte(readDocxPart(t, result.Document, "word/"+rel.Target)), dot.Bytes()) {
+			t.Errorf("Expected the picture to be copied into the document, got %+v", rel)
+		}
+	}
+}
+
+func TestLoadDirectoryComponentErrors(t *testing.T) {
+	document := func(body string) []byte {
+		return []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>` + body + `</w:body></w:document>`)
+	}
+	relationships := func(rels string) []byte {
+		return []byte(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels + `</Relationships>`)
+	}
+
+	testCases := []struct {
+		name    string
+		parts   map[string][]byte
+		errText string
+	}{
+		{
+			name: "DefinedTwice",
+			parts: map[string][]byte{
+				"Note.component.xml": []byte(`<w:p/>`),
+				"Note/document.xml":  document(`<w:p/>`),
+			},
+			errText: "defined more than once",
+		},
+		{
+			name:    "NoBody",
+			parts:   map[string][]byte{"Note/document.xml": []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"/>`)},
+			errText: "has no w:body",
+		},
+		{
+			name: "UnsupportedRelationship",
+			parts: map[string][]byte{
+				"Note/document.xml":            document(`<w:p><w:r><w:object r:id="rId4"/></w:r></w:p>`),
+				"Note/_rels/document.xml.rels": relationships(`<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/oleObject" Target="embeddings/oleObject1.bin"/>`),
+			},
+			errText: "is not supported in components",
+		},
+		{
+			name:    "MissingRelationship",
+			parts:   map[string][]byte{"Note/document.xml": document(`<w:p><w:hyperlink r:id="rId7"/></w:p>`)},
+			errText: "rId7 are referenced but not defined",
+		},
+		{
+			name: "MissingMedia",
+			parts: map[string][]byte{
+				"Note/document.xml":            document(`<w:p><w:r><w:pict r:id="rId5"/></w:r></w:p>`),
+				"Note/_rels/document.xml.rels": relationships(`<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/missing.png"/>`),
+			},
+			errText: "missing.png",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeComponentDir(t, dir, tc.parts)
+			_, err := NewEngine("../../assets/shell/template_shell.docx", dir, "../../assets/schemas/rules.cue")
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("Expected error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
+
+func TestExtractComponents(t *testing.T) {
+	master, err := LoadShell("../../assets/shell/template_shell.docx")
+	if err != nil {
+		t.Fatalf("Failed to load shell: %v", err)
+	}
+	linkID, err := master.AddRelationship("word/document.xml", Relationship{Type: RelTypeHyperlink, Target: "https://example.com/spec", TargetMode: TargetModeExternal})
+	if err != nil {
+		t.Fatalf("Failed to add relationship: %v", err)
+	}
+
+	// TesterInfo is bookmarked and fills its props from a tagged content
+	// control showing its placeholder, «text» split over runs, a simple and a
+	// complex merge field. Word's _GoBack bookmark ends outside the paragraph
+	// it starts in. Notice is a content control.
+	master["word/document.xml"] = []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>` +
+		`<w:p><w:r><w:t>Before</w:t></w:r></w:p>` +
+		`<w:p w:rsidR="00A1"><w:pPr><w:pStyle w:val="ComponentLabel"/></w:pPr><w:bookmarkStart w:id="7" w:name="Component_TesterInfo"/><w:r><w:t xml:space="preserve">Tester: </w:t></w:r>` +
+		`<w:sdt><w:sdtPr><w:tag w:val="Tester Name"/><w:showingPlcHdr/></w:sdtPr><w:sdtContent><w:r><w:rPr><w:rStyle w:val="PlaceholderText"/><w:b/></w:rPr><w:t>Click here to enter text.</w:t></w:r></w:sdtContent></w:sdt>` +
+		`<w:r w:rsidR="00B2"><w:t xml:space="preserve"> on «Test </w:t></w:r><w:bookmarkStart w:id="0" w:name="_GoBack"/><w:r w:rsidR="00C3"><w:t>Date»</w:t></w:r></w:p><w:bookmarkEnd w:id="0"/>` +
+		`<w:p><w:fldSimple w:instr=" MERGEFIELD SerialNumber \* MERGEFORMAT "><w:r><w:t>«SerialNumber»</w:t></w:r></w:fldSimple>` +
+		`<w:r><w:fldChar w:fldCharType="begin"/></w:r><w:r><w:instrText xml:space="preserve"> MERGEFIELD </w:instrText></w:r><w:r><w:instrText>"Test Result"</w:instrText></w:r><w:r><w:fldChar w:fldCharType="separate"/></w:r><w:r><w:rPr><w:i/></w:rPr><w:t>«Test Result»</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r>` +
+		`<w:hyperlink r:id="` + linkID + `"><w:r><w:rPr><w:rStyle w:val="Hyperlink"/></w:rPr><w:t>spec</w:t></w:r></w:hyperlink><w:bookmarkEnd w:id="7"/></w:p>` +
+		`<w:sdt><w:sdtPr><w:tag w:val="component:Notice"/></w:sdtPr><w:sdtContent><w:p><w:pPr><w:pStyle w:val="ListParagraph"/><w:numPr><w:ilvl w:val="0"/><w:numId w:val="3"/></w:numPr></w:pPr><w:r><w:t>Handle with care</w:t></w:r></w:p></w:sdtContent></w:sdt>` +
+		`<w:p><w:r><w:t>After</w:t></w:r></w:p>` +
+		`<w:sectPr><w:pgSz w:w="12240" w:h="15840"/></w:sectPr></w:body></w:document>`)
+
+	components, err := ExtractComponents(master)
+	if err != nil {
+		t.Fatalf("Failed to extract components: %v", err)
+	}
+	if len(components) != 2 || components[0].Name != "TesterInfo" || components[1].Name != "Notice" {
+		t.Fatalf("Expected TesterInfo and Notice, got %v", components)
+	}
+
+	info := components[0]
+	expected := `<w:p><w:pPr><w:pStyle w:val="ComponentLabel"/></w:pPr><w:r><w:t xml:space="preserve">Tester: </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>{{ tester_name }}</w:t></w:r><w:r><w:t xml:space="preserve"> on {{ test_date }}</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>{{ serial_number }}</w:t></w:r><w:r><w:rPr><w:i/></w:rPr><w:t>{{ test_result }}</w:t></w:r><w:hyperlink r:id="` + linkID + `"><w:r><w:rPr><w:rStyle w:val="Hyperlink"/></w:rPr><w:t>spec</w:t></w:r></w:hyperlink></w:p>`
+	if info.Template != expected {
+		t.Errorf("Expected template:\n%s\ngot:\n%s", expected, info.Template)
+	}
+	if strings.Join(info.Props, ",") != "tester_name,test_date,serial_number,test_result" {
+		t.Errorf("Unexpected props %v", info.Props)
+	}
+	if strings.Join(info.Styles, ",") != "ComponentLabel,Hyperlink" {
+		t.Errorf("Unexpected styles %v", info.Styles)
+	}
+	if len(info.Relationships) != 1 || info.Relationships[0].Target != "https://example.com/spec" {
+		t.Errorf("Unexpected relationships %v", info.Relationships)
+	}
+	if schema := info.Schema(); !strings.Contains(schema, "#TesterInfo: {\n\ttester_name:   string & !=\"\"\n\ttest_date:     string & !=\"\"\n") {
+		t.Errorf("Unexpected schema:\n%s", schema)
+	}
+
+	notice := components[1]
+	if strings.Contains(notice.Template, "w:sdt") || !strings.Contains(notice.Template, "Handle with care") {
+		t.Errorf("Expected the Notice content without its content control, got:\n%s", notice.Template)
+	}
+	if len(notice.Props) != 0 || strings.Join(notice.NumIDs, ",") != "3" || strings.Join(notice.Styles, ",") != "ListParagraph" {
+		t.Errorf("Unexpected Notice dependencies: props %v, lists %v, styles %v", notice.Props, notice.NumIDs, notice.Styles)
+	}
+
+	rendered, _, err := RenderComponent(info.Template, map[string]interface{}{
+		"tester_name": "Jane", "test_date": "1/2/2025", "serial_number": "SN-1", "test_result": "PASS",
+	})
+	if err != nil {
+		t.Fatalf("Failed to render extracted component: %v", err)
+	}
+	if !strings.Contains(rendered, "<w:t>Jane</w:t>") || !strings.Contains(rendered, " on 1/2/2025") {
+		t.Errorf("Extracted placeholders were not filled: %s", rendered)
+	}
+}
+
+func TestAssembleContentControlsByTag(t *testing.T) {
+	dir := t.TempDir()
+	sdt := func(names, controlType, content string) string {
+		return `<w:sdt><w:sdtPr>` + names + `<w:id w:val="1"/><w:showingPlcHdr/>` + controlType + `</w:sdtPr><w:sdtContent>` + content + `</w:sdtContent></w:sdt>`
+	}
+	placeholderRun := `<w:r><w:rPr><w:rStyle w:val="PlaceholderText"/></w:rPr><w:t>Click or tap here to enter text.</w:t></w:r>`
+	component := `<w:p><w:r><w:t xml:space="preserve">Tester: </w:t></w:r>` + sdt(`<w:tag w:val="tester_name"/>`, ``, `<w:r><w:rPr><w:b/></w:rPr><w:t>Name</w:t></w:r>`) + `</w:p>` +
+		`<w:p>` + sdt(`<w:alias w:val="Test Notes"/><w:tag w:val=""/>`, `<w:text/>`, placeholderRun) + `</w:p>` +
+		`<w:p>` + sdt(`<w:tag w:val="address"/>`, `<w:text w:multiLine="1"/>`, placeholderRun) + `</w:p>` +
+		sdt(`<w:tag w:val="summary"/>`, ``, `<w:p><w:pPr><w:jc w:val="center"/></w:pPr>`+placeholderRun+`</w:p><w:p><w:r><w:t>Second</w:t></w:r></w:p>`) +
+		`<w:p>` + sdt(``, ``, `<w:r><w:t>{{ serial_number }}</w:t></w:r>`) + sdt(`<w:tag w:val="missing"/>`, ``, placeholderRun) + `</w:p>`
+	if err := os.WriteFile(filepath.Join(dir, "Controls.component.xml"), []byte(component), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+	engine, err := NewEngine("../../assets/shell/template_shell.docx", dir, "../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	instance := ComponentInstance{Component: "Controls", Props: map[string]interface{}{
+		"tester_name":   []interface{}{"Jane ", map[string]interface{}{"text": "Engineer", "italic": true}},
+		"test_notes":    "Line one\nLine two",
+		"address":       "1 Main St\nSpringfield",
+		"summary":       "All tests passed",
+		"serial_number": "SN-1",
+	}}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{instance}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if len(result.Warnings) != 1 || strings.Join(result.Warnings[0].Unresolved, ",") != "{{ missing }}" || len(result.Warnings[0].Unused) != 0 {
+		t.Errorf("Expected only the missing tag to be reported, got %v", result.Warnings)
+	}
+
+	document := etree.NewDocument()
+	if err := document.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	controls := elementsInOrder(document.Root(), "w:sdt")
+	if len(controls) != 6 {
+		t.Fatalf("Expected 6 content controls, got %d", len(controls))
+	}
+	for i, expected := range []string{"Jane Engineer", "Line one Line two", "1 Main StSpringfield", "All tests passed", "SN-1"} {
+		control := controls[i]
+		if text := paragraphText(control.SelectElement("w:sdtContent")); text != expected {
+			t.Errorf("Control %d: expected %q, got %q", i, expected, text)
+		}
+		if control.FindElement("w:sdtPr/w:showingPlcHdr") != nil || control.FindElement("w:sdtPr/w:lock") != nil {
+			t.Errorf("Control %d: expected a filled, unlocked control", i)
+		}
+		if control.FindElement("w:sdtContent//w:rStyle[@w:val='PlaceholderText']") != nil {
+			t.Errorf("Control %d: expected the value without the placeholder text style", i)
+		}
+	}
+	if controls[5].FindElement("w:sdtPr/w:showingPlcHdr") == nil {
+		t.Errorf("Expected the unfilled control to keep showing its placeholder")
+	}
+
+	if controls[0].FindElement(".//w:r[1]/w:rPr/w:b") == nil || controls[0].FindElement(".//w:r[2]/w:rPr/w:i") == nil {
+		t.Errorf("Expected rich text in the control's formatting")
+	}
+	if controls[2].FindElement(".//w:br") == nil {
+		t.Errorf("Expected the multi-line control to keep its line break")
+	}
+	if paragraphs := controls[3].FindElements("w:sdtContent/w:p"); len(paragraphs) != 1 || paragraphs[0].FindElement("w:pPr/w:jc") == nil {
+		t.Errorf("Expected the block control to keep its first paragraph only")
+	}
+
+	instance.LockControls = true
+	result, err = engine.Assemble(DocumentPlan{Body: []ComponentInstance{instance}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	documentXML := readDocxPart(t, result.Document, "word/document.xml")
+	if n := regexp.MustCompile(`<w:id w:val="-?\d+"/>\s*<w:lock w:val="sdtContentLocked"/>`).FindAllStringIndex(documentXML, -1); len(n) != 5 {
+		t.Errorf("Expected the 5 filled controls to be locked after their IDs, got %d", len(n))
+	}
+}
+
+func TestAssembleCustomXMLPropsBinding(t *testing.T) {
+	dir := t.TempDir()
+	bound := func(storeItemID, xpath string) string {
+		return `<w:sdt><w:sdtPr><w:id w:val="1"/><w:showingPlcHdr/>` +
+			`<w:dataBinding w:prefixMappings="xmlns:ns0='` + docgenPropsNamespace + `' " w:xpath="` + xpath + `" w:storeItemID="` + storeItemID + `"/>` +
+			`<w:text/></w:sdtPr><w:sdtContent><w:r><w:rPr><w:rStyle w:val="PlaceholderText"/><w:b/></w:rPr><w:t>Click or tap here to enter text.</w:t></w:r></w:sdtContent></w:sdt>`
+	}
+	component := `<w:p>` + bound(docgenPropsStoreItemID, "/ns0:props[1]/ns0:tester_name[1]") + `</w:p>` +
+		`<w:p>` + bound("{00000000-0000-0000-0000-000000000000}", "/ns0:props[1]/ns0:tester_name[1]") + `</w:p>` +
+		`<w:p>` + bound(docgenPropsStoreItemID, "/ns0:props[1]/ns0:address[1]/ns0:city[1]") + `</w:p>` +
+		`<w:p>` + bound(docgenPropsStoreItemID, "/ns0:props[1]/ns0:missing[1]") + `</w:p>`
+	if err := os.WriteFile(filepath.Join(dir, "Bound.component.xml"), []byte(component), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+	engine, err := NewEngine("../../assets/shell/template_shell.docx", dir, "../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	plan := DocumentPlan{Body: []ComponentInstance{
+		{Component: "Bound", Props: map[string]interface{}{
+			"tester_name": []interface{}{"Jane ", map[string]interface{}{"text": "Engineer", "bold": true}},
+			"address":     map[string]interface{}{"city": "Springfield", "photo": map[string]interface{}{"content_base64": "AAAA"}},
+		}},
+		{Component: "Bound", Props: map[string]interface{}{"tester_name": "Someone Else"}},
+	}}
+	result, err := engine.Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+
+	expectedPart := `<props xmlns="` + docgenPropsNamespace + `"><address><city>Springfield</city><photo/></address><tester_name>Jane Engineer</tester_name></props>`
+	if part := readDocxPart(t, result.Document, "customXml/item2.xml"); !strings.Contains(part, expectedPart) {
+		t.Errorf("Expected the props custom XML part to hold %s, got %s", expectedPart, part)
+	}
+	if props := readDocxPart(t, result.Document, "customXml/itemProps2.xml"); !strings.Contains(props, `ds:itemID="`+docgenPropsStoreItemID+`"`) || !strings.Contains(props, `ds:uri="`+docgenPropsNamespace+`"`) {
+		t.Errorf("Expected the part's properties to give its store ID and namespace, got %s", props)
+	}
+	if rels := readDocxPart(t, result.Document, "customXml/_rels/item2.xml.rels"); !strings.Contains(rels, `Type="`+RelTypeCustomXMLProps+`" Target="itemProps2.xml"`) {
+		t.Errorf("Expected the part to be related to its properties, got %s", rels)
+	}
+	if rels := readDocxPart(t, result.Document, "word/_rels/document.xml.rels"); !strings.Contains(rels, `Type="`+RelTypeCustomXML+`" Target="../customXml/item2.xml"`) {
+		t.Errorf("Expected document.xml to be related to the part, got %s", rels)
+	}
+	if contentTypes := readDocxPart(t, result.Document, "[Content_Types].xml"); !strings.Contains(contentTypes, `PartName="/customXml/itemProps2.xml" ContentType="`+customXMLPropertiesContentType+`"`) {
+		t.Errorf("Expected a content type for the part's properties, got %s", contentTypes)
+	}
+
+	document := etree.NewDocument()
+	if err := document.ReadFromString(readDocxPart(t, result.Document, "word/document.xml")); err != nil {
+		t.Fatalf("Failed to parse document.xml: %v", err)
+	}
+	controls := elementsInOrder(document.Root(), "w:sdt")
+	if len(controls) != 8 {
+		t.Fatalf("Expected 8 content controls, got %d", len(controls))
+	}
+	for i, expected := range []string{"Jane Engineer", "Jane Engineer", "Springfield", "Click or tap here to enter text."} {
+		control := controls[i]
+		if text := paragraphText(control.SelectElement("w:sdtContent")); text != expected {
+			t.Errorf("Control %d: expected %q, got %q", i, expected, text)
+		}
+		if id := control.FindElement("w:sdtPr/w:dataBinding").SelectAttrValue("w:storeItemID", ""); id != docgenPropsStoreItemID {
+			t.Errorf("Control %d: expected to be bound to the props part, got store %s", i, id)
+		}
+		if filled := control.FindElement("w:sdtPr/w:showingPlcHdr") == nil; filled != (i < 3) {
+			t.Errorf("Control %d: expected showing placeholder text to be %v", i, !filled)
+		}
+		if styled := control.FindElement("w:sdtContent/w:r/w:rPr/w:rStyle[@w:val='PlaceholderText']") != nil; styled != (i >= 3) {
+			t.Errorf("Control %d: expected the placeholder text style to be %v", i, !styled)
+		}
+	}
+	if controls[0].FindElement("w:sdtContent/w:r/w:rPr/w:b") == nil {
+		t.Errorf("Expected the bound value in the control's formatting")
+	}
+
+	// Chosen props are written even when no control is bound to them
+	plan = DocumentPlan{
+		DocProps: DocProps{BoundProps: []string{"document_title", "reviewer"}},
+		Body:     []ComponentInstance{{Component: "DocumentTitle", Props: map[string]interface{}{"document_title": "Test Report"}}},
+	}
+	result, err = setupTestEngine(t).Assemble(plan)
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	expectedPart = `<props xmlns="` + docgenPropsNamespace + `"><document_title>Test Report</document_title><reviewer/></props>`
+	if part := readDocxPart(t, result.Document, "customXml/item2.xml"); !strings.Contains(part, expectedPart) {
+		t.Errorf("Expected the props custom XML part to hold %s, got %s", expectedPart, part)
+	}
+}
+
+func TestTemplateRegistry(t *testing.T) {
+	dir := t.TempDir()
+	copyFile := func(src, dst string) {
+		t.Helper()
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", dst, err)
+		}
+	}
+	memo := filepath.Join(dir, "memo")
+	if err := os.MkdirAll(filepath.Join(memo, "components"), 0755); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	copyFile("../../assets/shell/template_shell.docx", filepath.Join(memo, "shell.docx"))
+	copyFile("../../assets/schemas/rules.cue", filepath.Join(memo, "schema.cue"))
+	if err := os.WriteFile(filepath.Join(memo, "components", "MemoLine.component.xml"), []byte(`<w:p><w:r><w:t>To: {{ recipient }}</w:t></w:r></w:p>`), 0644); err != nil {
+		t.Fatalf("Failed to write component: %v", err)
+	}
+
+	templates, err := LoadTemplateConfigs(dir)
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	templates = append(templates, TemplateConfig{
+		Name:          "test-report",
+		ShellPath:     "../../assets/shell/template_shell.docx",
+		ComponentsDir: "../../assets/components",
+		SchemaPath:    "../../assets/schemas/rules.cue",
+	})
+
+	registry, err := NewRegistry(templates, "test-report")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if names := strings.Join(registry.Templates(), ","); names != "memo,test-report" {
+		t.Errorf("Expected templates memo,test-report, got %s", names)
+	}
+
+	engine, err := registry.Engine("memo")
+	if err != nil {
+		t.Fatalf("Failed to select template: %v", err)
+	}
+	result, err := engine.Assemble(DocumentPlan{Template: "memo", Body: []ComponentInstance{{Component: "MemoLine", Props: map[string]interface{}{"recipient": "QA"}}}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if !strings.Contains(readDocxPart(t, result.Document, "word/document.xml"), "To: QA") {
+		t.Errorf("Expected the memo template's component to be rendered")
+	}
+
+	defaultEngine, err := registry.Engine("")
+	if err != nil {
+		t.Fatalf("Failed to select the default template: %v", err)
+	}
+	if _, err := defaultEngine.GetComponent("MemoLine"); err == nil {
+		t.Errorf("Expected each template to have its own component library")
+	}
+
+	var notFound *TemplateNotFoundError
+	if _, err := registry.Engine("cert-of-conformance"); !errors.As(err, &notFound) || notFound.TemplateName != "cert-of-conformance" {
+		t.Errorf("Expected a TemplateNotFoundError for an unknown template, got %v", err)
+	}
+
+	// Without a default, plans must name a template
+	registry, err = NewRegistry(templates, "")
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if _, err := registry.Engine(""); !errors.As(err, &notFound) {
+		t.Errorf("Expected a TemplateNotFoundError without a default template, got %v", err)
+	}
+
+	for name, config := range map[string]struct {
+		templates       []TemplateConfig
+		defaultTemplate string
+		message         string
+	}{
+		"duplicate":       {append(templates, templates[0]), "", "template memo is defined more than once"},
+		"unknown default": {templates, "letter", "default template letter is not defined"},
+		"invalid name":    {[]TemplateConfig{{Name: "test report"}}, "", "invalid template name"},
+	} {
+		if _, err := NewRegistry(config.templates, config.defaultTemplate); err == nil || !strings.Contains(err.Error(), config.message) {
+			t.Errorf("%s: expected error containing %q, got %v", name, config.message, err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(memo, "schema.cue")); err != nil {
+		t.Fatalf("Failed to remove schema: %v", err)
+	}
+	if _, err := LoadTemplateConfigs(dir); err == nil || !strings.Contains(err.Error(), "template memo has no schema.cue") {
+		t.Errorf("Expected an error for a template without a schema, got %v", err)
+	}
+}
+
+func TestLoadAssetsFromFS(t *testing.T) {
+	shell, err := fs.ReadFile(assets.FS, "shell/template_shell.docx")
+	if err != nil {
+		t.Fatalf("Failed to read embedded shell: %v", err)
+	}
+	schema, err := fs.ReadFile(assets.FS, "schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to read embedded schema: %v", err)
+	}
+	logo, err := fs.ReadFile(assets.FS, "media/docgen_logo.png")
+	if err != nil {
+		t.Fatalf("Failed to read embedded media: %v", err)
+	}
+	imageBlock, err := fs.ReadFile(assets.FS, "components/ImageBlock/document.xml")
+	if err != nil {
+		t.Fatalf("Failed to read embedded component: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"templates/memo/shell.docx":                        {Data: shell},
+		"templates/memo/schema.cue":                        {Data: schema},
+		"templates/memo/components/MemoLine.component.xml": {Data: []byte(`<w:p><w:r><w:t>To: {{ recipient }}</w:t></w:r></w:p>`)},
+		"templates/memo/components/Logo/document.xml":      {Data: imageBlock},
+		"templates/memo/components/Notes.component.json":   {Data: []byte(`{"type": "list", "items_prop": "items", "abstract_num_id": 9}`)},
+		"media/logo.png":                                   {Data: logo},
+	}
+
+	templates, err := LoadTemplateConfigsFS(fsys, "templates")
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	media, err := fs.Sub(fsys, "media")
+	if err != nil {
+		t.Fatalf("Failed to open media: %v", err)
+	}
+	registry, err := NewRegistry(templates, "", WithMediaFS(media))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	engine, err := registry.Engine("")
+	if err != nil {
+		t.Fatalf("Failed to select the default template: %v", err)
+	}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{
+		{Component: "MemoLine", Props: map[string]interface{}{"recipient": "QA"}},
+		{Component: "Notes", Props: map[string]interface{}{"items": []interface{}{"Review the draft"}}},
+		{Component: "Logo", Props: map[string]interface{}{"image": map[string]interface{}{"path": "logo.png"}}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	document := readDocxPart(t, result.Document, "word/document.xml")
+	for _, text := range []string{"To: QA", "Review the draft"} {
+		if !strings.Contains(document, text) {
+			t.Errorf("Expected document to contain %q", text)
+		}
+	}
+	if readDocxPart(t, result.Document, "word/media/logo.png") != string(logo) {
+		t.Errorf("Expected the image to be read from the media FS")
+	}
+
+	// The version depends on the content of the assets, not where they are read from
+	embedded, err := AssetVersion([]TemplateConfig{{Name: DefaultTemplate, FS: assets.FS, ShellPath: "shell/template_shell.docx", ComponentsDir: "components", SchemaPath: "schemas/rules.cue"}})
+	if err != nil {
+		t.Fatalf("Failed to hash embedded assets: %v", err)
+	}
+	onDisk, err := AssetVersion([]TemplateConfig{{Name: DefaultTemplate, ShellPath: "../../assets/shell/template_shell.docx", ComponentsDir: "../../assets/components/", SchemaPath: "../../assets/schemas/rules.cue"}})
+	if err != nil {
+		t.Fatalf("Failed to hash assets on disk: %v", err)
+	}
+	if embedded != onDisk {
+		t.Errorf("Expected embedded and on-disk assets to have the same version, got %s and %s", embedded, onDisk)
+	}
+
+	if _, err := LoadShellFS(fsys, "templates/memo/missing.docx"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing shell to report fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestComponentVersions(t *testing.T) {
+	shell, err := fs.ReadFile(assets.FS, "shell/template_shell.docx")
+	if err != nil {
+		t.Fatalf("Failed to read embedded shell: %v", err)
+	}
+	schema := `package docgen
+
+#DocumentPlan: {
+	doc_props?: {...}
+	body: [...#ComponentInstance]
+}
+
+#ComponentInstance: {
+	component: "DocumentTitle" | "Stamp" | "Stamp@2" | "Stamp@3"
+	props: {...}
+	if component == "Stamp" {
+		props: {text: string}
+	}
+	if component == "Stamp@3" {
+		props: {label: string}
+	}
+}
+`
+	fsys := fstest.MapFS{
+		"shell.docx":                             {Data: shell},
+		"schema.cue":                             {Data: []byte(schema)},
+		"components/DocumentTitle.component.xml": {Data: []byte(`<w:p><w:r><w:t>{{ document_title }}</w:t></w:r></w:p>`)},
+		"components/Stamp.component.xml":         {Data: []byte(`<w:p><w:r><w:t>Stamp v1: {{ text }}</w:t></w:r></w:p>`)},
+		"components/Stamp@2.component.xml":       {Data: []byte(`<w:p><w:r><w:t>Stamp v2: {{ text }}</w:t></w:r></w:p>`)},
+		"components/Stamp@3/document.xml":        {Data: []byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p><w:r><w:t>Stamp v3: {{ label }}</w:t></w:r></w:p></w:body></w:document>`)},
+	}
+	engine, err := NewEngineFS(fsys, "shell.docx", "components", "schema.cue")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	if versions := engine.GetComponentVersions()["Stamp"]; len(versions) != 3 || versions[0] != 1 || versions[2] != 3 {
+		t.Errorf("Expected Stamp versions [1 2 3], got %v", versions)
+	}
+	if names := strings.Join(engine.GetLoadedComponents(), ","); strings.Contains(names, "@") {
+		t.Errorf("Expected loaded components without versions, got %s", names)
+	}
+
+	for _, tc := range []struct {
+		component string
+		props     map[string]interface{}
+		expected  string
+	}{
+		{"Stamp", map[string]interface{}{"label": "latest"}, "Stamp v3: latest"},
+		{"Stamp@1", map[string]interface{}{"text": "pinned"}, "Stamp v1: pinned"},
+		{"Stamp@2", map[string]interface{}{"text": "pinned"}, "Stamp v2: pinned"},
+	} {
+		result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{{Component: tc.component, Props: tc.props}}})
+		if err != nil {
+			t.Fatalf("%s: failed to assemble document: %v", tc.component, err)
+		}
+		if document := readDocxPart(t, result.Document, "word/document.xml"); !strings.Contains(document, tc.expected) {
+			t.Errorf("%s: expected document to contain %q", tc.component, tc.expected)
+		}
+	}
+
+	var notFound *ComponentNotFoundError
+	if _, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{{Component: "Stamp@4"}}}); !errors.As(err, &notFound) || notFound.ComponentName != "Stamp@4" {
+		t.Errorf("Expected a ComponentNotFoundError for a missing version, got %v", err)
+	}
+
+	// Each version is validated against its own rules
+	for _, tc := range []struct {
+		component string
+		props     map[string]interface{}
+		valid     bool
+	}{
+		{"Stamp", map[string]interface{}{"label": "latest"}, true},
+		{"Stamp", map[string]interface{}{"text": "latest"}, false},
+		{"Stamp@1", map[string]interface{}{"text": "pinned"}, true},
+		{"Stamp@1", map[string]interface{}{"label": "pinned"}, false},
+		{"Stamp@4", map[string]interface{}{"text": "pinned"}, false},
+	} {
+		plan := map[string]interface{}{"body": []interface{}{
+			map[string]interface{}{"component": "DocumentTitle", "props": map[string]interface{}{"document_title": "Versions"}},
+			map[string]interface{}{"component": tc.component, "props": tc.props},
+		}}
+		if result := engine.ValidatePlan(plan); result.Valid != tc.valid {
+			t.Errorf("%s with %v: expected valid=%t, got errors %v", tc.component, tc.props, tc.valid, result.Errors)
+		}
+		if plan["body"].([]interface{})[1].(map[string]interface{})["component"] != tc.component {
+			t.Errorf("Expected validation to leave the plan unchanged")
+		}
+	}
+
+	// A version the schema does not list is validated by the rules of the
+	// component's name, so adding a version needs no schema change
+	unlisted := fstest.MapFS{"components/Note@2.component.xml": {Data: []byte(`<w:p><w:r><w:t>Note v2: {{ text }}</w:t></w:r></w:p>`)}}
+	for file, data := range fsys {
+		unlisted[file] = data
+	}
+	unlisted["schema.cue"] = &fstest.MapFile{Data: []byte(strings.Replace(strings.Replace(schema, `| "Stamp@3"`, `| "Stamp@3" | "Note"`, 1), `if component == "Stamp@3" {`, `if component == "Note" {
+		props: {text: string}
+	}
+	if component == "Stamp@3" {`, 1))}
+	unlisted["components/Note.component.xml"] = &fstest.MapFile{Data: []byte(`<w:p><w:r><w:t>Note v1: {{ text }}</w:t></w:r></w:p>`)}
+	engine, err = NewEngineFS(unlisted, "shell.docx", "components", "schema.cue")
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for _, tc := range []struct {
+		component string
+		props     map[string]interface{}
+		valid     bool
+	}{
+		{"Note", map[string]interface{}{"text": "latest"}, true},
+		{"Note", map[string]interface{}{"label": "latest"}, false},
+		{"Note@2", map[string]interface{}{"text": "pinned"}, true},
+		{"Note@1", map[string]interface{}{"text": "pinned"}, true},
+		{"Stamp@3", map[string]interface{}{"label": "pinned"}, true},
+	} {
+		plan := map[string]interface{}{"body": []interface{}{
+			map[string]interface{}{"component": "DocumentTitle", "props": map[string]interface{}{"document_title": "Versions"}},
+			map[string]interface{}{"component": tc.component, "props": tc.props},
+		}}
+		if result := engine.ValidatePlan(plan); result.Valid != tc.valid {
+			t.Errorf("%s with %v: expected valid=%t, got errors %v", tc.component, tc.props, tc.valid, result.Errors)
+		}
+	}
+	result, err := engine.Assemble(DocumentPlan{Body: []ComponentInstance{{Component: "Note", Props: map[string]interface{}{"text": "latest"}}}})
+	if err != nil {
+		t.Fatalf("Failed to assemble document: %v", err)
+	}
+	if document := readDocxPart(t, result.Document, "word/document.xml"); !strings.Contains(document, "Note v2: latest") {
+		t.Errorf("Expected the unlisted latest version to render")
+	}
+
+	for name, files := range map[string]fstest.MapFS{
+		"duplicate version": {"components/Stamp@1.component.xml": {Data: []byte(`<w:p/>`)}},
+		"built in":          {"components/Heading@2.component.xml": {Data: []byte(`<w:p/>`)}},
+		"invalid version":   {"components/Stamp@0.component.xml": {Data: []byte(`<w:p/>`)}},
+	} {
+		for file, data := range fsys {
+			files[file] = data
+		}
+		if _, err := NewEngineFS(files, "shell.docx", "components", "schema.cue"); err == nil {
+			t.Errorf("%s: expected the components to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	corePropertiesPart     = "docProps/core.xml"
+	extendedPropertiesPart = "docProps/app.xml"
+
+	// corePropertiesStoreItemID is the well-known data store ID Word uses when
+	// content controls are bound to the core properties part
+	corePropertiesStoreItemID = "{6C3C8BC8-F283-45AE-878A-BAB7291924A1}"
+
+	// w3cdtfLayout is the W3CDTF form Word writes for dcterms dates
+	w3cdtfLayout = "2006-01-02T15:04:05Z"
+)
+
+// corePropertyElements maps core property names, as used in content control
+// data bindings, to their element in core.xml
+var corePropertyElements = map[string]string{
+	"title":          "dc:title",
+	"subject":        "dc:subject",
+	"creator":        "dc:creator",
+	"keywords":       "cp:keywords",
+	"description":    "dc:description",
+	"category":       "cp:category",
+	"lastModifiedBy": "cp:lastModifiedBy",
+	"revision":       "cp:revision",
+	"created":        "dcterms:created",
+	"modified":       "dcterms:modified",
+}
+
+// templateExtendedProperties lists the app.xml properties that describe the
+// template's author and content rather than the generated document
+var templateExtendedProperties = []string{"Company", "Manager", "HyperlinkBase", "HLinks"}
+
+// coreBindingPattern extracts the property name from a core properties XPath
+// such as /ns1:coreProperties[1]/ns0:creator[1]
+var coreBindingPattern = regexp.MustCompile(`/\w+:coreProperties\[1\]/\w+:(\w+)\[1\]$`)
+
+// writeDocProps replaces the shell's core and extended properties with the
+// plan's doc_props. Properties the plan leaves out are taken from content
+// controls bound to them (e.g. DocumentTitle's title), and the shell's own
+// values are cleared so documents never inherit the template's metadata.
+func (a *assembly) writeDocProps(props DocProps) error {
+	values, err := a.corePropertyValues(props)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := a.docx[corePropertiesPart]; exists {
+		if err := a.docx.updatePart(corePropertiesPart, func(root *etree.Element) error {
+			return setCoreProperties(root, values)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if _, exists := a.docx[extendedPropertiesPart]; exists {
+		if err := a.docx.updatePart(extendedPropertiesPart, func(root *etree.Element) error {
+			setTitlesOfParts(root, values["title"])
+			clearExtendedProperties(root)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// corePropertyValues resolves the value of every core property for the document
+func (a *assembly) corePropertyValues(props DocProps) (map[string]string, error) {
+	values := a.boundCoreProperties()
+
+	explicit := map[string]string{
+		"title":       props.Title,
+		"subject":     props.Subject,
+		"creator":     props.Creator,
+		"keywords":    props.Keywords,
+		"description": props.Description,
+		"category":    props.Category,
+	}
+	for name, value := range explicit {
+		if value != "" {
+			values[name] = value
+		}
+	}
+
+	values["lastModifiedBy"] = values["creator"]
+
+	values["revision"] = "1"
+	if props.Revision > 0 {
+		values["revision"] = strconv.Itoa(props.Revision)
+	}
+
+	for name, value := range map[string]string{"created": props.Created, "modified": props.Modified} {
+		if value == "" {
+			delete(values, name)
+			continue
+		}
+		timestamp, err := parseDocPropsTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("doc_props.%s: %w", name, err)
+		}
+		values[name] = timestamp.UTC().Format(w3cdtfLayout)
+	}
+
+	return values, nil
+}
+
+// boundCoreProperties collects the rendered text of content controls bound to
+// core properties, keeping the first control for each property
+func (a *assembly) boundCoreProperties() map[string]string {
+	values := make(map[string]string)
+
+	for _, binding := range a.body.FindElements(".//w:sdtPr/w:dataBinding") {
+		if binding.SelectAttrValue("w:storeItemID", "") != corePropertiesStoreItemID {
+			continue
+		}
+		match := coreBindingPattern.FindStringSubmatch(binding.SelectAttrValue("w:xpath", ""))
+		if match == nil {
+			continue
+		}
+		name := match[1]
+		if _, exists := values[name]; exists {
+			continue
+		}
+
+		sdtContent := binding.Parent().Parent().SelectElement("w:sdtContent")
+		if sdtContent == nil {
+			continue
+		}
+		var text strings.Builder
+		for _, t := range sdtContent.FindElements(".//w:t") {
+			text.WriteString(t.Text())
+		}
+		values[name] = text.String()
+	}
+
+	return values
+}
+
+// setCoreProperties writes values into core.xml, removing properties that have
+// no value and those plans cannot set, such as the template's print date and
+// content status
+func setCoreProperties(root *etree.Element, values map[string]string) error {
+	if root.Tag != "coreProperties" {
+		return fmt.Errorf("%s has no coreProperties root element", corePropertiesPart)
+	}
+
+	written := make(map[string]bool, len(corePropertyElements))
+	for _, tag := range corePropertyElements {
+		written[tag] = true
+	}
+	for _, element := range root.ChildElements() {
+		if !written[element.FullTag()] {
+			root.RemoveChild(element)
+		}
+	}
+
+	for _, name := range []string{"title", "subject", "creator", "keywords", "description", "lastModifiedBy", "revision", "created", "modified", "category"} {
+		tag := corePropertyElements[name]
+		element := root.SelectElement(tag)
+		value, hasValue := values[name]
+
+		if !hasValue {
+			if element != nil {
+				root.RemoveChild(element)
+			}
+			continue
+		}
+
+		if element == nil {
+			element = root.CreateElement(tag)
+			if strings.HasPrefix(tag, "dcterms:") {
+				ensureNamespace(root, "dcterms", "http://purl.org/dc/terms/")
+				ensureNamespace(root, "xsi", "http://www.w3.org/2001/XMLSchema-instance")
+				element.CreateAttr("xsi:type", "dcterms:W3CDTF")
+			}
+		}
+		element.SetText(value)
+	}
+
+	return nil
+}
+
+// setTitlesOfParts sets the document title listed in app.xml
+func setTitlesOfParts(root *etree.Element, title string) {
+	vector := root.FindElement("./TitlesOfParts/vt:vector")
+	if vector == nil {
+		return
+	}
+	for _, child := range vector.ChildElements() {
+		vector.RemoveChild(child)
+	}
+	vector.CreateAttr("size", "1")
+	vector.CreateElement("vt:lpstr").SetText(title)
+}
+
+// clearExtendedProperties removes the template's company, manager and
+// hyperlink list from app.xml
+func clearExtendedProperties(root *etree.Element) {
+	for _, tag := range templateExtendedProperties {
+		if element := root.SelectElement(tag); element != nil {
+			root.RemoveChild(element)
+		}
+	}
+}
+
+// ensureNamespace declares a namespace prefix on root if it is not declared yet
+func ensureNamespace(root *etree.Element, prefix, uri string) {
+	if root.SelectAttr("xmlns:"+prefix) == nil {
+		root.CreateAttr("xmlns:"+prefix, uri)
+	}
+}
+
+// parseDocPropsTime accepts an RFC 3339 timestamp or a plain YYYY-MM-DD date
+func parseDocPropsTime(value string) (time.Time, error) {
+	if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamp, nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
+
+// updatePart parses an XML part, applies update to its root and writes it back
+func (shell InMemoryDocx) updatePart(part string, update func(root *etree.Element) error) error {
+	content, exists := shell[part]
+	if !exists {
+		return fmt.Errorf("%s not found in document", part)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", part, err)
+	}
+	if doc.Root() == nil {
+		return fmt.Errorf("%s has no root element", part)
+	}
+
+	if err := update(doc.Root()); err != nil {
+		return err
+	}
+
+	updated, err := doc.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", part, err)
+	}
+	shell[part] = updated
+	return nil
+}
\ No newline at end of file
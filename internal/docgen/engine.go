@@ -1,52 +1,184 @@
 package docgen
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 
 	"docgen-service/internal/validator"
 )
 
+// Option configures optional Engine behaviour
+type Option func(*Engine)
+
+// WithMediaDir allows image props to reference files in dir by relative path
+func WithMediaDir(dir string) Option {
+	return WithMediaFS(os.DirFS(dir))
+}
+
+// WithMediaFS allows image props to reference files in fsys by path
+func WithMediaFS(fsys fs.FS) Option {
+	return func(e *Engine) {
+		e.media = fsys
+	}
+}
+
+// WithStrictMode sets whether assembly fails on unresolved placeholders and
+// unused props by default
+func WithStrictMode(strict bool) Option {
+	return func(e *Engine) {
+		e.strict = strict
+	}
+}
+
+// AssembleOption configures a single assembly
+type AssembleOption func(*assembleSettings)
+
+// assembleSettings holds the settings of a single assembly
+type assembleSettings struct {
+	strict bool
+}
+
+// Strict overrides the engine's strict mode for one assembly
+func Strict(strict bool) AssembleOption {
+	return func(s *assembleSettings) {
+		s.strict = strict
+	}
+}
+
 // NewEngine creates a new DocGen engine with the loaded shell and components
-func NewEngine(shellPath, componentsDir, schemaPath string) (*Engine, error) {
+func NewEngine(shellPath, componentsDir, schemaPath string, opts ...Option) (*Engine, error) {
+	return NewEngineFS(osFS{}, filepath.ToSlash(shellPath), filepath.ToSlash(componentsDir), filepath.ToSlash(schemaPath), opts...)
+}
+
+// NewEngineFS creates a new DocGen engine with the shell, components and
+// schema at the given paths in fsys, such as an embedded copy of the assets
+func NewEngineFS(fsys fs.FS, shellPath, componentsDir, schemaPath string, opts ...Option) (*Engine, error) {
 	// Load the shell document
-	shell, err := LoadShell(shellPath)
+	shell, err := LoadShellFS(fsys, shellPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load shell: %w", err)
 	}
 
 	// Load all components
-	components, err := LoadComponents(componentsDir)
+	components, err := LoadComponentsFS(fsys, componentsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components: %w", err)
+	}
+
+	// Load the styles, lists and relationships of directory components
+	resources, err := LoadComponentResourcesFS(fsys, componentsDir, components)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components: %w", err)
+	}
+
+	// Load the components described by metadata, such as tables and lists
+	specs, err := LoadComponentSpecsFS(fsys, componentsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components: %w", err)
+	}
+	for name := range specs {
+		if _, exists := components[name]; exists {
+			return nil, fmt.Errorf("component %s is defined both as XML and as metadata", name)
+		}
+	}
+	builtins := builtinComponents()
+	var loaded []string
+	for name := range components {
+		loaded = append(loaded, name)
+	}
+	for name := range specs {
+		loaded = append(loaded, name)
+	}
+	for _, name := range loaded {
+		if _, isBuiltin := builtins[componentName(name)]; isBuiltin {
+			return nil, fmt.Errorf("component %s is built in and cannot be redefined", name)
+		}
+	}
+	for name, spec := range builtins {
+		specs[name] = spec
+		loaded = append(loaded, name)
+	}
+
+	// Group the versions of each component
+	versions, err := indexComponentVersions(loaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components: %w", err)
+	}
+
+	// Parse the shell's document and the component templates once; every
+	// assembly works on copies of these trees
+	document, err := parseShellDocument(shell)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load shell: %w", err)
+	}
+	trees, err := parseComponents(components)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load components: %w", err)
 	}
 
 	// Initialize the validator
-	val, err := validator.New(schemaPath)
+	val, err := validator.NewFS(fsys, schemaPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize validator: %w", err)
 	}
 
-	return &Engine{
-		shell:      shell,
-		components: components,
-		validator:  val,
-	}, nil
+	engine := &Engine{
+		shell:            shell,
+		document:         document,
+		components:       components,
+		trees:            trees,
+		resources:        resources,
+		specs:            specs,
+		versions:         versions,
+		unlistedVersions: unlistedVersions(versions, val),
+		validator:        val,
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+
+	return engine, nil
 }
 
-// ValidatePlan validates a document plan using the CUE schema
+// ValidatePlan validates a document plan using the CUE schema, applying to
+// each component the rules of the version it resolves to
 func (e *Engine) ValidatePlan(plan map[string]interface{}) *validator.ValidationResult {
-	return e.validator.Validate(plan)
+	return e.validator.Validate(e.pinComponentVersions(plan))
 }
 
-// Assemble generates a DOCX document from the given plan
-func (e *Engine) Assemble(plan DocumentPlan) ([]byte, error) {
-	return e.AssembleDocument(plan)
+// Assemble generates a DOCX document from the given plan. The output is
+// byte-for-byte reproducible, so its hash identifies the document content.
+// In strict mode components with unresolved placeholders or unused props fail
+// the assembly with a *StrictRenderError listing all of them; otherwise these
+// are returned as warnings.
+func (e *Engine) Assemble(plan DocumentPlan, opts ...AssembleOption) (*AssembleResult, error) {
+	settings := assembleSettings{strict: e.strict}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	document, warnings, err := e.assemble(plan, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(document)
+	return &AssembleResult{
+		Document: document,
+		SHA256:   hex.EncodeToString(sum[:]),
+		Warnings: warnings,
+	}, nil
 }
 
-// GetLoadedComponents returns the names of all loaded components
+// GetLoadedComponents returns the names of all loaded components, without
+// their versions
 func (e *Engine) GetLoadedComponents() []string {
 	var names []string
-	for name := range e.components {
+	for name := range e.versions {
 		names = append(names, name)
 	}
 	return names
@@ -1,6 +1,9 @@
 package docgen
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // DocGenError represents errors that occur during document generation
 type DocGenError struct {
@@ -45,4 +48,75 @@ func (e *ShellLoadError) Error() string {
 
 func (e *ShellLoadError) Unwrap() error {
 	return e.Err
+}
+
+// SlotNotFoundError represents errors when a plan targets a slot the shell does not define
+type SlotNotFoundError struct {
+	SlotName string
+}
+
+func (e *SlotNotFoundError) Error() string {
+	return fmt.Sprintf("slot not found in shell: %s", e.SlotName)
+}
+
+// TemplateNotFoundError represents errors when a plan selects a template the
+// registry does not hold, or selects none and there is no default
+type TemplateNotFoundError struct {
+	TemplateName string
+	Available    []string
+}
+
+func (e *TemplateNotFoundError) Error() string {
+	if e.TemplateName == "" {
+		return fmt.Sprintf("no template selected; available templates: %s", strings.Join(e.Available, ", "))
+	}
+	return fmt.Sprintf("template not found: %s; available templates: %s", e.TemplateName, strings.Join(e.Available, ", "))
+}
+
+// TemplateMismatchError reports the placeholders a component instance left
+// unresolved and the props it was given but does not use. Strict mode returns
+// the mismatches of a plan together as a *StrictRenderError; otherwise each is
+// reported as a warning.
+type TemplateMismatchError struct {
+	Component  string   `json:"component"`
+	Index      int      `json:"index"`
+	Unresolved []string `json:"unresolved_placeholders,omitempty"`
+	Unused     []string `json:"unused_props,omitempty"`
+}
+
+func (e *TemplateMismatchError) Error() string {
+	var findings []string
+	if len(e.Unresolved) > 0 {
+		findings = append(findings, "unresolved placeholders "+strings.Join(e.Unresolved, ", "))
+	}
+	if len(e.Unused) > 0 {
+		findings = append(findings, "unused props "+strings.Join(e.Unused, ", "))
+	}
+	if e.Component == "" {
+		// Templates rendered outside a plan have no name or body index
+		return "component template: " + strings.Join(findings, "; ")
+	}
+	return fmt.Sprintf("component %s at body[%d]: %s", e.Component, e.Index, strings.Join(findings, "; "))
+}
+
+// StrictRenderError reports every template mismatch a strict assembly found,
+// in body order
+type StrictRenderError struct {
+	Mismatches []*TemplateMismatchError
+}
+
+func (e *StrictRenderError) Error() string {
+	messages := make([]string, len(e.Mismatches))
+	for i, mismatch := range e.Mismatches {
+		messages[i] = mismatch.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *StrictRenderError) Unwrap() []error {
+	errs := make([]error, len(e.Mismatches))
+	for i, mismatch := range e.Mismatches {
+		errs[i] = mismatch
+	}
+	return errs
 }
\ No newline at end of file
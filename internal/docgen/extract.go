@@ -0,0 +1,480 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Authors mark the components of a master document in Word, either with a
+// bookmark named Component_<Name> around the paragraphs and tables of the
+// component, or with a content control tagged component:<Name> around them.
+// Inside a component, the following become {{ prop }} placeholders:
+//
+//   - a content control with any other tag, named after the tag
+//   - «prop» text, as Word shows merge fields
+//   - a MERGEFIELD field
+//
+// Prop names are lowercased with underscores between words, so a content
+// control tagged "Tester Name" becomes {{ tester_name }}.
+
+const (
+	// componentBookmarkPrefix starts the names of bookmarks that mark components
+	componentBookmarkPrefix = "Component_"
+	// componentTagPrefix starts the tags of content controls that mark components
+	componentTagPrefix = "component:"
+)
+
+var (
+	// componentNamePattern matches the names components may be given
+	componentNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	// mergeFieldPattern matches a MERGEFIELD instruction and captures its field name
+	mergeFieldPattern = regexp.MustCompile(`^\s*MERGEFIELD\s+(?:"([^"]+)"|(\S+))`)
+	// propWordsPattern matches a placeholder body that is a name written as words
+	propWordsPattern = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9 _-]*?)\s*$`)
+	// propWordBoundary matches a lowercase letter or digit followed by a capital
+	propWordBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	// propNameSeparators matches the characters between the words of a prop name
+	propNameSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ExtractedComponent is a component cut out of a master document
+type ExtractedComponent struct {
+	Name string
+	// Template is the component XML, ready to be saved as <Name>.component.xml
+	Template string
+	// Props lists the props of the placeholders in order of first use
+	Props []string
+	// Styles lists the IDs of the styles the component uses
+	Styles []string
+	// NumIDs lists the numbering instances the component's lists use
+	NumIDs []string
+	// Relationships lists the relationships of word/document.xml the
+	// component refers to, such as hyperlinks and pictures
+	Relationships []Relationship
+}
+
+// ExtractComponents cuts the components marked in a master document out of
+// its body, in document order
+func ExtractComponents(docx InMemoryDocx) ([]*ExtractedComponent, error) {
+	documentXML, exists := docx["word/document.xml"]
+	if !exists {
+		return nil, fmt.Errorf("word/document.xml not found in document")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(documentXML); err != nil {
+		return nil, fmt.Errorf("failed to parse document.xml: %w", err)
+	}
+	body := doc.FindElement("//w:body")
+	if body == nil {
+		return nil, fmt.Errorf("w:body element not found in document.xml")
+	}
+
+	rels, err := docx.Relationships("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	relationships := make(map[string]Relationship)
+	for _, rel := range rels {
+		relationships[rel.ID] = rel
+	}
+
+	ranges, err := componentRanges(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var components []*ExtractedComponent
+	for _, r := range ranges {
+		component, err := extractComponent(r.name, r.blocks, relationships)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", r.name, err)
+		}
+		components = append(components, component)
+	}
+	return components, nil
+}
+
+// componentRange is a marked component and the body content it covers
+type componentRange struct {
+	name   string
+	blocks []*etree.Element
+	// position orders the ranges by where they start in the body
+	position int
+}
+
+// componentRanges finds the components marked by bookmarks and content
+// controls among the children of body
+func componentRanges(body *etree.Element) ([]componentRange, error) {
+	blocks := body.ChildElements()
+	index := make(map[*etree.Element]int)
+	for i, block := range blocks {
+		index[block] = i
+	}
+	// blockOf returns the position of the body child holding element
+	blockOf := func(element *etree.Element) int {
+		for element.Parent() != body {
+			element = element.Parent()
+		}
+		return index[element]
+	}
+
+	var ranges []componentRange
+	seen := make(map[string]bool)
+	add := func(name string, r componentRange) error {
+		if !componentNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid component name %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("component %s is marked more than once", name)
+		}
+		seen[name] = true
+		r.name = name
+		ranges = append(ranges, r)
+		return nil
+	}
+
+	ends := make(map[string]*etree.Element)
+	for _, end := range elementsInOrder(body, "w:bookmarkEnd") {
+		ends[end.SelectAttrValue("w:id", "")] = end
+	}
+	for _, start := range elementsInOrder(body, "w:bookmarkStart") {
+		name, isComponent := strings.CutPrefix(start.SelectAttrValue("w:name", ""), componentBookmarkPrefix)
+		if !isComponent {
+			continue
+		}
+		end, exists := ends[start.SelectAttrValue("w:id", "")]
+		if !exists {
+			return nil, fmt.Errorf("bookmark %s is not closed", componentBookmarkPrefix+name)
+		}
+		first, last := blockOf(start), blockOf(end)
+		if last < first {
+			return nil, fmt.Errorf("bookmark %s ends before it starts", componentBookmarkPrefix+name)
+		}
+		if err := add(name, componentRange{blocks: blocks[first : last+1], position: first}); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, block := range blocks {
+		name, isComponent := strings.CutPrefix(contentControlTag(block), componentTagPrefix)
+		if block.FullTag() != "w:sdt" || !isComponent {
+			continue
+		}
+		content := block.SelectElement("w:sdtContent")
+		if content == nil {
+			return nil, fmt.Errorf("content control %s has no content", componentTagPrefix+name)
+		}
+		if err := add(name, componentRange{blocks: content.ChildElements(), position: i}); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].position < ranges[j].position })
+	return ranges, nil
+}
+
+// contentControlTag returns the tag of a content control
+func contentControlTag(sdt *etree.Element) string {
+	if tag := sdt.FindElement("w:sdtPr/w:tag"); tag != nil {
+		return tag.SelectAttrValue("w:val", "")
+	}
+	return ""
+}
+
+// extractComponent turns a copy of the blocks of a component into its template
+func extractComponent(name string, blocks []*etree.Element, relationships map[string]Relationship) (*ExtractedComponent, error) {
+	fragment := etree.NewDocument()
+	if err := fragment.ReadFromString(fmt.Sprintf(componentWrapper, "")); err != nil {
+		return nil, err
+	}
+	root := fragment.Root()
+	for _, block := range blocks {
+		if block.FullTag() == "w:sectPr" {
+			continue
+		}
+		root.AddChild(block.Copy())
+	}
+
+	removeComponentMarkers(root)
+	removeGoBackBookmarks(root)
+	// A section break at the end of the range belongs to the master document
+	for _, sectPr := range root.FindElements(".//w:pPr/w:sectPr") {
+		sectPr.Parent().RemoveChild(sectPr)
+	}
+
+	if err := replacePropControls(root); err != nil {
+		return nil, err
+	}
+	for _, p := range elementsInOrder(root, "w:p") {
+		replaceMergeFields(p)
+	}
+	for _, t := range elementsInOrder(root, "w:t") {
+		text := strings.NewReplacer("«", "{{ ", "»", " }}").Replace(t.Text())
+		t.SetText(text)
+	}
+
+	// Merge the runs Word split the placeholders over, then settle the prop names
+	content, err := writeFragment(fragment)
+	if err != nil {
+		return nil, err
+	}
+	if content, err = normalizeComponent(content); err != nil {
+		return nil, err
+	}
+	normalized := etree.NewDocument()
+	if err := normalized.ReadFromString(fmt.Sprintf(componentWrapper, content)); err != nil {
+		return nil, err
+	}
+	root = normalized.Root()
+
+	component := &ExtractedComponent{Name: name}
+	seenProps := make(map[string]bool)
+	for _, t := range elementsInOrder(root, "w:t") {
+		text := placeholderPattern.ReplaceAllStringFunc(t.Text(), func(placeholder string) string {
+			words := propWordsPattern.FindStringSubmatch(placeholderPattern.FindStringSubmatch(placeholder)[1])
+			if words == nil {
+				return placeholder
+			}
+			prop := propName(words[1])
+			if !seenProps[prop] {
+				seenProps[prop] = true
+				component.Props = append(component.Props, prop)
+			}
+			return "{{ " + prop + " }}"
+		})
+		t.SetText(text)
+	}
+	if component.Template, err = writeFragment(normalized); err != nil {
+		return nil, err
+	}
+
+	styles := make(map[string]bool)
+	numIDs := make(map[string]bool)
+	relIDs := make(map[string]bool)
+	for _, element := range root.FindElements(".//*") {
+		switch element.FullTag() {
+		case "w:pStyle", "w:rStyle", "w:tblStyle":
+			styles[element.SelectAttrValue("w:val", "")] = true
+		case "w:numId":
+			if id := element.SelectAttrValue("w:val", ""); id != "0" {
+				numIDs[id] = true
+			}
+		}
+		for _, attr := range element.Attr {
+			if attr.Space == "r" {
+				relIDs[attr.Value] = true
+			}
+		}
+	}
+	component.Styles = sortedKeys(styles)
+	component.NumIDs = sortedKeys(numIDs)
+	for _, id := range sortedKeys(relIDs) {
+		rel, exists := relationships[id]
+		if !exists {
+			return nil, fmt.Errorf("relationship %s is not defined", id)
+		}
+		component.Relationships = append(component.Relationships, rel)
+	}
+
+	return component, nil
+}
+
+// removeComponentMarkers drops the bookmarks and unwraps the content controls
+// that mark components, including components nested in another
+func removeComponentMarkers(root *etree.Element) {
+	ids := make(map[string]bool)
+	for _, start := range root.FindElements(".//w:bookmarkStart") {
+		if strings.HasPrefix(start.SelectAttrValue("w:name", ""), componentBookmarkPrefix) {
+			ids[start.SelectAttrValue("w:id", "")] = true
+			start.Parent().RemoveChild(start)
+		}
+	}
+	for _, end := range root.FindElements(".//w:bookmarkEnd") {
+		if ids[end.SelectAttrValue("w:id", "")] {
+			end.Parent().RemoveChild(end)
+		}
+	}
+
+	for _, sdt := range root.FindElements(".//w:sdt") {
+		if !strings.HasPrefix(contentControlTag(sdt), componentTagPrefix) {
+			continue
+		}
+		if content := sdt.SelectElement("w:sdtContent"); content != nil {
+			for _, child := range content.ChildElements() {
+				sdt.Parent().InsertChild(sdt, child)
+			}
+		}
+		sdt.Parent().RemoveChild(sdt)
+	}
+}
+
+// replacePropControls replaces each tagged content control with a
+// placeholder for the prop its tag names. Untagged content controls, such as
+// those bound to document properties, are kept.
+func replacePropControls(root *etree.Element) error {
+	for _, sdt := range root.ChildElements() {
+		tag := contentControlTag(sdt)
+		if sdt.FullTag() != "w:sdt" || tag == "" {
+			if err := replacePropControls(sdt); err != nil {
+				return err
+			}
+			continue
+		}
+
+		prop := propName(tag)
+		if prop == "" {
+			return fmt.Errorf("content control tag %q does not name a prop", tag)
+		}
+		content := sdt.SelectElement("w:sdtContent")
+		if content == nil || len(content.ChildElements()) == 0 {
+			return fmt.Errorf("content control %q has no content", tag)
+		}
+
+		// The placeholder keeps the formatting of the control's value
+		placeholder := placeholderRun(controlRunProperties(sdt), prop)
+
+		var replacement *etree.Element
+		switch first := content.ChildElements()[0]; first.FullTag() {
+		case "w:p":
+			replacement = first
+			fillParagraph(replacement, []*etree.Element{placeholder})
+		case "w:tc":
+			replacement = first
+			paragraphs := replacement.SelectElements("w:p")
+			if len(paragraphs) == 0 {
+				return fmt.Errorf("content control %q holds a cell without a paragraph", tag)
+			}
+			for _, p := range paragraphs[1:] {
+				replacement.RemoveChild(p)
+			}
+			fillParagraph(paragraphs[0], []*etree.Element{placeholder})
+		case "w:tr", "w:tbl":
+			return fmt.Errorf("content control %q must hold text, a paragraph or a cell", tag)
+		default:
+			replacement = placeholder
+		}
+		sdt.Parent().InsertChild(sdt, replacement)
+		sdt.Parent().RemoveChild(sdt)
+	}
+	return nil
+}
+
+// placeholderRun returns a run holding the placeholder for a prop
+func placeholderRun(rPr *etree.Element, prop string) *etree.Element {
+	run := etree.NewElement("w:r")
+	if rPr != nil {
+		run.AddChild(rPr.Copy())
+	}
+	addRunText(run, "{{ "+prop+" }}")
+	return run
+}
+
+// replaceMergeFields replaces the MERGEFIELD fields of a paragraph, simple or
+// spread over runs, with placeholders
+func replaceMergeFields(p *etree.Element) {
+	for _, field := range p.SelectElements("w:fldSimple") {
+		if match := mergeFieldPattern.FindStringSubmatch(field.SelectAttrValue("w:instr", "")); match != nil {
+			var rPr *etree.Element
+			if run := field.SelectElement("w:r"); run != nil {
+				rPr = run.SelectElement("w:rPr")
+			}
+			p.InsertChild(field, placeholderRun(rPr, match[1]+match[2]))
+			p.RemoveChild(field)
+		}
+	}
+
+	// A complex field runs from a begin to an end fldChar, with the instruction
+	// before the separate fldChar and the displayed result after it
+	var fieldRuns []*etree.Element
+	var instruction strings.Builder
+	var resultRPr *etree.Element
+	depth := 0
+	inResult := false
+	for _, run := range p.SelectElements("w:r") {
+		fldChar := run.SelectElement("w:fldChar")
+		fldType := ""
+		if fldChar != nil {
+			fldType = fldChar.SelectAttrValue("w:fldCharType", "")
+		}
+		if depth == 0 && fldType != "begin" {
+			continue
+		}
+		fieldRuns = append(fieldRuns, run)
+
+		switch fldType {
+		case "begin":
+			depth++
+			if depth == 1 {
+				instruction.Reset()
+				resultRPr = run.SelectElement("w:rPr")
+				inResult = false
+			}
+		case "separate":
+			inResult = depth == 1
+		case "end":
+			depth--
+		default:
+			if depth == 1 && !inResult {
+				for _, instr := range run.SelectElements("w:instrText") {
+					instruction.WriteString(instr.Text())
+				}
+			}
+			if inResult && run.SelectElement("w:t") != nil && run.SelectElement("w:rPr") != nil {
+				resultRPr = run.SelectElement("w:rPr")
+			}
+		}
+
+		if depth == 0 {
+			if match := mergeFieldPattern.FindStringSubmatch(instruction.String()); match != nil {
+				p.InsertChild(fieldRuns[0], placeholderRun(resultRPr, match[1]+match[2]))
+				for _, fieldRun := range fieldRuns {
+					p.RemoveChild(fieldRun)
+				}
+			}
+			fieldRuns = nil
+		}
+	}
+}
+
+// propName turns a tag, field name or «text» into a prop name: lowercase
+// words joined by underscores
+func propName(text string) string {
+	text = propWordBoundary.ReplaceAllString(text, "${1}_${2}")
+	return strings.Trim(propNameSeparators.ReplaceAllString(strings.ToLower(text), "_"), "_")
+}
+
+// Schema returns a starter CUE definition of the component's props, which
+// accepts any non-empty text for each
+func (c *ExtractedComponent) Schema() string {
+	var schema strings.Builder
+	fmt.Fprintf(&schema, "package docgen\n\n")
+	fmt.Fprintf(&schema, "// Props of the %s component. Add %q to #AllComponentNames\n", c.Name, c.Name)
+	fmt.Fprintf(&schema, "// and check its props in #ComponentInstance:\n//\n")
+	fmt.Fprintf(&schema, "//\tif component == %q {\n//\t\tprops: #%s\n//\t}\n", c.Name, c.Name)
+	fmt.Fprintf(&schema, "#%s: {\n", c.Name)
+	width := 0
+	for _, prop := range c.Props {
+		width = max(width, len(prop)+1)
+	}
+	for _, prop := range c.Props {
+		fmt.Fprintf(&schema, "\t%-*s string & !=\"\"\n", width, prop+":")
+	}
+	fmt.Fprintf(&schema, "}\n")
+	return schema.String()
+}
+
+// sortedKeys returns the non-empty keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,222 @@
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Content types of header and footer parts
+const (
+	headerContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.header+xml"
+	footerContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.footer+xml"
+)
+
+const wordprocessingNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// pageFieldPattern matches the placeholders that become page number fields
+var pageFieldPattern = regexp.MustCompile(`\{\{\s*(page|pages)\s*\}\}`)
+
+// pageFieldInstructions maps page field placeholders to Word field codes
+var pageFieldInstructions = map[string]string{
+	"page":  "PAGE",
+	"pages": "NUMPAGES",
+}
+
+// UnmarshalJSON accepts either a header/footer object or a plain string
+func (h *HeaderFooter) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*h = HeaderFooter{Text: text}
+		return nil
+	}
+
+	type plain HeaderFooter
+	return json.Unmarshal(data, (*plain)(h))
+}
+
+// headerFooterKind describes how a header or a footer is stored in the package
+type headerFooterKind struct {
+	name        string
+	root        string
+	reference   string
+	relType     string
+	contentType string
+	style       string
+}
+
+var (
+	headerKind = headerFooterKind{"header", "w:hdr", "w:headerReference", RelTypeHeader, headerContentType, "Header"}
+	footerKind = headerFooterKind{"footer", "w:ftr", "w:footerReference", RelTypeFooter, footerContentType, "Footer"}
+)
+
+// writeHeadersAndFooters creates the plan's header and footer parts and
+// references them from every section of the document
+func (a *assembly) writeHeadersAndFooters(plan DocumentPlan, settings assembleSettings) error {
+	if plan.DocProps.Header == nil && plan.DocProps.Footer == nil {
+		return nil
+	}
+
+	scope, err := a.headerFooterProps(plan)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range []struct {
+		kind headerFooterKind
+		hf   *HeaderFooter
+	}{
+		{headerKind, plan.DocProps.Header},
+		{footerKind, plan.DocProps.Footer},
+	} {
+		if part.hf == nil {
+			continue
+		}
+		if err := a.addHeaderFooter(part.kind, part.hf, scope, settings); err != nil {
+			return fmt.Errorf("failed to write %s: %w", part.kind.name, err)
+		}
+	}
+	return nil
+}
+
+// headerFooterProps collects the values header and footer templates may use:
+// the core document properties and the props of the first instance of each
+// body component
+func (a *assembly) headerFooterProps(plan DocumentPlan) (map[string]interface{}, error) {
+	values, err := a.corePropertyValues(plan.DocProps)
+	if err != nil {
+		return nil, err
+	}
+
+	props := make(map[string]interface{})
+	for name, value := range values {
+		props[name] = value
+	}
+	for _, instance := range plan.Body {
+		// Every version of a component is referenced by its name
+		name := componentName(instance.Component)
+		if _, exists := props[name]; !exists {
+			props[name] = instance.Props
+		}
+	}
+	return props, nil
+}
+
+// addHeaderFooter renders a header or footer into a new part and makes it the
+// default header or footer of every section
+func (a *assembly) addHeaderFooter(kind headerFooterKind, hf *HeaderFooter, props map[string]interface{}, settings assembleSettings) error {
+	switch hf.Align {
+	case "", "left", "center", "right":
+	default:
+		return fmt.Errorf("align must be left, center or right, got %q", hf.Align)
+	}
+
+	wrapper := etree.NewElement("temp")
+	wrapper.AddChild(headerFooterParagraph(kind, hf))
+
+	report, err := renderTemplate(wrapper, props, templateContext{})
+	if err != nil {
+		return err
+	}
+	if settings.strict && len(report.unresolved) > 0 {
+		return fmt.Errorf("unresolved placeholders %s", strings.Join(report.unresolved, ", "))
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8" standalone="yes"`)
+	root := doc.CreateElement(kind.root)
+	root.CreateAttr("xmlns:w", wordprocessingNamespace)
+	root.CreateAttr("xmlns:r", "http://schemas.openxmlformats.org/officeDocument/2006/relationships")
+	for _, child := range wrapper.ChildElements() {
+		root.AddChild(child)
+	}
+	content, err := doc.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", kind.name, err)
+	}
+
+	// Use the first free word/headerN.xml or word/footerN.xml
+	var part string
+	for n := 1; ; n++ {
+		part = fmt.Sprintf("word/%s%d.xml", kind.name, n)
+		if _, exists := a.docx[part]; !exists {
+			break
+		}
+	}
+	a.docx[part] = content
+
+	if err := a.docx.AddOverrideContentType(part, kind.contentType); err != nil {
+		return err
+	}
+	id, err := a.docx.AddRelationship("word/document.xml", Relationship{
+		Type:   kind.relType,
+		Target: strings.TrimPrefix(part, "word/"),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sectPr := range a.body.FindElements(".//w:sectPr") {
+		setHeaderFooterReference(sectPr, kind, id)
+	}
+	return nil
+}
+
+// headerFooterParagraph builds the paragraph of a header or footer, with the
+// page number placeholders replaced by fields
+func headerFooterParagraph(kind headerFooterKind, hf *HeaderFooter) *etree.Element {
+	p := etree.NewElement("w:p")
+	setParagraphStyle(p, kind.style)
+	if hf.Align != "" {
+		p.SelectElement("w:pPr").CreateElement("w:jc").CreateAttr("w:val", hf.Align)
+	}
+
+	text := hf.Text
+	last := 0
+	addText := func(segment string) {
+		if segment == "" {
+			return
+		}
+		run := p.CreateElement("w:r")
+		addSpanText(run, segment)
+	}
+	for _, match := range pageFieldPattern.FindAllStringSubmatchIndex(text, -1) {
+		addText(text[last:match[0]])
+		field := p.CreateElement("w:fldSimple")
+		field.CreateAttr("w:instr", " "+pageFieldInstructions[text[match[2]:match[3]]]+" ")
+		run := field.CreateElement("w:r")
+		run.CreateElement("w:rPr").CreateElement("w:noProof")
+		run.CreateElement("w:t").SetText("1")
+		last = match[1]
+	}
+	addText(text[last:])
+
+	return p
+}
+
+// setHeaderFooterReference makes a part the default header or footer of a
+// section, keeping header references ahead of footer references
+func setHeaderFooterReference(sectPr *etree.Element, kind headerFooterKind, id string) {
+	for _, existing := range sectPr.SelectElements(kind.reference) {
+		if existing.SelectAttrValue("w:type", "") == "default" {
+			sectPr.RemoveChild(existing)
+		}
+	}
+
+	reference := etree.NewElement(kind.reference)
+	reference.CreateAttr("w:type", "default")
+	reference.CreateAttr("r:id", id)
+
+	for _, child := range sectPr.ChildElements() {
+		tag := child.FullTag()
+		if tag == "w:headerReference" || (kind == footerKind && tag == "w:footerReference") {
+			continue
+		}
+		sectPr.InsertChild(child, reference)
+		return
+	}
+	sectPr.AddChild(reference)
+}
@@ -0,0 +1,179 @@
+package docgen
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/beevik/etree"
+)
+
+// uniquifyIDs rewrites the identifiers in document.xml that Word expects to be
+// unique, which repeated component instances would otherwise duplicate. The
+// first occurrence of a value is kept and later duplicates are renumbered.
+func (a *assembly) uniquifyIDs() {
+	root := a.doc.Root()
+
+	removeGoBackBookmarks(root)
+	renumberBookmarks(root)
+
+	// Content control IDs
+	uniquifyAttr(root.FindElements("//w:sdtPr/w:id"), "w:val", decimalID)
+	// Paragraph and row revision IDs must stay below 0x80000000
+	uniquifyAttr(root.FindElements("//*[@w14:paraId]"), "w14:paraId", hexID)
+	uniquifyAttr(root.FindElements("//*[@w14:textId]"), "w14:textId", hexID)
+	// Drawing object IDs
+	uniquifyAttr(root.FindElements("//wp:docPr"), "id", decimalID)
+
+	removeDanglingPlaceholders(root, a.glossaryDocParts())
+}
+
+// decimalID formats a positive decimal identifier
+func decimalID(n int) string {
+	return strconv.Itoa(n)
+}
+
+// hexID formats an identifier as eight hexadecimal digits
+func hexID(n int) string {
+	return fmt.Sprintf("%08X", n)
+}
+
+// uniquifyAttr gives every element a distinct value for attr. Values are
+// allocated from a counter so the result is the same on every run.
+func uniquifyAttr(elements []*etree.Element, attr string, format func(int) string) {
+	used := make(map[string]bool)
+	for _, element := range elements {
+		used[element.SelectAttrValue(attr, "")] = true
+	}
+
+	seen := make(map[string]bool)
+	next := 1
+	for _, element := range elements {
+		value := element.SelectAttrValue(attr, "")
+		if !seen[value] {
+			seen[value] = true
+			continue
+		}
+
+		for used[format(next)] {
+			next++
+		}
+		value = format(next)
+		used[value] = true
+		seen[value] = true
+		element.CreateAttr(attr, value)
+	}
+}
+
+// removeGoBackBookmarks drops Word's _GoBack bookmarks, which mark the last
+// edit position and are copied into every component exported from Word
+func removeGoBackBookmarks(root *etree.Element) {
+	pending := make(map[string]int)
+
+	for _, element := range elementsInOrder(root, "w:bookmarkStart", "w:bookmarkEnd") {
+		switch element.FullTag() {
+		case "w:bookmarkStart":
+			if element.SelectAttrValue("w:name", "") != "_GoBack" {
+				continue
+			}
+			pending[element.SelectAttrValue("w:id", "")]++
+			element.Parent().RemoveChild(element)
+		case "w:bookmarkEnd":
+			id := element.SelectAttrValue("w:id", "")
+			if pending[id] == 0 {
+				continue
+			}
+			pending[id]--
+			element.Parent().RemoveChild(element)
+		}
+	}
+}
+
+// renumberBookmarks makes bookmark IDs and names unique. A renumbered
+// bookmarkStart carries its new ID to the next bookmarkEnd with the old ID.
+func renumberBookmarks(root *etree.Element) {
+	bookmarks := elementsInOrder(root, "w:bookmarkStart", "w:bookmarkEnd")
+
+	usedIDs := make(map[string]bool)
+	usedNames := make(map[string]bool)
+	for _, element := range bookmarks {
+		switch element.FullTag() {
+		case "w:bookmarkStart":
+			usedIDs[element.SelectAttrValue("w:id", "")] = true
+			usedNames[element.SelectAttrValue("w:name", "")] = true
+		case "w:bookmarkEnd":
+			usedIDs[element.SelectAttrValue("w:id", "")] = true
+		}
+	}
+
+	seenIDs := make(map[string]bool)
+	seenNames := make(map[string]bool)
+	remapped := make(map[string][]string)
+	next := 1
+
+	for _, element := range bookmarks {
+		switch element.FullTag() {
+		case "w:bookmarkStart":
+			id := element.SelectAttrValue("w:id", "")
+			if seenIDs[id] {
+				for usedIDs[decimalID(next)] {
+					next++
+				}
+				newID := decimalID(next)
+				usedIDs[newID] = true
+				remapped[id] = append(remapped[id], newID)
+				element.CreateAttr("w:id", newID)
+				id = newID
+			}
+			seenIDs[id] = true
+
+			name := element.SelectAttrValue("w:name", "")
+			if seenNames[name] {
+				newName := name
+				for suffix := 2; usedNames[newName]; suffix++ {
+					newName = fmt.Sprintf("%s_%d", name, suffix)
+				}
+				usedNames[newName] = true
+				element.CreateAttr("w:name", newName)
+				name = newName
+			}
+			seenNames[name] = true
+		case "w:bookmarkEnd":
+			id := element.SelectAttrValue("w:id", "")
+			if queue := remapped[id]; len(queue) > 0 {
+				element.CreateAttr("w:id", queue[0])
+				remapped[id] = queue[1:]
+			}
+		}
+	}
+}
+
+// removeDanglingPlaceholders drops content control placeholder references to
+// building blocks that the document's glossary does not define
+func removeDanglingPlaceholders(root *etree.Element, docParts map[string]bool) {
+	for _, placeholder := range root.FindElements("//w:sdtPr/w:placeholder") {
+		docPart := placeholder.SelectElement("w:docPart")
+		if docPart != nil && docParts[docPart.SelectAttrValue("w:val", "")] {
+			continue
+		}
+		placeholder.Parent().RemoveChild(placeholder)
+	}
+}
+
+// glossaryDocParts returns the names of the building blocks in the document's glossary
+func (a *assembly) glossaryDocParts() map[string]bool {
+	docParts := make(map[string]bool)
+
+	content, exists := a.docx["word/glossary/document.xml"]
+	if !exists {
+		return docParts
+	}
+
+	glossary := etree.NewDocument()
+	if err := glossary.ReadFromBytes(content); err != nil {
+		return docParts
+	}
+	for _, name := range glossary.FindElements("//w:docPartPr/w:name") {
+		docParts[name.SelectAttrValue("w:val", "")] = true
+	}
+	return docParts
+}
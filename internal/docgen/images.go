@@ -0,0 +1,294 @@
+package docgen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	// RelTypeImage is the relationship type for embedded pictures
+	RelTypeImage = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+
+	// emuPerPixel converts pixels at 96 DPI to English Metric Units
+	emuPerPixel = 9525
+	// emuPerTwip converts twentieths of a point to English Metric Units
+	emuPerTwip = 635
+	// defaultTextWidthEMU is a 6.5in text column, used if the shell has no page setup
+	defaultTextWidthEMU = 5943600
+)
+
+// imageContentTypes lists the image formats that may be embedded, by extension
+var imageContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+}
+
+// mediaNameUnsafe matches characters not kept in word/media file names
+var mediaNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// imageProp is an image prop value resolved to its bytes
+type imageProp struct {
+	filename  string
+	extension string
+	data      []byte
+	altText   string
+	autoSize  bool
+}
+
+// embeddedImage records an image already written to word/media
+type embeddedImage struct {
+	relID  string
+	width  int
+	height int
+}
+
+// parseImageProp decodes an image prop: {"filename", "content_base64"} for
+// inline data or {"path"} for a file in the engine's media directory, plus
+// optional "alt_text" and "auto_size"
+func (a *assembly) parseImageProp(propName string, value interface{}) (*imageProp, error) {
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("image prop %q must be an object with content_base64 or path", propName)
+	}
+
+	img := &imageProp{}
+	if altText, ok := fields["alt_text"].(string); ok {
+		img.altText = altText
+	}
+	if autoSize, ok := fields["auto_size"].(bool); ok {
+		img.autoSize = autoSize
+	}
+
+	encoded, hasContent := fields["content_base64"].(string)
+	assetPath, hasPath := fields["path"].(string)
+
+	switch {
+	case hasContent && hasPath:
+		return nil, fmt.Errorf("image prop %q must set only one of content_base64 and path", propName)
+	case hasContent:
+		filename, _ := fields["filename"].(string)
+		if filename == "" {
+			return nil, fmt.Errorf("image prop %q requires a filename with content_base64", propName)
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("image prop %q has invalid base64 content: %w", propName, err)
+		}
+		img.filename = path.Base(filepath.ToSlash(filename))
+		img.data = data
+	case hasPath:
+		data, err := a.engine.readMediaFile(assetPath)
+		if err != nil {
+			return nil, fmt.Errorf("image prop %q: %w", propName, err)
+		}
+		img.filename = path.Base(filepath.ToSlash(assetPath))
+		if filename, ok := fields["filename"].(string); ok && filename != "" {
+			img.filename = path.Base(filepath.ToSlash(filename))
+		}
+		img.data = data
+	default:
+		return nil, fmt.Errorf("image prop %q must set content_base64 or path", propName)
+	}
+
+	img.extension = strings.ToLower(strings.TrimPrefix(path.Ext(img.filename), "."))
+	if _, supported := imageContentTypes[img.extension]; !supported {
+		return nil, fmt.Errorf("image prop %q has unsupported file type %q", propName, img.extension)
+	}
+	if img.altText == "" {
+		img.altText = img.filename
+	}
+
+	return img, nil
+}
+
+// readMediaFile reads an image referenced by a path relative to the media directory
+func (e *Engine) readMediaFile(assetPath string) ([]byte, error) {
+	if e.media == nil {
+		return nil, fmt.Errorf("image paths are not enabled: no media directory configured")
+	}
+	if !filepath.IsLocal(assetPath) {
+		return nil, fmt.Errorf("image path %q must be relative to the media directory", assetPath)
+	}
+
+	data, err := fs.ReadFile(e.media, filepath.ToSlash(assetPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %q: %w", assetPath, err)
+	}
+	return data, nil
+}
+
+// imagePlaceholder returns the template function for {{rId:<prop>}}, which
+// embeds the prop's image and resolves to its relationship ID. Images to be
+// auto-sized are recorded in autoSized by relationship ID.
+func (a *assembly) imagePlaceholder(autoSized map[string]*embeddedImage) templateFunc {
+	return func(args []string, scope *templateScope) (string, error) {
+		img, err := a.lookupImage(args, scope)
+		if err != nil {
+			return "", err
+		}
+		embedded, err := a.embedImage(img)
+		if err != nil {
+			return "", err
+		}
+		if img.autoSize {
+			autoSized[embedded.relID] = embedded
+		}
+		return embedded.relID, nil
+	}
+}
+
+// imageAltTextPlaceholder resolves {{prop:<prop>}} to an image prop's alt text
+func (a *assembly) imageAltTextPlaceholder(args []string, scope *templateScope) (string, error) {
+	img, err := a.lookupImage(args, scope)
+	if err != nil {
+		return "", err
+	}
+	return img.altText, nil
+}
+
+// lookupImage parses the image prop named by an image placeholder
+func (a *assembly) lookupImage(args []string, scope *templateScope) (*imageProp, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("image placeholder must name a single prop, got %q", strings.Join(args, ":"))
+	}
+	value, ok := scope.lookup(args[0])
+	if !ok || value == nil {
+		return nil, fmt.Errorf("image placeholder requires prop %q", args[0])
+	}
+	return a.parseImageProp(args[0], value)
+}
+
+// embedImage writes an image to word/media, registers its content type and
+// relationship, and returns the embedding. Identical images are stored once.
+func (a *assembly) embedImage(img *imageProp) (*embeddedImage, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256(img.data))
+	if embedded, exists := a.images[key]; exists {
+		return embedded, nil
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(img.data))
+	if err != nil && img.extension != "bmp" {
+		return nil, fmt.Errorf("failed to decode image %s: %w", img.filename, err)
+	}
+	if err == nil && imageContentTypes[img.extension] != "image/"+format {
+		return nil, fmt.Errorf("image %s is %s data, not %s", img.filename, format, img.extension)
+	}
+	if img.autoSize && (config.Width == 0 || config.Height == 0) {
+		return nil, fmt.Errorf("image %s: auto_size requires an image with readable pixel dimensions", img.filename)
+	}
+
+	mediaName := a.uniqueMediaName(img.filename)
+	a.docx["word/media/"+mediaName] = img.data
+
+	if err := a.docx.AddDefaultContentType(img.extension, imageContentTypes[img.extension]); err != nil {
+		return nil, err
+	}
+
+	relID, err := a.docx.AddRelationship("word/document.xml", Relationship{
+		Type:   RelTypeImage,
+		Target: "media/" + mediaName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	embedded := &embeddedImage{relID: relID, width: config.Width, height: config.Height}
+	a.images[key] = embedded
+	return embedded, nil
+}
+
+// uniqueMediaName returns a word/media file name based on filename that is not yet taken
+func (a *assembly) uniqueMediaName(filename string) string {
+	ext := path.Ext(filename)
+	base := mediaNameUnsafe.ReplaceAllString(strings.TrimSuffix(filename, ext), "_")
+	if base == "" {
+		base = "image"
+	}
+	ext = strings.ToLower(ext)
+
+	name := base + ext
+	for n := 2; ; n++ {
+		if _, exists := a.docx["word/media/"+name]; !exists {
+			return name
+		}
+		name = base + "_" + strconv.Itoa(n) + ext
+	}
+}
+
+// applyImageSizes sets the extent of auto-sized images in a rendered fragment
+// to their pixel dimensions at 96 DPI, scaled down to fit the text column
+func (a *assembly) applyImageSizes(root *etree.Element, autoSized map[string]*embeddedImage) {
+	if len(autoSized) == 0 {
+		return
+	}
+
+	maxWidth := a.textWidthEMU()
+	for _, blip := range root.FindElements(".//a:blip") {
+		embedded, exists := autoSized[blip.SelectAttrValue("r:embed", "")]
+		if !exists {
+			continue
+		}
+
+		cx := int64(embedded.width) * emuPerPixel
+		cy := int64(embedded.height) * emuPerPixel
+		if cx > maxWidth {
+			cy = cy * maxWidth / cx
+			cx = maxWidth
+		}
+
+		// Walk up to the drawing container that owns the extent
+		for container := blip.Parent(); container != nil; container = container.Parent() {
+			if container.Space != "wp" || (container.Tag != "inline" && container.Tag != "anchor") {
+				continue
+			}
+			if extent := container.SelectElement("wp:extent"); extent != nil {
+				extent.CreateAttr("cx", strconv.FormatInt(cx, 10))
+				extent.CreateAttr("cy", strconv.FormatInt(cy, 10))
+			}
+			for _, ext := range container.FindElements(".//a:xfrm/a:ext") {
+				ext.CreateAttr("cx", strconv.FormatInt(cx, 10))
+				ext.CreateAttr("cy", strconv.FormatInt(cy, 10))
+			}
+			break
+		}
+	}
+}
+
+// textWidthEMU returns the width of the text column of the body's final section
+func (a *assembly) textWidthEMU() int64 {
+	sectPr := a.body.SelectElement("w:sectPr")
+	if sectPr == nil {
+		return defaultTextWidthEMU
+	}
+
+	pgSz := sectPr.SelectElement("w:pgSz")
+	pgMar := sectPr.SelectElement("w:pgMar")
+	if pgSz == nil || pgMar == nil {
+		return defaultTextWidthEMU
+	}
+
+	width, errW := strconv.ParseInt(pgSz.SelectAttrValue("w:w", ""), 10, 64)
+	left, errL := strconv.ParseInt(pgMar.SelectAttrValue("w:left", "0"), 10, 64)
+	right, errR := strconv.ParseInt(pgMar.SelectAttrValue("w:right", "0"), 10, 64)
+	if errW != nil || errL != nil || errR != nil || width-left-right <= 0 {
+		return defaultTextWidthEMU
+	}
+	return (width - left - right) * emuPerTwip
+}
@@ -0,0 +1,195 @@
+package docgen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/beevik/etree"
+)
+
+// numberingPart is the package part holding the shell's list definitions
+const numberingPart = "word/numbering.xml"
+
+// maxListLevel is the deepest w:ilvl a numbering definition has
+const maxListLevel = 8
+
+// ListSpec is the metadata of a list component. Each element of the items
+// prop becomes a bulleted or numbered paragraph: a string, rich text, or an
+// object with "text" and nested "items" one level deeper.
+type ListSpec struct {
+	// Type must be "list"
+	Type string `json:"type"`
+	// ItemsProp names the array prop whose elements become the list items
+	ItemsProp string `json:"items_prop"`
+	// AbstractNumID selects the w:abstractNum in the shell's numbering.xml
+	// that formats the list
+	AbstractNumID int `json:"abstract_num_id"`
+	// Style is the paragraph style of the items
+	Style string `json:"style,omitempty"`
+}
+
+// parseListSpec reads and checks list component metadata
+func parseListSpec(content []byte) (*ListSpec, error) {
+	var spec ListSpec
+	if err := decodeMetadata(content, &spec); err != nil {
+		return nil, err
+	}
+
+	if !propNamePattern.MatchString(spec.ItemsProp) {
+		return nil, fmt.Errorf("items_prop %q is not a prop name", spec.ItemsProp)
+	}
+	if spec.AbstractNumID < 0 {
+		return nil, fmt.Errorf("abstract_num_id must not be negative")
+	}
+
+	return &spec, nil
+}
+
+// build renders the list for a component instance. Every instance gets a
+// numbering instance of its own, so numbered lists restart at 1.
+func (spec *ListSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	value, report := arrayPropReport(props, spec.ItemsProp)
+	items, err := loopItems(spec.ItemsProp, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(items) == 0 {
+		return nil, report, nil
+	}
+
+	numID, err := a.addNumberingInstance(spec.AbstractNumID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &templateRenderer{templateContext: a.spanContext(), seen: make(map[string]bool)}
+	var paragraphs []*etree.Element
+	if err := spec.addItems(r, &paragraphs, items, 0, numID, spec.ItemsProp); err != nil {
+		return nil, nil, err
+	}
+	return paragraphs, report, nil
+}
+
+// addItems appends a paragraph for every item and, after each, the
+// paragraphs of its nested items
+func (spec *ListSpec) addItems(r *templateRenderer, paragraphs *[]*etree.Element, items []interface{}, level int, numID string, path string) error {
+	if level > maxListLevel {
+		return fmt.Errorf("%s nests deeper than %d levels", path, maxListLevel+1)
+	}
+
+	for i, item := range items {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		text, children, err := listItemContent(item)
+		if err != nil {
+			return fmt.Errorf("%s: %w", itemPath, err)
+		}
+
+		p := etree.NewElement("w:p")
+		if spec.Style != "" {
+			setParagraphStyle(p, spec.Style)
+		}
+		pPr := p.SelectElement("w:pPr")
+		if pPr == nil {
+			pPr = p.CreateElement("w:pPr")
+		}
+		numPr := pPr.CreateElement("w:numPr")
+		numPr.CreateElement("w:ilvl").CreateAttr("w:val", strconv.Itoa(level))
+		numPr.CreateElement("w:numId").CreateAttr("w:val", numID)
+
+		runs, err := r.valueRuns(text, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", itemPath, err)
+		}
+		for _, run := range runs {
+			p.AddChild(run)
+		}
+		*paragraphs = append(*paragraphs, p)
+
+		if err := spec.addItems(r, paragraphs, children, level+1, numID, itemPath+".items"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listItemContent splits a list item into its text and nested items
+func listItemContent(item interface{}) (interface{}, []interface{}, error) {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return item, nil, nil
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key != "text" && key != "items" {
+			return nil, nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	children, err := loopItems("items", fields["items"])
+	if err != nil {
+		return nil, nil, err
+	}
+	return fields["text"], children, nil
+}
+
+// addNumberingInstance adds a w:num for an abstract numbering definition to
+// numbering.xml and returns its ID. The level 0 start override makes the new
+// instance count from the start instead of continuing earlier lists.
+func (a *assembly) addNumberingInstance(abstractNumID int) (string, error) {
+	if _, exists := a.docx[numberingPart]; !exists {
+		return "", fmt.Errorf("lists require %s in the shell document", numberingPart)
+	}
+
+	abstractID := strconv.Itoa(abstractNumID)
+	var numID string
+	err := a.docx.updatePart(numberingPart, func(root *etree.Element) error {
+		defined := false
+		for _, abstract := range root.SelectElements("w:abstractNum") {
+			if abstract.SelectAttrValue("w:abstractNumId", "") == abstractID {
+				defined = true
+			}
+		}
+		if !defined {
+			return fmt.Errorf("abstract numbering %d is not defined in %s", abstractNumID, numberingPart)
+		}
+
+		highest := 0
+		for _, existing := range root.SelectElements("w:num") {
+			if n, err := strconv.Atoi(existing.SelectAttrValue("w:numId", "")); err == nil && n > highest {
+				highest = n
+			}
+		}
+		numID = strconv.Itoa(highest + 1)
+
+		num := etree.NewElement("w:num")
+		num.CreateAttr("w:numId", numID)
+		num.CreateElement("w:abstractNumId").CreateAttr("w:val", abstractID)
+		override := num.CreateElement("w:lvlOverride")
+		override.CreateAttr("w:ilvl", "0")
+		override.CreateElement("w:startOverride").CreateAttr("w:val", "1")
+
+		insertNumberingInstance(root, num)
+		return nil
+	})
+	return numID, err
+}
+
+// insertNumberingInstance adds a w:num to numbering.xml after the existing
+// ones, which follow the abstract definitions and precede numIdMacAtCleanup
+func insertNumberingInstance(root, num *etree.Element) {
+	nums := root.SelectElements("w:num")
+	switch cleanup := root.SelectElement("w:numIdMacAtCleanup"); {
+	case len(nums) > 0:
+		root.InsertChildAt(nums[len(nums)-1].Index()+1, num)
+	case cleanup != nil:
+		root.InsertChild(cleanup, num)
+	default:
+		root.AddChild(num)
+	}
+}
@@ -0,0 +1,109 @@
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// ComponentSpec is a component the engine builds from <Name>.component.json
+// metadata instead of rendering an XML template. The metadata's "type" field
+// selects the kind of component.
+type ComponentSpec interface {
+	// build renders the component for an instance's props
+	build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error)
+}
+
+// LoadComponentSpecs loads all .component.json component definitions from the
+// specified directory
+func LoadComponentSpecs(componentsDir string) (map[string]ComponentSpec, error) {
+	return LoadComponentSpecsFS(osFS{}, filepath.ToSlash(componentsDir))
+}
+
+// LoadComponentSpecsFS loads all .component.json component definitions from
+// the directory componentsDir of fsys
+func LoadComponentSpecsFS(fsys fs.FS, componentsDir string) (map[string]ComponentSpec, error) {
+	specs := make(map[string]ComponentSpec)
+
+	err := fs.WalkDir(fsys, componentsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".component.json") {
+			componentName := strings.TrimSuffix(entry.Name(), ".component.json")
+
+			content, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return fmt.Errorf("failed to read component %s: %w", componentName, err)
+			}
+
+			spec, err := parseComponentSpec(content)
+			if err != nil {
+				return fmt.Errorf("invalid component %s: %w", componentName, err)
+			}
+			specs[componentName] = spec
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load components from %s: %w", componentsDir, err)
+	}
+
+	return specs, nil
+}
+
+// parseComponentSpec reads component metadata according to its type
+func parseComponentSpec(content []byte) (ComponentSpec, error) {
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+
+	switch header.Type {
+	case "table":
+		return parseTableSpec(content)
+	case "list":
+		return parseListSpec(content)
+	default:
+		return nil, fmt.Errorf("unsupported component type %q", header.Type)
+	}
+}
+
+// decodeMetadata decodes component metadata, rejecting unknown fields
+func decodeMetadata(content []byte, spec interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(spec); err != nil {
+		return fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return nil
+}
+
+// arrayPropReport returns the value of the array prop a built component
+// renders, reporting the prop as unresolved when it is missing and every other
+// prop as unused
+func arrayPropReport(props map[string]interface{}, name string) (interface{}, *templateReport) {
+	report := &templateReport{}
+	for prop := range props {
+		if prop != name {
+			report.unused = append(report.unused, prop)
+		}
+	}
+	sort.Strings(report.unused)
+
+	value, exists := props[name]
+	if !exists || value == nil {
+		report.unresolved = append(report.unresolved, "{{ "+name+" }}")
+	}
+	return value, report
+}
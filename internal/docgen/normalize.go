@@ -0,0 +1,243 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// rsidAttributes are the revision session IDs Word stamps on paragraphs, runs
+// and rows. They only matter to Word's merge feature and keep otherwise
+// identical runs apart.
+var rsidAttributes = map[string]bool{
+	"w:rsidR":        true,
+	"w:rsidRPr":      true,
+	"w:rsidRDefault": true,
+	"w:rsidP":        true,
+	"w:rsidDel":      true,
+	"w:rsidSect":     true,
+	"w:rsidTr":       true,
+}
+
+// mergeableRunContent lists the run children that may be moved into a
+// neighbouring run with the same formatting
+var mergeableRunContent = map[string]bool{
+	"w:t":   true,
+	"w:tab": true,
+	"w:br":  true,
+	"w:cr":  true,
+}
+
+// splitPlaceholderPattern matches a complete {{ ... }} token in paragraph text
+var splitPlaceholderPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
+// normalizeComponent cleans up component XML exported from Word: it removes
+// revision IDs and proofing marks, moves placeholders that Word split across
+// runs back into a single run, and merges adjacent runs with the same
+// formatting
+func normalizeComponent(template string) (string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(fmt.Sprintf(componentWrapper, template)); err != nil {
+		return "", fmt.Errorf("failed to parse component XML: %w", err)
+	}
+	root := doc.Root()
+
+	removeRevisionMarkup(root)
+	for _, p := range root.FindElements(".//w:p") {
+		joinSplitPlaceholders(p)
+	}
+	mergeRuns(root)
+
+	return writeFragment(doc)
+}
+
+// removeRevisionMarkup strips rsid attributes, proofing marks and rendered
+// page break hints, none of which affect the document's content
+func removeRevisionMarkup(root *etree.Element) {
+	for _, element := range root.FindElements(".//*") {
+		switch element.FullTag() {
+		case "w:proofErr", "w:lastRenderedPageBreak":
+			element.Parent().RemoveChild(element)
+			continue
+		}
+
+		attrs := element.Attr[:0]
+		for _, attr := range element.Attr {
+			if !rsidAttributes[attr.FullKey()] {
+				attrs = append(attrs, attr)
+			}
+		}
+		element.Attr = attrs
+	}
+}
+
+// joinSplitPlaceholders moves every placeholder whose text spans several w:t
+// elements of a paragraph into the element where it starts
+func joinSplitPlaceholders(p *etree.Element) {
+	var texts []*etree.Element
+	for _, t := range elementsInOrder(p, "w:t") {
+		if enclosingParagraph(t) == p {
+			texts = append(texts, t)
+		}
+	}
+	if len(texts) < 2 {
+		return
+	}
+
+	// Lay the paragraph's text out end to end, tracking each element's span
+	var full strings.Builder
+	starts := make([]int, len(texts))
+	ends := make([]int, len(texts))
+	for i, t := range texts {
+		starts[i] = full.Len()
+		full.WriteString(t.Text())
+		ends[i] = full.Len()
+	}
+	text := full.String()
+
+	moved := false
+	for _, loc := range splitPlaceholderPattern.FindAllStringIndex(text, -1) {
+		first, last := -1, -1
+		for i := range texts {
+			if first < 0 && loc[0] < ends[i] {
+				first = i
+			}
+			if loc[1] > starts[i] {
+				last = i
+			}
+		}
+		if first < 0 || first == last {
+			continue
+		}
+
+		ends[first] = loc[1]
+		for i := first + 1; i <= last; i++ {
+			starts[i] = max(starts[i], loc[1])
+			ends[i] = max(ends[i], loc[1])
+		}
+		moved = true
+	}
+	if !moved {
+		return
+	}
+
+	for i, t := range texts {
+		if t.Text() == text[starts[i]:ends[i]] {
+			continue
+		}
+		if starts[i] == ends[i] {
+			run := t.Parent()
+			run.RemoveChild(t)
+			if run.FullTag() == "w:r" && !hasRunContent(run) {
+				run.Parent().RemoveChild(run)
+			}
+			continue
+		}
+		t.SetText(text[starts[i]:ends[i]])
+		preserveSpace(t)
+	}
+}
+
+// mergeRuns merges each run into the previous run when both hold only text
+// and share the same properties
+func mergeRuns(root *etree.Element) {
+	for _, parent := range append([]*etree.Element{root}, root.FindElements(".//*")...) {
+		var previous *etree.Element
+		for _, token := range append([]etree.Token(nil), parent.Child...) {
+			switch child := token.(type) {
+			case *etree.CharData:
+				if child.IsWhitespace() {
+					continue
+				}
+				previous = nil
+			case *etree.Element:
+				if child.FullTag() != "w:r" || !isMergeableRun(child) {
+					previous = nil
+					continue
+				}
+				if previous != nil && sameRunProperties(previous, child) {
+					for _, content := range child.ChildElements() {
+						if content.FullTag() != "w:rPr" {
+							previous.AddChild(content)
+						}
+					}
+					parent.RemoveChild(child)
+					joinRunText(previous)
+					continue
+				}
+				previous = child
+			default:
+				previous = nil
+			}
+		}
+	}
+}
+
+// isMergeableRun reports whether a run holds nothing but text, tabs and breaks
+func isMergeableRun(run *etree.Element) bool {
+	for _, child := range run.ChildElements() {
+		if child.FullTag() != "w:rPr" && !mergeableRunContent[child.FullTag()] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRunProperties reports whether two runs have identical attributes and formatting
+func sameRunProperties(a, b *etree.Element) bool {
+	if len(a.Attr) != len(b.Attr) {
+		return false
+	}
+	for _, attr := range a.Attr {
+		if b.SelectAttrValue(attr.FullKey(), "\x00") != attr.Value {
+			return false
+		}
+	}
+	return runPropertiesXML(a) == runPropertiesXML(b)
+}
+
+// runPropertiesXML serializes a run's w:rPr for comparison
+func runPropertiesXML(run *etree.Element) string {
+	rPr := run.SelectElement("w:rPr")
+	if rPr == nil || len(rPr.ChildElements()) == 0 {
+		return ""
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(rPr.Copy())
+	xml, err := doc.WriteToString()
+	if err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(xml), " ")
+}
+
+// joinRunText combines adjacent w:t elements of a run into one
+func joinRunText(run *etree.Element) {
+	var previous *etree.Element
+	for _, child := range run.ChildElements() {
+		if child.FullTag() != "w:t" {
+			previous = nil
+			continue
+		}
+		if previous == nil {
+			previous = child
+			continue
+		}
+		previous.SetText(previous.Text() + child.Text())
+		preserveSpace(previous)
+		run.RemoveChild(child)
+	}
+}
+
+// hasRunContent reports whether a run holds anything besides its properties
+func hasRunContent(run *etree.Element) bool {
+	for _, child := range run.ChildElements() {
+		if child.FullTag() != "w:rPr" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package docgen
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/beevik/etree"
+)
+
+// stylesPart holds the shell's style definitions
+const stylesPart = "word/styles.xml"
+
+// noteKind describes how footnotes or endnotes are stored in the package
+type noteKind struct {
+	name string
+	part string
+	// element is a note in the notes part; reference and ref are the run
+	// contents that refer to it from the document and mark it in the note
+	element   string
+	reference string
+	ref       string
+	// referenceStyle and textStyle are used when the shell defines them
+	referenceStyle string
+	textStyle      string
+}
+
+var (
+	footnoteKind = noteKind{"footnote", "word/footnotes.xml", "w:footnote", "w:footnoteReference", "w:footnoteRef", "FootnoteReference", "FootnoteText"}
+	endnoteKind  = noteKind{"endnote", "word/endnotes.xml", "w:endnote", "w:endnoteReference", "w:endnoteRef", "EndnoteReference", "EndnoteText"}
+)
+
+// addNote appends a footnote or endnote with the given text to the shell's
+// notes part and returns the run that refers to it. The reference run starts
+// from the run properties of the text it follows.
+func (a *assembly) addNote(kind noteKind, spans []textSpan, rPr *etree.Element) (*etree.Element, error) {
+	if _, exists := a.docx[kind.part]; !exists {
+		return nil, fmt.Errorf("%ss require %s in the shell document", kind.name, kind.part)
+	}
+
+	// Notes cannot hold links, which would need relationships of the notes part
+	r := &templateRenderer{seen: make(map[string]bool)}
+	r.hyperlink = func(target string) (string, error) {
+		return "", fmt.Errorf("link %q cannot be placed in a %s", target, kind.name)
+	}
+	runs, err := r.spanElements(spans, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	err = a.docx.updatePart(kind.part, func(root *etree.Element) error {
+		highest := 0
+		for _, existing := range root.SelectElements(kind.element) {
+			if n, err := strconv.Atoi(existing.SelectAttrValue("w:id", "")); err == nil && n > highest {
+				highest = n
+			}
+		}
+		id = strconv.Itoa(highest + 1)
+
+		note := root.CreateElement(kind.element)
+		note.CreateAttr("w:id", id)
+		p := note.CreateElement("w:p")
+		if a.styleDefined(kind.textStyle) {
+			setParagraphStyle(p, kind.textStyle)
+		}
+		ref := a.noteReferenceRun(kind, nil)
+		ref.CreateElement(kind.ref)
+		p.AddChild(ref)
+		addRunText(p.CreateElement("w:r"), " ")
+		for _, run := range runs {
+			p.AddChild(run)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reference := a.noteReferenceRun(kind, rPr)
+	reference.CreateElement(kind.reference).CreateAttr("w:id", id)
+	return reference, nil
+}
+
+// noteReferenceRun returns a run formatted as a note reference: in the
+// shell's reference style, or as superscript if the shell has none
+func (a *assembly) noteReferenceRun(kind noteKind, rPr *etree.Element) *etree.Element {
+	props := etree.NewElement("w:rPr")
+	if rPr != nil {
+		props = rPr.Copy()
+	}
+	if a.styleDefined(kind.referenceStyle) {
+		setRunProperty(props, "w:rStyle", kind.referenceStyle)
+	} else {
+		setRunProperty(props, "w:vertAlign", "superscript")
+	}
+
+	run := etree.NewElement("w:r")
+	run.AddChild(props)
+	return run
+}
+
+// styleDefined reports whether the shell defines a style
+func (a *assembly) styleDefined(styleID string) bool {
+	if a.styleIDs == nil {
+		a.styleIDs = make(map[string]bool)
+		doc := etree.NewDocument()
+		if content, exists := a.docx[stylesPart]; exists && doc.ReadFromBytes(content) == nil {
+			for _, style := range doc.FindElements("//w:style") {
+				a.styleIDs[style.SelectAttrValue("w:styleId", "")] = true
+			}
+		}
+	}
+	return a.styleIDs[styleID]
+}
@@ -0,0 +1,29 @@
+package docgen
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// osFS opens OS paths as they are given, relative to the working directory or
+// absolute, so the path-based loaders can share the fs.FS ones. Unlike
+// os.DirFS it is not rooted at a directory, which means it accepts paths
+// fs.ValidPath rejects; it is only passed to this package's own loaders.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(filepath.FromSlash(name))
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.FromSlash(name))
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(name))
+}
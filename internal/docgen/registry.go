@@ -0,0 +1,233 @@
+package docgen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultTemplate names the only template of a registry built from a single
+// shell, components directory and schema
+const DefaultTemplate = "default"
+
+// The files that make up a template in a templates directory
+const (
+	templateShellFile     = "shell.docx"
+	templateComponentsDir = "components"
+	templateSchemaFile    = "schema.cue"
+)
+
+// templateNamePattern matches the names templates can be selected by
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// TemplateConfig locates the shell, component library and schema of a template
+type TemplateConfig struct {
+	Name string
+	// FS holds the template's files; nil means the paths are OS paths
+	FS            fs.FS
+	ShellPath     string
+	ComponentsDir string
+	SchemaPath    string
+}
+
+// files returns the file system the template's paths are in
+func (t TemplateConfig) files() fs.FS {
+	if t.FS == nil {
+		return osFS{}
+	}
+	return t.FS
+}
+
+// Registry holds an engine for each named template, so one process can render
+// documents with different letterheads, styles and component libraries
+type Registry struct {
+	engines map[string]*Engine
+	// defaultTemplate renders plans that do not name a template; empty means
+	// every plan must name one
+	defaultTemplate string
+	// version identifies the assets the engines were loaded from
+	version string
+}
+
+// LoadTemplateConfigs finds the templates in a directory. Each subdirectory is
+// a template named after it, holding shell.docx, a components directory and
+// schema.cue.
+func LoadTemplateConfigs(templatesDir string) ([]TemplateConfig, error) {
+	return LoadTemplateConfigsFS(osFS{}, filepath.ToSlash(templatesDir))
+}
+
+// LoadTemplateConfigsFS finds the templates in the directory templatesDir of fsys
+func LoadTemplateConfigsFS(fsys fs.FS, templatesDir string) ([]TemplateConfig, error) {
+	entries, err := fs.ReadDir(fsys, templatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory %s: %w", templatesDir, err)
+	}
+
+	var templates []TemplateConfig
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := path.Join(templatesDir, entry.Name())
+		template := TemplateConfig{
+			Name:          entry.Name(),
+			FS:            fsys,
+			ShellPath:     path.Join(dir, templateShellFile),
+			ComponentsDir: path.Join(dir, templateComponentsDir),
+			SchemaPath:    path.Join(dir, templateSchemaFile),
+		}
+		for _, file := range []string{template.ShellPath, template.ComponentsDir, template.SchemaPath} {
+			if _, err := fs.Stat(fsys, file); err != nil {
+				return nil, fmt.Errorf("template %s has no %s", template.Name, path.Base(file))
+			}
+		}
+		templates = append(templates, template)
+	}
+
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates found in %s", templatesDir)
+	}
+	return templates, nil
+}
+
+// NewRegistry creates an engine for each template. Plans without a template
+// are rendered with defaultTemplate; when it is empty and there is a single
+// template, that one is the default.
+func NewRegistry(templates []TemplateConfig, defaultTemplate string, opts ...Option) (*Registry, error) {
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates configured")
+	}
+
+	names := make(map[string]bool)
+	for _, template := range templates {
+		if !templateNamePattern.MatchString(template.Name) {
+			return nil, fmt.Errorf("invalid template name %q: use letters, digits, '-' and '_'", template.Name)
+		}
+		if names[template.Name] {
+			return nil, fmt.Errorf("template %s is defined more than once", template.Name)
+		}
+		names[template.Name] = true
+	}
+
+	// Hash the assets before loading them, so a change made during loading
+	// shows up as a new version
+	version, err := AssetVersion(templates)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &Registry{
+		engines:         make(map[string]*Engine),
+		defaultTemplate: defaultTemplate,
+		version:         version,
+	}
+	for _, template := range templates {
+		engine, err := NewEngineFS(template.files(), template.ShellPath, template.ComponentsDir, template.SchemaPath, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load template %s: %w", template.Name, err)
+		}
+		registry.engines[template.Name] = engine
+	}
+
+	if defaultTemplate == "" && len(templates) == 1 {
+		registry.defaultTemplate = templates[0].Name
+	}
+	if _, exists := registry.engines[registry.defaultTemplate]; registry.defaultTemplate != "" && !exists {
+		return nil, fmt.Errorf("default template %s is not defined", registry.defaultTemplate)
+	}
+
+	return registry, nil
+}
+
+// NewSingleTemplateRegistry creates a registry holding one engine as DefaultTemplate
+func NewSingleTemplateRegistry(shellPath, componentsDir, schemaPath string, opts ...Option) (*Registry, error) {
+	return NewRegistry([]TemplateConfig{{
+		Name:          DefaultTemplate,
+		ShellPath:     shellPath,
+		ComponentsDir: componentsDir,
+		SchemaPath:    schemaPath,
+	}}, DefaultTemplate, opts...)
+}
+
+// Engine returns the engine of a template; an empty name selects the default
+// template
+func (r *Registry) Engine(name string) (*Engine, error) {
+	if name == "" {
+		name = r.defaultTemplate
+	}
+	engine, exists := r.engines[name]
+	if !exists {
+		return nil, &TemplateNotFoundError{TemplateName: name, Available: r.Templates()}
+	}
+	return engine, nil
+}
+
+// Templates returns the names of all templates in sorted order
+func (r *Registry) Templates() []string {
+	names := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultTemplate returns the template used by plans that do not name one, or
+// "" if every plan must name one
+func (r *Registry) DefaultTemplate() string {
+	return r.defaultTemplate
+}
+
+// Version returns the asset version the registry was loaded from
+func (r *Registry) Version() string {
+	return r.version
+}
+
+// AssetVersion identifies the content of the templates' assets: it changes
+// whenever a shell, component or schema file is added, removed or edited,
+// and not when files are merely touched
+func AssetVersion(templates []TemplateConfig) (string, error) {
+	sorted := append([]TemplateConfig(nil), templates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	hash := sha256.New()
+	addFile := func(fsys fs.FS, label, file string) error {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		fmt.Fprintf(hash, "%s %d\n", label, len(content))
+		hash.Write(content)
+		return nil
+	}
+
+	for _, template := range sorted {
+		fsys := template.files()
+		fmt.Fprintf(hash, "template %s\n", template.Name)
+		if err := addFile(fsys, "shell", template.ShellPath); err != nil {
+			return "", err
+		}
+		if err := addFile(fsys, "schema", template.SchemaPath); err != nil {
+			return "", err
+		}
+		// WalkDir visits files in lexical order, so the hash is stable
+		componentsDir := path.Clean(template.ComponentsDir)
+		err := fs.WalkDir(fsys, componentsDir, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			return addFile(fsys, "component "+strings.TrimPrefix(file, componentsDir+"/"), file)
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to hash components of template %s: %w", template.Name, err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
@@ -0,0 +1,179 @@
+package docgen
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const relationshipsNamespace = "http://schemas.openxmlformats.org/package/2006/relationships"
+
+// Relationship types used by the engine
+const (
+	RelTypeHyperlink = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	RelTypeHeader    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/header"
+	RelTypeFooter    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/footer"
+)
+
+// TargetModeExternal marks a relationship whose target lies outside the package
+const TargetModeExternal = "External"
+
+// Relationship is a single entry of an OPC relationships part
+type Relationship struct {
+	ID         string
+	Type       string
+	Target     string
+	TargetMode string
+}
+
+// relationshipIDPattern matches the rIdN identifiers Word generates
+var relationshipIDPattern = regexp.MustCompile(`^rId(\d+)$`)
+
+// RelationshipsPart returns the relationships part that belongs to a package
+// part, e.g. word/_rels/document.xml.rels for word/document.xml
+func RelationshipsPart(part string) string {
+	dir, file := path.Split(part)
+	return dir + "_rels/" + file + ".rels"
+}
+
+// Relationships returns the relationships declared for a package part
+func (shell InMemoryDocx) Relationships(part string) ([]Relationship, error) {
+	doc, err := shell.relationshipsDocument(part)
+	if err != nil {
+		return nil, err
+	}
+
+	var relationships []Relationship
+	for _, element := range doc.Root().SelectElements("Relationship") {
+		relationships = append(relationships, Relationship{
+			ID:         element.SelectAttrValue("Id", ""),
+			Type:       element.SelectAttrValue("Type", ""),
+			Target:     element.SelectAttrValue("Target", ""),
+			TargetMode: element.SelectAttrValue("TargetMode", ""),
+		})
+	}
+	return relationships, nil
+}
+
+// AddRelationship adds a relationship to a package part and returns its ID.
+// When rel.ID is empty a fresh rIdN that collides with no existing entry is allocated.
+func (shell InMemoryDocx) AddRelationship(part string, rel Relationship) (string, error) {
+	doc, err := shell.relationshipsDocument(part)
+	if err != nil {
+		return "", err
+	}
+	root := doc.Root()
+
+	existing := make(map[string]bool)
+	highest := 0
+	for _, element := range root.SelectElements("Relationship") {
+		id := element.SelectAttrValue("Id", "")
+		existing[id] = true
+		if match := relationshipIDPattern.FindStringSubmatch(id); match != nil {
+			if n, err := strconv.Atoi(match[1]); err == nil && n > highest {
+				highest = n
+			}
+		}
+	}
+
+	if rel.ID == "" {
+		for n := highest + 1; ; n++ {
+			if candidate := fmt.Sprintf("rId%d", n); !existing[candidate] {
+				rel.ID = candidate
+				break
+			}
+		}
+	} else if existing[rel.ID] {
+		return "", fmt.Errorf("relationship %s already exists in %s", rel.ID, RelationshipsPart(part))
+	}
+
+	element := root.CreateElement("Relationship")
+	element.CreateAttr("Id", rel.ID)
+	element.CreateAttr("Type", rel.Type)
+	element.CreateAttr("Target", rel.Target)
+	if rel.TargetMode != "" {
+		element.CreateAttr("TargetMode", rel.TargetMode)
+	}
+
+	content, err := doc.WriteToBytes()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize %s: %w", RelationshipsPart(part), err)
+	}
+	shell[RelationshipsPart(part)] = content
+
+	return rel.ID, nil
+}
+
+// relationshipsDocument parses the relationships part of a package part,
+// returning an empty Relationships document if the part has none yet
+func (shell InMemoryDocx) relationshipsDocument(part string) (*etree.Document, error) {
+	doc := etree.NewDocument()
+
+	content, exists := shell[RelationshipsPart(part)]
+	if !exists {
+		doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8" standalone="yes"`)
+		root := doc.CreateElement("Relationships")
+		root.CreateAttr("xmlns", relationshipsNamespace)
+		return doc, nil
+	}
+
+	if err := doc.ReadFromBytes(content); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", RelationshipsPart(part), err)
+	}
+	if doc.Root() == nil || doc.Root().Tag != "Relationships" {
+		return nil, fmt.Errorf("%s is not a relationships part", RelationshipsPart(part))
+	}
+	return doc, nil
+}
+
+// relationshipPlaceholder resolves a {{rel:<kind>:<prop>}} placeholder to the
+// ID of a relationship that targets the prop's value
+func (a *assembly) relationshipPlaceholder(args []string, scope *templateScope) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("relationship placeholder {{rel:%s}} must be {{rel:<kind>:<prop>}}", strings.Join(args, ":"))
+	}
+	kind, propName := args[0], args[1]
+
+	value, _ := scope.lookup(propName)
+	target := strings.TrimSpace(formatValue(value))
+	if target == "" {
+		return "", fmt.Errorf("relationship placeholder {{rel:%s:%s}} requires prop %q", kind, propName, propName)
+	}
+
+	switch kind {
+	case "hyperlink":
+		return a.hyperlink(target)
+	default:
+		return "", fmt.Errorf("unsupported relationship kind %q in {{rel:%s:%s}}", kind, kind, propName)
+	}
+}
+
+// hyperlink returns the ID of an external hyperlink relationship to target
+func (a *assembly) hyperlink(target string) (string, error) {
+	return a.externalRelationship(RelTypeHyperlink, target)
+}
+
+// externalRelationship returns the ID of an external relationship from
+// document.xml, creating it the first time a target is seen
+func (a *assembly) externalRelationship(relType, target string) (string, error) {
+	key := relType + " " + target
+	if id, exists := a.relationshipIDs[key]; exists {
+		return id, nil
+	}
+
+	id, err := a.docx.AddRelationship("word/document.xml", Relationship{
+		Type:       relType,
+		Target:     target,
+		TargetMode: TargetModeExternal,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	a.relationshipIDs[key] = id
+	return id, nil
+}
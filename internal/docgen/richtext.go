@@ -0,0 +1,388 @@
+package docgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// A prop may hold rich text instead of a string: an array whose elements are
+// plain strings or span objects.
+//
+//	"additional_info": [
+//	  "Tested per ",
+//	  {"text": "MIL-STD-810H", "bold": true},
+//	  {"break": true},
+//	  {"text": "Method 514.8", "link": "https://example.com/514.8"},
+//	  {"footnote": "Department of Defense, 2019."}
+//	]
+//
+// When such a prop fills a placeholder inside a run, the run is split and each
+// span becomes a run of its own that starts from the placeholder run's
+// formatting. Spans with a link are wrapped in a w:hyperlink. A span with a
+// footnote or endnote, given as text or rich text without links, is followed by
+// a reference to the note. Newlines and tabs in span text become line breaks
+// and tabs. Anywhere else, such as in an attribute, rich text renders as its
+// plain text.
+
+// textSpan is one span of a rich-text prop
+type textSpan struct {
+	Text      string
+	Bold      bool
+	Italic    bool
+	Underline bool
+	// VertAlign is superscript or subscript
+	VertAlign string
+	// Style names a character style
+	Style string
+	// Link is the target of an external hyperlink
+	Link string
+	// Break ends the span with a line break
+	Break bool
+	// Footnote and Endnote are the text of a note referenced after the span
+	Footnote []textSpan
+	Endnote  []textSpan
+}
+
+// runPropertyOrder is the sequence the schema requires for the children of w:rPr
+var runPropertyOrder = []string{
+	"w:rStyle", "w:rFonts", "w:b", "w:bCs", "w:i", "w:iCs", "w:caps", "w:smallCaps",
+	"w:strike", "w:dstrike", "w:outline", "w:shadow", "w:emboss", "w:imprint",
+	"w:noProof", "w:snapToGrid", "w:vanish", "w:webHidden", "w:color", "w:spacing",
+	"w:w", "w:kern", "w:position", "w:sz", "w:szCs", "w:highlight", "w:u", "w:effect",
+	"w:bdr", "w:shd", "w:fitText", "w:vertAlign", "w:rtl", "w:cs", "w:em", "w:lang",
+	"w:eastAsianLayout", "w:specVanish", "w:oMath",
+}
+
+// richTextSpans reports whether a prop value is rich text and parses its spans
+func richTextSpans(value interface{}) ([]textSpan, bool, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, false, nil
+	}
+
+	spans := make([]textSpan, 0, len(items))
+	for i, item := range items {
+		switch v := item.(type) {
+		case string:
+			spans = append(spans, textSpan{Text: v})
+		case map[string]interface{}:
+			span, err := parseSpan(v)
+			if err != nil {
+				return nil, true, fmt.Errorf("rich text span %d: %w", i, err)
+			}
+			spans = append(spans, span)
+		default:
+			return nil, true, fmt.Errorf("rich text span %d must be a string or an object, got %T", i, item)
+		}
+	}
+	return spans, true, nil
+}
+
+// parseSpan reads a span object
+func parseSpan(fields map[string]interface{}) (textSpan, error) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var span textSpan
+	for _, key := range keys {
+		value := fields[key]
+		var ok bool
+		var err error
+		switch key {
+		case "text":
+			span.Text, ok = value.(string)
+		case "bold":
+			span.Bold, ok = value.(bool)
+		case "italic":
+			span.Italic, ok = value.(bool)
+		case "underline":
+			span.Underline, ok = value.(bool)
+		case "break":
+			span.Break, ok = value.(bool)
+		case "style":
+			span.Style, ok = value.(string)
+		case "link":
+			span.Link, ok = value.(string)
+		case "footnote", "endnote":
+			var note []textSpan
+			note, ok, err = noteSpans(value)
+			if err != nil {
+				return span, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "footnote" {
+				span.Footnote = note
+			} else {
+				span.Endnote = note
+			}
+		case "vert_align":
+			span.VertAlign, ok = value.(string)
+			if ok && span.VertAlign != "superscript" && span.VertAlign != "subscript" {
+				return span, fmt.Errorf("vert_align must be superscript or subscript, got %q", span.VertAlign)
+			}
+		default:
+			return span, fmt.Errorf("unknown field %q", key)
+		}
+		if !ok {
+			return span, fmt.Errorf("field %q has the wrong type %T", key, value)
+		}
+	}
+	return span, nil
+}
+
+// noteSpans reads the text of a footnote or endnote: a string or rich text
+// that holds no further notes
+func noteSpans(value interface{}) ([]textSpan, bool, error) {
+	if text, ok := value.(string); ok {
+		return []textSpan{{Text: text}}, true, nil
+	}
+	spans, ok, err := richTextSpans(value)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	for _, span := range spans {
+		if span.Footnote != nil || span.Endnote != nil {
+			return nil, true, fmt.Errorf("notes cannot contain notes")
+		}
+	}
+	return spans, true, nil
+}
+
+// spansText returns the plain text of rich text
+func spansText(spans []textSpan) string {
+	var text strings.Builder
+	for _, span := range spans {
+		text.WriteString(span.Text)
+		if span.Break {
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
+
+// richValue resolves a placeholder to rich text, reporting false for anything
+// that is not a prop holding an array
+func (r *templateRenderer) richValue(placeholder string, scope *templateScope) ([]textSpan, bool, error) {
+	body := strings.TrimSpace(placeholderPattern.FindStringSubmatch(placeholder)[1])
+	if blockMarkerPattern.MatchString(placeholder) || templateFuncPattern.MatchString(body) {
+		return nil, false, nil
+	}
+	path, _, err := parseExpression(body)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	value, _ := scope.lookup(path)
+	spans, ok, err := richTextSpans(value)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid rich text for %s: %w", placeholder, err)
+	}
+	return spans, ok, nil
+}
+
+// renderRichRun expands the rich-text placeholders of a run into runs and
+// renders the rest of the run's text. It reports false, leaving the run
+// untouched, when the run holds no rich-text placeholder.
+func (r *templateRenderer) renderRichRun(run *etree.Element, scope *templateScope) (bool, error) {
+	values := make(map[string][]textSpan)
+	for _, t := range run.SelectElements("w:t") {
+		for _, placeholder := range placeholderPattern.FindAllString(t.Text(), -1) {
+			spans, ok, err := r.richValue(placeholder, scope)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				values[placeholder] = spans
+			}
+		}
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	rPr := run.SelectElement("w:rPr")
+	inHyperlink := run.Parent().FullTag() == "w:hyperlink"
+	expanded := make(map[*etree.Element]bool)
+	var spanErr error
+	pieces := splitRun(run, placeholderPattern, func(placeholder string) ([]*etree.Element, bool) {
+		spans, ok := values[placeholder]
+		if !ok || spanErr != nil {
+			return nil, false
+		}
+		elements, err := r.spanElements(spans, rPr, inHyperlink)
+		if err != nil {
+			spanErr = err
+			return nil, false
+		}
+		for _, element := range elements {
+			expanded[element] = true
+		}
+		return elements, true
+	})
+	if spanErr != nil {
+		return false, spanErr
+	}
+
+	// The text around the rich text may hold other placeholders
+	for _, piece := range pieces {
+		if !expanded[piece] {
+			if err := r.render(piece, scope); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// valueRuns renders a string, number or rich-text value as runs that start
+// from the given run properties
+func (r *templateRenderer) valueRuns(value interface{}, rPr *etree.Element) ([]*etree.Element, error) {
+	spans, ok, err := richTextSpans(value)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		spans = []textSpan{{Text: formatValue(value)}}
+	}
+	return r.spanElements(spans, rPr, false)
+}
+
+// spanElements builds the runs and hyperlinks for rich text, starting each run
+// from the placeholder run's properties
+func (r *templateRenderer) spanElements(spans []textSpan, rPr *etree.Element, inHyperlink bool) ([]*etree.Element, error) {
+	var elements []*etree.Element
+	for _, span := range spans {
+		props := etree.NewElement("w:rPr")
+		if rPr != nil {
+			props = rPr.Copy()
+		}
+		switch {
+		case span.Style != "":
+			setRunProperty(props, "w:rStyle", span.Style)
+		case span.Link != "":
+			setRunProperty(props, "w:rStyle", "Hyperlink")
+		}
+		if span.Bold {
+			setRunProperty(props, "w:b", "")
+		}
+		if span.Italic {
+			setRunProperty(props, "w:i", "")
+		}
+		if span.Underline {
+			setRunProperty(props, "w:u", "single")
+		}
+		if span.VertAlign != "" {
+			setRunProperty(props, "w:vertAlign", span.VertAlign)
+		}
+
+		run := etree.NewElement("w:r")
+		if len(props.ChildElements()) > 0 {
+			run.AddChild(props)
+		}
+		addSpanText(run, span.Text)
+		if span.Break {
+			run.CreateElement("w:br")
+		}
+
+		switch {
+		case !hasRunContent(run):
+		case span.Link == "":
+			elements = append(elements, run)
+		case inHyperlink:
+			return nil, fmt.Errorf("rich text link %q cannot be placed inside a hyperlink", span.Link)
+		case r.hyperlink == nil:
+			return nil, fmt.Errorf("rich text link %q can only be rendered into a document", span.Link)
+		default:
+			id, err := r.hyperlink(span.Link)
+			if err != nil {
+				return nil, err
+			}
+			hyperlink := etree.NewElement("w:hyperlink")
+			hyperlink.CreateAttr("r:id", id)
+			hyperlink.CreateAttr("w:history", "1")
+			hyperlink.AddChild(run)
+			elements = append(elements, hyperlink)
+		}
+
+		for _, note := range []struct {
+			kind  noteKind
+			spans []textSpan
+		}{
+			{footnoteKind, span.Footnote},
+			{endnoteKind, span.Endnote},
+		} {
+			if note.spans == nil {
+				continue
+			}
+			if r.note == nil {
+				return nil, fmt.Errorf("rich text %s can only be rendered into a document", note.kind.name)
+			}
+			reference, err := r.note(note.kind, note.spans, rPr)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, reference)
+		}
+	}
+	return elements, nil
+}
+
+// addSpanText appends span text to a run, turning newlines and tabs into
+// w:br and w:tab elements
+func addSpanText(run *etree.Element, text string) {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			run.CreateElement("w:br")
+		}
+		for j, segment := range strings.Split(line, "\t") {
+			if j > 0 {
+				run.CreateElement("w:tab")
+			}
+			if segment != "" {
+				addRunText(run, segment)
+			}
+		}
+	}
+}
+
+// setRunProperty sets a run property, replacing an existing one and keeping
+// the children of w:rPr in schema order. An empty value writes the element
+// without w:val, which turns toggle properties such as w:b on.
+func setRunProperty(rPr *etree.Element, tag, value string) {
+	property := etree.NewElement(tag)
+	if value != "" {
+		property.CreateAttr("w:val", value)
+	}
+	setOrderedChild(rPr, property, runPropertyOrder)
+}
+
+// setOrderedChild adds child to parent in place of any element with the same
+// tag, at the position order gives its tag. Tags missing from order sort last.
+func setOrderedChild(parent, child *etree.Element, order []string) {
+	if existing := parent.SelectElement(child.FullTag()); existing != nil {
+		parent.RemoveChild(existing)
+	}
+
+	rank := func(tag string) int {
+		for i, known := range order {
+			if known == tag {
+				return i
+			}
+		}
+		return len(order)
+	}
+
+	childRank := rank(child.FullTag())
+	for _, sibling := range parent.ChildElements() {
+		if rank(sibling.FullTag()) > childRank {
+			parent.InsertChild(sibling, child)
+			return
+		}
+	}
+	parent.AddChild(child)
+}
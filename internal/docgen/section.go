@@ -0,0 +1,361 @@
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// sectionPropertyOrder is the sequence the schema requires for the children of w:sectPr
+var sectionPropertyOrder = []string{
+	"w:headerReference", "w:footerReference", "w:footnotePr", "w:endnotePr", "w:type",
+	"w:pgSz", "w:pgMar", "w:paperSrc", "w:pgBorders", "w:lnNumType", "w:pgNumType",
+	"w:cols", "w:formProt", "w:vAlign", "w:noEndnote", "w:titlePg", "w:textDirection",
+	"w:bidi", "w:rtlGutter", "w:docGrid", "w:printerSettings", "w:sectPrChange",
+}
+
+// pageSizes are the portrait dimensions of the named page sizes, in
+// twentieths of a point
+var pageSizes = map[string][2]int{
+	"letter":  {12240, 15840},
+	"legal":   {12240, 20160},
+	"tabloid": {15840, 24480},
+	"a4":      {11906, 16838},
+	"a3":      {16838, 23811},
+	"a5":      {8391, 11906},
+}
+
+// sectionStarts maps the start prop of a Section to w:type values
+var sectionStarts = map[string]string{
+	"next_page":  "nextPage",
+	"odd_page":   "oddPage",
+	"even_page":  "evenPage",
+	"continuous": "continuous",
+}
+
+// builtinComponents are the components every engine provides without assets
+func builtinComponents() map[string]ComponentSpec {
+	return map[string]ComponentSpec{
+		"Section":   sectionSpec{},
+		"PageBreak": pageBreakSpec{},
+		"Heading":   headingSpec{},
+		"TOC":       tocSpec{},
+	}
+}
+
+// decodeProps decodes the props of a built-in component into a struct,
+// rejecting props the struct does not define
+func decodeProps(props map[string]interface{}, v interface{}) error {
+	content, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// pageBreakSpec is the PageBreak component: an empty paragraph that starts a
+// new page
+type pageBreakSpec struct{}
+
+// build renders a paragraph holding a page break. PageBreak takes no props,
+// so any it is given are reported as unused.
+func (pageBreakSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	report := &templateReport{}
+	for prop := range props {
+		report.unused = append(report.unused, prop)
+	}
+	sort.Strings(report.unused)
+
+	p := etree.NewElement("w:p")
+	p.CreateElement("w:r").CreateElement("w:br").CreateAttr("w:type", "page")
+	return []*etree.Element{p}, report, nil
+}
+
+// sectionSettings is the page setup of a section started by a Section
+// component. Anything left out is taken from the shell's page setup.
+type sectionSettings struct {
+	// Start is next_page, odd_page, even_page or continuous
+	Start       string          `json:"start,omitempty"`
+	PageSize    string          `json:"page_size,omitempty"`
+	Orientation string          `json:"orientation,omitempty"`
+	Margins     *sectionMargins `json:"margins,omitempty"`
+	// Columns is the number of text columns
+	Columns       int  `json:"columns,omitempty"`
+	ColumnSpacing *int `json:"column_spacing,omitempty"`
+	// PageNumberStart restarts page numbering at the given number
+	PageNumberStart  *int   `json:"page_number_start,omitempty"`
+	PageNumberFormat string `json:"page_number_format,omitempty"`
+}
+
+// sectionMargins are page margins in twentieths of a point
+type sectionMargins struct {
+	Top    *int `json:"top,omitempty"`
+	Right  *int `json:"right,omitempty"`
+	Bottom *int `json:"bottom,omitempty"`
+	Left   *int `json:"left,omitempty"`
+	Header *int `json:"header,omitempty"`
+	Footer *int `json:"footer,omitempty"`
+	Gutter *int `json:"gutter,omitempty"`
+}
+
+// attributes pairs each w:pgMar attribute with its margin
+func (m *sectionMargins) attributes() []struct {
+	name  string
+	value *int
+} {
+	return []struct {
+		name  string
+		value *int
+	}{
+		{"w:top", m.Top}, {"w:right", m.Right}, {"w:bottom", m.Bottom}, {"w:left", m.Left},
+		{"w:header", m.Header}, {"w:footer", m.Footer}, {"w:gutter", m.Gutter},
+	}
+}
+
+// pageNumberFormats are the w:fmt values a section may number its pages with
+var pageNumberFormats = map[string]bool{
+	"decimal": true, "lowerRoman": true, "upperRoman": true, "lowerLetter": true, "upperLetter": true,
+}
+
+// sectionSpec is the Section component. Content after it starts a new section
+// with its own page setup, which lasts until the next Section.
+type sectionSpec struct{}
+
+// build parses the section's page setup and renders the paragraph that ends
+// the previous section; its w:sectPr is filled in by finishSections
+func (sectionSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	settings, err := parseSectionSettings(props)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := etree.NewElement("w:p")
+	sectPr := p.CreateElement("w:pPr").CreateElement("w:sectPr")
+	a.sectionBreaks[sectPr] = settings
+	return []*etree.Element{p}, &templateReport{}, nil
+}
+
+// parseSectionSettings reads the props of a Section component
+func parseSectionSettings(props map[string]interface{}) (*sectionSettings, error) {
+	var settings sectionSettings
+	if err := decodeProps(props, &settings); err != nil {
+		return nil, fmt.Errorf("invalid section props: %w", err)
+	}
+
+	if _, ok := sectionStarts[settings.Start]; settings.Start != "" && !ok {
+		return nil, fmt.Errorf("unknown section start %q", settings.Start)
+	}
+	if _, ok := pageSizes[settings.PageSize]; settings.PageSize != "" && !ok {
+		return nil, fmt.Errorf("unknown page size %q", settings.PageSize)
+	}
+	if settings.Orientation != "" && settings.Orientation != "portrait" && settings.Orientation != "landscape" {
+		return nil, fmt.Errorf("orientation must be portrait or landscape, got %q", settings.Orientation)
+	}
+	if settings.Margins != nil {
+		for _, margin := range settings.Margins.attributes() {
+			if margin.value != nil && *margin.value < 0 {
+				return nil, fmt.Errorf("margin %s must not be negative", strings.TrimPrefix(margin.name, "w:"))
+			}
+		}
+	}
+	if settings.Columns < 0 || settings.Columns > 45 {
+		return nil, fmt.Errorf("columns must be between 1 and 45, got %d", settings.Columns)
+	}
+	if settings.ColumnSpacing != nil && *settings.ColumnSpacing < 0 {
+		return nil, fmt.Errorf("column_spacing must not be negative")
+	}
+	if settings.PageNumberStart != nil && *settings.PageNumberStart < 0 {
+		return nil, fmt.Errorf("page_number_start must not be negative")
+	}
+	if settings.PageNumberFormat != "" && !pageNumberFormats[settings.PageNumberFormat] {
+		return nil, fmt.Errorf("unknown page number format %q", settings.PageNumberFormat)
+	}
+	return &settings, nil
+}
+
+// finishSections fills in the section properties of every Section component.
+// A paragraph-level w:sectPr describes the section that ends with it, so each
+// one gets the page setup of the section before it, and the setup a Section
+// asks for goes to the next section properties in the document.
+func (a *assembly) finishSections() error {
+	if len(a.sectionBreaks) == 0 {
+		return nil
+	}
+
+	all := elementsInOrder(a.body, "w:sectPr")
+	original := make(map[*etree.Element]*etree.Element)
+	for _, sectPr := range all {
+		if _, isBreak := a.sectionBreaks[sectPr]; !isBreak {
+			original[sectPr] = sectPr.Copy()
+		}
+	}
+
+	var open *sectionSettings
+	for i, sectPr := range all {
+		settings, isBreak := a.sectionBreaks[sectPr]
+		if !isBreak {
+			if open != nil {
+				if err := open.apply(sectPr); err != nil {
+					return err
+				}
+			}
+			open = nil
+			continue
+		}
+
+		if enclosingCell(sectPr) != nil {
+			return fmt.Errorf("a Section cannot be placed inside a table or text box")
+		}
+
+		// The region this section closes used to end at the next shell section
+		var closes *etree.Element
+		for _, next := range all[i+1:] {
+			if base, exists := original[next]; exists {
+				closes = base
+				break
+			}
+		}
+		if closes == nil {
+			return fmt.Errorf("document has no final section properties")
+		}
+
+		filled := closes.Copy()
+		if open != nil {
+			if err := open.apply(filled); err != nil {
+				return err
+			}
+		}
+		parent := sectPr.Parent()
+		parent.InsertChild(sectPr, filled)
+		parent.RemoveChild(sectPr)
+		open = settings
+	}
+	return nil
+}
+
+// enclosingCell returns the table cell or text box an element is in, if any
+func enclosingCell(element *etree.Element) *etree.Element {
+	for parent := element.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.FullTag() {
+		case "w:tc", "w:txbxContent":
+			return parent
+		}
+	}
+	return nil
+}
+
+// apply writes the page setup into section properties
+func (s *sectionSettings) apply(sectPr *etree.Element) error {
+	if s.Start != "" {
+		setSectionProperty(sectPr, "w:type").CreateAttr("w:val", sectionStarts[s.Start])
+	}
+
+	if s.PageSize != "" || s.Orientation != "" {
+		pgSz := sectPr.SelectElement("w:pgSz")
+		if pgSz == nil {
+			pgSz = setSectionProperty(sectPr, "w:pgSz")
+		}
+		width, _ := strconv.Atoi(pgSz.SelectAttrValue("w:w", "12240"))
+		height, _ := strconv.Atoi(pgSz.SelectAttrValue("w:h", "15840"))
+		landscape := pgSz.SelectAttrValue("w:orient", "") == "landscape" || width > height
+
+		if s.PageSize != "" {
+			width, height = pageSizes[s.PageSize][0], pageSizes[s.PageSize][1]
+			pgSz.RemoveAttr("w:code")
+		}
+		if s.Orientation != "" {
+			landscape = s.Orientation == "landscape"
+		}
+		if landscape != (width > height) {
+			width, height = height, width
+		}
+
+		pgSz.CreateAttr("w:w", strconv.Itoa(width))
+		pgSz.CreateAttr("w:h", strconv.Itoa(height))
+		if landscape {
+			pgSz.CreateAttr("w:orient", "landscape")
+		} else {
+			pgSz.RemoveAttr("w:orient")
+		}
+	}
+
+	if m := s.Margins; m != nil {
+		pgMar := sectPr.SelectElement("w:pgMar")
+		if pgMar == nil {
+			pgMar = setSectionProperty(sectPr, "w:pgMar")
+		}
+		for _, margin := range m.attributes() {
+			if margin.value != nil {
+				pgMar.CreateAttr(margin.name, strconv.Itoa(*margin.value))
+			}
+		}
+	}
+
+	if s.Columns > 0 || s.ColumnSpacing != nil {
+		cols := sectPr.SelectElement("w:cols")
+		if cols == nil {
+			cols = setSectionProperty(sectPr, "w:cols")
+		}
+		if s.Columns > 0 {
+			cols.CreateAttr("w:num", strconv.Itoa(s.Columns))
+		}
+		if s.ColumnSpacing != nil {
+			cols.CreateAttr("w:space", strconv.Itoa(*s.ColumnSpacing))
+		}
+	}
+
+	if s.PageNumberStart != nil || s.PageNumberFormat != "" {
+		pgNumType := sectPr.SelectElement("w:pgNumType")
+		if pgNumType == nil {
+			pgNumType = setSectionProperty(sectPr, "w:pgNumType")
+		}
+		if s.PageNumberStart != nil {
+			pgNumType.CreateAttr("w:start", strconv.Itoa(*s.PageNumberStart))
+		}
+		if s.PageNumberFormat != "" {
+			pgNumType.CreateAttr("w:fmt", s.PageNumberFormat)
+		}
+	}
+
+	return checkPageGeometry(sectPr)
+}
+
+// setSectionProperty replaces a section property with an empty element in
+// schema order and returns it
+func setSectionProperty(sectPr *etree.Element, tag string) *etree.Element {
+	property := etree.NewElement(tag)
+	setOrderedChild(sectPr, property, sectionPropertyOrder)
+	return property
+}
+
+// checkPageGeometry rejects margins that leave no room for text
+func checkPageGeometry(sectPr *etree.Element) error {
+	pgSz, pgMar := sectPr.SelectElement("w:pgSz"), sectPr.SelectElement("w:pgMar")
+	if pgSz == nil || pgMar == nil {
+		return nil
+	}
+
+	// Top and bottom margins may be negative, which lets text overlap the
+	// header or footer; their distance from the edge is what counts
+	value := func(element *etree.Element, attr string) int {
+		n, _ := strconv.Atoi(element.SelectAttrValue(attr, "0"))
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	width, height := value(pgSz, "w:w"), value(pgSz, "w:h")
+	if value(pgMar, "w:left")+value(pgMar, "w:right")+value(pgMar, "w:gutter") >= width {
+		return fmt.Errorf("left and right margins leave no room on a page %d wide", width)
+	}
+	if value(pgMar, "w:top")+value(pgMar, "w:bottom") >= height {
+		return fmt.Errorf("top and bottom margins leave no room on a page %d high", height)
+	}
+	return nil
+}
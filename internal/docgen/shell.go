@@ -3,17 +3,33 @@ package docgen
 import (
 	"archive/zip"
 	"bytes"
+	"compress/flate"
 	"fmt"
 	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
 )
 
 // LoadShell loads a DOCX shell document into memory
 func LoadShell(shellPath string) (InMemoryDocx, error) {
-	zipReader, err := zip.OpenReader(shellPath)
+	return LoadShellFS(osFS{}, filepath.ToSlash(shellPath))
+}
+
+// LoadShellFS loads the DOCX shell document at shellPath in fsys into memory
+func LoadShellFS(fsys fs.FS, shellPath string) (InMemoryDocx, error) {
+	data, err := fs.ReadFile(fsys, shellPath)
+	if err != nil {
+		return nil, &ShellLoadError{Path: shellPath, Err: err}
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		return nil, &ShellLoadError{Path: shellPath, Err: err}
 	}
-	defer zipReader.Close()
 
 	shell := make(InMemoryDocx)
 
@@ -47,19 +63,116 @@ func (shell InMemoryDocx) Clone() InMemoryDocx {
 	return clone
 }
 
-// ToBytes serializes the in-memory DOCX back to a byte slice
+// workingCopy returns a copy of the shell for one assembly that shares the
+// content of the parts with the original. Assemblies never modify a part in
+// place, only replace it, so a part is only copied when it changes.
+func (shell InMemoryDocx) workingCopy() InMemoryDocx {
+	working := make(InMemoryDocx, len(shell))
+	for path, content := range shell {
+		working[path] = content
+	}
+	return working
+}
+
+// parseShellDocument parses the shell's word/document.xml
+func parseShellDocument(shell InMemoryDocx) (*etree.Document, error) {
+	documentXML, exists := shell["word/document.xml"]
+	if !exists {
+		return nil, fmt.Errorf("word/document.xml not found in shell document")
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(documentXML); err != nil {
+		return nil, fmt.Errorf("failed to parse document.xml: %w", err)
+	}
+	return doc, nil
+}
+
+// zipModifiedTime is the fixed timestamp written on every zip entry so that
+// the same plan always produces the same bytes (the zip epoch, 1980-01-01)
+var zipModifiedTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// partOrder ranks package parts for serialization: [Content_Types].xml first
+// as recommended by OPC, then the package relationships and the main document
+func partOrder(path string) int {
+	switch path {
+	case contentTypesPart:
+		return 0
+	case "_rels/.rels":
+		return 1
+	case "word/document.xml":
+		return 2
+	case "word/_rels/document.xml.rels":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// PartNames returns the part names of the document in canonical order
+func (shell InMemoryDocx) PartNames() []string {
+	names := make([]string, 0, len(shell))
+	for path := range shell {
+		names = append(names, path)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := partOrder(names[i]), partOrder(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// flateWriters holds compressors for reuse: each allocates about a megabyte of
+// state, which would otherwise be allocated for every part of every document
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	},
+}
+
+// pooledFlateWriter is a compressor that returns to flateWriters when closed
+type pooledFlateWriter struct {
+	*flate.Writer
+}
+
+// newPooledFlateWriter takes a compressor from the pool. A reset compressor
+// writes the same bytes as a new one, so reuse keeps documents reproducible.
+func newPooledFlateWriter(w io.Writer) (io.WriteCloser, error) {
+	fw := flateWriters.Get().(*flate.Writer)
+	fw.Reset(w)
+	return &pooledFlateWriter{fw}, nil
+}
+
+func (w *pooledFlateWriter) Close() error {
+	err := w.Writer.Close()
+	flateWriters.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// ToBytes serializes the in-memory DOCX back to a byte slice. Entries are
+// written in canonical order with fixed timestamps and compression settings,
+// so identical content always yields identical bytes.
 func (shell InMemoryDocx) ToBytes() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
+	zipWriter.RegisterCompressor(zip.Deflate, newPooledFlateWriter)
 
-	for path, content := range shell {
-		fileWriter, err := zipWriter.Create(path)
+	for _, path := range shell.PartNames() {
+		fileWriter, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     path,
+			Method:   zip.Deflate,
+			Modified: zipModifiedTime,
+		})
 		if err != nil {
 			zipWriter.Close()
 			return nil, fmt.Errorf("failed to create zip entry for %s: %w", path, err)
 		}
 
-		if _, err := fileWriter.Write(content); err != nil {
+		if _, err := fileWriter.Write(shell[path]); err != nil {
 			zipWriter.Close()
 			return nil, fmt.Errorf("failed to write content for %s: %w", path, err)
 		}
@@ -0,0 +1,190 @@
+package docgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	// slotTagPrefix marks a block-level content control as an insertion point,
+	// e.g. <w:tag w:val="docgen:slot=cover"/>
+	slotTagPrefix = "docgen:slot="
+
+	// slotBookmarkPrefix marks a bookmark as an insertion point. Word does not
+	// allow ':' or '=' in bookmark names, so bookmarks use docgen_slot_<name>.
+	slotBookmarkPrefix = "docgen_slot_"
+
+	// DefaultSlot is the slot used by components that do not name one. When the
+	// shell does not define it, content goes before the body's final sectPr.
+	DefaultSlot = "body"
+)
+
+// slot is a named insertion point in the working document
+type slot struct {
+	name   string
+	parent *etree.Element
+	// anchor is the element rendered content is inserted before; nil appends
+	anchor *etree.Element
+	// removeAnchor is set when the anchor is a placeholder that must not
+	// survive assembly
+	removeAnchor bool
+}
+
+// insert places an element at the slot, after anything inserted previously
+func (s *slot) insert(element *etree.Element) {
+	if s.anchor == nil {
+		s.parent.AddChild(element)
+		return
+	}
+	s.parent.InsertChild(s.anchor, element)
+}
+
+// close removes the slot's placeholder once all content has been inserted
+func (s *slot) close() {
+	if s.removeAnchor && s.anchor != nil && s.anchor.Parent() != nil {
+		s.anchor.Parent().RemoveChild(s.anchor)
+	}
+}
+
+// findSlots locates the named insertion points declared in the shell body
+func findSlots(body *etree.Element) (map[string]*slot, error) {
+	slots := make(map[string]*slot)
+
+	add := func(s *slot) error {
+		if _, exists := slots[s.name]; exists {
+			return fmt.Errorf("slot %q is defined more than once in the shell", s.name)
+		}
+		slots[s.name] = s
+		return nil
+	}
+
+	for _, sdt := range body.FindElements(".//w:sdt") {
+		tag := sdt.FindElement("./w:sdtPr/w:tag")
+		if tag == nil {
+			continue
+		}
+		value := tag.SelectAttrValue("w:val", "")
+		if !strings.HasPrefix(value, slotTagPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(value, slotTagPrefix)
+		if !isBlockContainer(sdt.Parent()) {
+			return nil, fmt.Errorf("slot %q must be a block-level content control", name)
+		}
+		if err := add(&slot{name: name, parent: sdt.Parent(), anchor: sdt, removeAnchor: true}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, bookmark := range body.FindElements(".//w:bookmarkStart") {
+		value := bookmark.SelectAttrValue("w:name", "")
+		if !strings.HasPrefix(value, slotBookmarkPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(value, slotBookmarkPrefix)
+		paragraph := enclosingParagraph(bookmark)
+		if paragraph == nil {
+			// Block-level bookmark: insert at its position and keep it
+			if err := add(&slot{name: name, parent: bookmark.Parent(), anchor: bookmark}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// A paragraph that only carries the bookmark is a placeholder and is
+		// replaced by the slot content; otherwise content goes before it
+		if err := add(&slot{
+			name:         name,
+			parent:       paragraph.Parent(),
+			anchor:       paragraph,
+			removeAnchor: isEmptyParagraph(paragraph),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return slots, nil
+}
+
+// defaultBodySlot returns the insertion point before the body's final sectPr
+func defaultBodySlot(body *etree.Element) *slot {
+	var sectPr *etree.Element
+	if children := body.ChildElements(); len(children) > 0 {
+		if last := children[len(children)-1]; last.Space == "w" && last.Tag == "sectPr" {
+			sectPr = last
+		}
+	}
+	return &slot{name: DefaultSlot, parent: body, anchor: sectPr}
+}
+
+// removePlaceholderParagraphs drops body paragraphs that hold nothing but
+// Word's _GoBack bookmark, such as the one left in an empty shell
+func removePlaceholderParagraphs(body *etree.Element) {
+	for _, child := range body.ChildElements() {
+		if child.Space != "w" || child.Tag != "p" || !isEmptyParagraph(child) {
+			continue
+		}
+
+		bookmarks := child.SelectElements("w:bookmarkStart")
+		if len(bookmarks) == 0 {
+			continue
+		}
+
+		onlyGoBack := true
+		for _, bookmark := range bookmarks {
+			if bookmark.SelectAttrValue("w:name", "") != "_GoBack" {
+				onlyGoBack = false
+				break
+			}
+		}
+		if onlyGoBack {
+			body.RemoveChild(child)
+		}
+	}
+}
+
+// isEmptyParagraph reports whether a paragraph has no content besides its
+// properties and bookmarks
+func isEmptyParagraph(paragraph *etree.Element) bool {
+	for _, child := range paragraph.ChildElements() {
+		switch child.FullTag() {
+		case "w:pPr", "w:bookmarkStart", "w:bookmarkEnd":
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// enclosingParagraph returns the nearest w:p ancestor of an element, if any
+func enclosingParagraph(element *etree.Element) *etree.Element {
+	for parent := element.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Space == "w" && parent.Tag == "p" {
+			return parent
+		}
+	}
+	return nil
+}
+
+// isBlockContainer reports whether paragraphs and tables may be placed
+// directly inside the element
+func isBlockContainer(element *etree.Element) bool {
+	if element == nil {
+		return false
+	}
+	switch element.FullTag() {
+	case "w:body", "w:tc", "w:hdr", "w:ftr", "w:txbxContent":
+		return true
+	case "w:sdtContent":
+		// sdtContent is only block-level when its sdt is
+		if sdt := element.Parent(); sdt != nil {
+			return isBlockContainer(sdt.Parent())
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package docgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// TableSpec is the metadata of a table component. The engine builds the table
+// from it: a header row that repeats on every page, then one row per element
+// of the rows prop.
+type TableSpec struct {
+	// Type must be "table"
+	Type string `json:"type"`
+	// RowsProp names the array prop whose elements become the table rows
+	RowsProp string `json:"rows_prop"`
+	// Style is the table style ID, e.g. TableGrid
+	Style string `json:"style,omitempty"`
+	// HeaderStyle is the paragraph style of the header cells; without it the
+	// header text is bold
+	HeaderStyle string        `json:"header_style,omitempty"`
+	Columns     []TableColumn `json:"columns"`
+}
+
+// TableColumn describes one column of a table component
+type TableColumn struct {
+	// Key is the row field shown in the column
+	Key    string `json:"key"`
+	Header string `json:"header"`
+	// Width is the column width in twentieths of a point
+	Width int `json:"width"`
+	// Style is the paragraph style of the column's cells
+	Style string `json:"style,omitempty"`
+	// CellStyles maps a cell value to the formatting of the cell
+	CellStyles map[string]CellStyle `json:"cell_styles,omitempty"`
+}
+
+// CellStyle is the formatting a style hook applies to a single cell
+type CellStyle struct {
+	// Fill is the cell shading as RRGGBB
+	Fill string `json:"fill,omitempty"`
+	// Color is the text colour as RRGGBB
+	Color string `json:"color,omitempty"`
+	Bold  bool   `json:"bold,omitempty"`
+}
+
+// rowCellStylesField is the optional row field that styles individual cells,
+// keyed by column
+const rowCellStylesField = "cell_styles"
+
+// hexColorPattern matches an RRGGBB colour
+var hexColorPattern = regexp.MustCompile(`^[0-9A-Fa-f]{6}$`)
+
+// parseTableSpec reads and checks table component metadata
+func parseTableSpec(content []byte) (*TableSpec, error) {
+	var spec TableSpec
+	if err := decodeMetadata(content, &spec); err != nil {
+		return nil, err
+	}
+
+	if !propNamePattern.MatchString(spec.RowsProp) {
+		return nil, fmt.Errorf("rows_prop %q is not a prop name", spec.RowsProp)
+	}
+	if len(spec.Columns) == 0 {
+		return nil, fmt.Errorf("table has no columns")
+	}
+
+	keys := make(map[string]bool)
+	for i, column := range spec.Columns {
+		if !propNamePattern.MatchString(column.Key) || column.Key == rowCellStylesField {
+			return nil, fmt.Errorf("column %d: invalid key %q", i, column.Key)
+		}
+		if keys[column.Key] {
+			return nil, fmt.Errorf("column %d: duplicate key %q", i, column.Key)
+		}
+		keys[column.Key] = true
+		if column.Width <= 0 {
+			return nil, fmt.Errorf("column %s: width must be positive", column.Key)
+		}
+		for value, style := range column.CellStyles {
+			if err := style.check(); err != nil {
+				return nil, fmt.Errorf("column %s: cell style for %q: %w", column.Key, value, err)
+			}
+		}
+	}
+
+	return &spec, nil
+}
+
+// check reports colours that are not RRGGBB
+func (s CellStyle) check() error {
+	if s.Fill != "" && !hexColorPattern.MatchString(s.Fill) {
+		return fmt.Errorf("fill %q is not an RRGGBB colour", s.Fill)
+	}
+	if s.Color != "" && !hexColorPattern.MatchString(s.Color) {
+		return fmt.Errorf("color %q is not an RRGGBB colour", s.Color)
+	}
+	return nil
+}
+
+// merge applies the fields set in other on top of s
+func (s CellStyle) merge(other CellStyle) CellStyle {
+	if other.Fill != "" {
+		s.Fill = other.Fill
+	}
+	if other.Color != "" {
+		s.Color = other.Color
+	}
+	s.Bold = s.Bold || other.Bold
+	return s
+}
+
+// build renders the table for a component instance
+func (spec *TableSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	table, report, err := renderTable(spec, props, a.spanContext())
+	if err != nil {
+		return nil, nil, err
+	}
+	return []*etree.Element{table}, report, nil
+}
+
+// renderTable builds a table component's w:tbl from its rows prop. Cells may
+// hold strings, numbers or rich text; a cell's style comes from its column's
+// cell_styles for the cell value, overridden by the row's own cell_styles.
+func renderTable(spec *TableSpec, props map[string]interface{}, ctx templateContext) (*etree.Element, *templateReport, error) {
+	value, report := arrayPropReport(props, spec.RowsProp)
+	rows, err := loopItems(spec.RowsProp, value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	table := etree.NewElement("w:tbl")
+	tblPr := table.CreateElement("w:tblPr")
+	if spec.Style != "" {
+		tblPr.CreateElement("w:tblStyle").CreateAttr("w:val", spec.Style)
+	}
+	totalWidth := 0
+	for _, column := range spec.Columns {
+		totalWidth += column.Width
+	}
+	tblW := tblPr.CreateElement("w:tblW")
+	tblW.CreateAttr("w:w", strconv.Itoa(totalWidth))
+	tblW.CreateAttr("w:type", "dxa")
+	tblPr.CreateElement("w:tblLayout").CreateAttr("w:type", "fixed")
+	tblLook := tblPr.CreateElement("w:tblLook")
+	tblLook.CreateAttr("w:val", "04A0")
+	tblLook.CreateAttr("w:firstRow", "1")
+	tblLook.CreateAttr("w:lastRow", "0")
+	tblLook.CreateAttr("w:firstColumn", "1")
+	tblLook.CreateAttr("w:lastColumn", "0")
+	tblLook.CreateAttr("w:noHBand", "0")
+	tblLook.CreateAttr("w:noVBand", "1")
+
+	grid := table.CreateElement("w:tblGrid")
+	for _, column := range spec.Columns {
+		grid.CreateElement("w:gridCol").CreateAttr("w:w", strconv.Itoa(column.Width))
+	}
+
+	// The header row repeats at the top of every page the table spans
+	header := newTableRow(table, true)
+	for _, column := range spec.Columns {
+		p := newTableCell(header, column.Width, CellStyle{})
+		run := etree.NewElement("w:r")
+		if spec.HeaderStyle != "" {
+			setParagraphStyle(p, spec.HeaderStyle)
+		} else {
+			run.CreateElement("w:rPr").CreateElement("w:b")
+		}
+		addSpanText(run, column.Header)
+		if hasRunContent(run) {
+			p.AddChild(run)
+		}
+	}
+
+	r := &templateRenderer{templateContext: ctx, seen: make(map[string]bool)}
+	for i, item := range rows {
+		row, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("row %d of %s must be an object, got %T", i, spec.RowsProp, item)
+		}
+		rowStyles, err := parseRowCellStyles(row[rowCellStylesField])
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d of %s: %w", i, spec.RowsProp, err)
+		}
+
+		tr := newTableRow(table, false)
+		for _, column := range spec.Columns {
+			cellValue := row[column.Key]
+			style := column.CellStyles[formatValue(cellValue)].merge(rowStyles[column.Key])
+
+			p := newTableCell(tr, column.Width, style)
+			if column.Style != "" {
+				setParagraphStyle(p, column.Style)
+			}
+			runs, err := r.valueRuns(cellValue, cellRunProperties(style))
+			if err != nil {
+				return nil, nil, fmt.Errorf("row %d of %s, column %s: %w", i, spec.RowsProp, column.Key, err)
+			}
+			for _, run := range runs {
+				p.AddChild(run)
+			}
+		}
+	}
+
+	return table, report, nil
+}
+
+// parseRowCellStyles reads a row's cell_styles field
+func parseRowCellStyles(value interface{}) (map[string]CellStyle, error) {
+	if value == nil {
+		return nil, nil
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var styles map[string]CellStyle
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&styles); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", rowCellStylesField, err)
+	}
+	for key, style := range styles {
+		if err := style.check(); err != nil {
+			return nil, fmt.Errorf("%s for %s: %w", rowCellStylesField, key, err)
+		}
+	}
+	return styles, nil
+}
+
+// cellRunProperties returns the run properties for a cell style's text formatting
+func cellRunProperties(style CellStyle) *etree.Element {
+	rPr := etree.NewElement("w:rPr")
+	if style.Bold {
+		setRunProperty(rPr, "w:b", "")
+	}
+	if style.Color != "" {
+		setRunProperty(rPr, "w:color", style.Color)
+	}
+	return rPr
+}
+
+// newTableRow appends a row that does not split across pages
+func newTableRow(table *etree.Element, header bool) *etree.Element {
+	tr := table.CreateElement("w:tr")
+	trPr := tr.CreateElement("w:trPr")
+	trPr.CreateElement("w:cantSplit")
+	if header {
+		trPr.CreateElement("w:tblHeader")
+	}
+	return tr
+}
+
+// newTableCell appends a cell with a fixed width and returns its paragraph
+func newTableCell(tr *etree.Element, width int, style CellStyle) *etree.Element {
+	tc := tr.CreateElement("w:tc")
+	tcPr := tc.CreateElement("w:tcPr")
+	tcW := tcPr.CreateElement("w:tcW")
+	tcW.CreateAttr("w:w", strconv.Itoa(width))
+	tcW.CreateAttr("w:type", "dxa")
+	if style.Fill != "" {
+		shd := tcPr.CreateElement("w:shd")
+		shd.CreateAttr("w:val", "clear")
+		shd.CreateAttr("w:color", "auto")
+		shd.CreateAttr("w:fill", strings.ToUpper(style.Fill))
+	}
+	return tc.CreateElement("w:p")
+}
+
+// paragraphPropertyOrder is the sequence the schema requires for the children of w:pPr
+var paragraphPropertyOrder = []string{
+	"w:pStyle", "w:keepNext", "w:keepLines", "w:pageBreakBefore", "w:framePr",
+	"w:widowControl", "w:numPr", "w:suppressLineNumbers", "w:pBdr", "w:shd", "w:tabs",
+	"w:suppressAutoHyphens", "w:kinsoku", "w:wordWrap", "w:overflowPunct",
+	"w:topLinePunct", "w:autoSpaceDE", "w:autoSpaceDN", "w:bidi", "w:adjustRightInd",
+	"w:snapToGrid", "w:spacing", "w:ind", "w:contextualSpacing", "w:mirrorIndents",
+	"w:suppressOverlap", "w:jc", "w:textDirection", "w:textAlignment",
+	"w:textboxTightWrap", "w:outlineLvl", "w:divId", "w:cnfStyle", "w:rPr",
+	"w:sectPr", "w:pPrChange",
+}
+
+// setParagraphStyle gives a paragraph a style, replacing any it already has
+func setParagraphStyle(p *etree.Element, style string) {
+	pPr := p.SelectElement("w:pPr")
+	if pPr == nil {
+		pPr = etree.NewElement("w:pPr")
+		p.InsertChildAt(0, pPr)
+	}
+	pStyle := etree.NewElement("w:pStyle")
+	pStyle.CreateAttr("w:val", style)
+	setOrderedChild(pPr, pStyle, paragraphPropertyOrder)
+}
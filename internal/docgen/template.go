@@ -0,0 +1,759 @@
+package docgen
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Component templates are rendered on the parsed XML rather than as text, so
+// values are escaped by the serializer and blocks always keep, remove or repeat
+// whole elements:
+//
+//	{{ name }}                      value of a prop
+//	{{ name | default "n/a" }}      fallback for a missing or empty prop
+//	{{ contact.email }}             field of an object prop
+//	{{#if name}} ... {{/if}}        keep the content only if the prop is set
+//	{{#unless name}} ... {{/unless}}
+//	{{#each items}} ... {{/each}}   repeat the content for every array element;
+//	                                inside, {{ this }}, {{ this.field }},
+//	                                {{ @index }} and {{ @number }} are available
+//	{{rel:hyperlink:prop}}          template functions supplied by the assembler
+//
+// A prop may also hold rich text, an array of spans (see richtext.go); a
+// placeholder inside a run then expands into one run per span.
+//
+// Content controls are filled from the prop their tag or title names (see
+// contentcontrol.go).
+//
+// A block whose markers enclose all of a paragraph's text covers the paragraph,
+// markers in different cells of a row cover the row, and otherwise a block
+// covers the elements between its markers. Paragraphs left holding nothing but
+// a marker are removed.
+
+// blockTag names the temporary element that holds a block's content until it is rendered
+const blockTag = "docgen-block"
+
+var (
+	// placeholderPattern matches any {{ ... }} token
+	placeholderPattern = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	// blockMarkerPattern matches the markers that open and close blocks
+	blockMarkerPattern = regexp.MustCompile(`\{\{\s*([#/])(if|unless|each)\b\s*(.*?)\s*\}\}`)
+	// propPathPattern matches a prop reference such as author.name or @index
+	propPathPattern = regexp.MustCompile(`^(@index|@number|[A-Za-z_][\w-]*(\.[A-Za-z_][\w-]*)*)$`)
+	// propNamePattern matches the names a placeholder may refer to
+	propNamePattern = regexp.MustCompile(`[A-Za-z_][\w-]*`)
+	// templateFuncPattern matches function placeholders such as rel:hyperlink:website
+	templateFuncPattern = regexp.MustCompile(`^(\w+):(\S+)$`)
+)
+
+// templateFunc resolves a {{name:arg:...}} placeholder against the current scope
+type templateFunc func(args []string, scope *templateScope) (string, error)
+
+// templateScope holds the props visible at a point of the template. Loops add
+// a scope for the current element.
+type templateScope struct {
+	props  map[string]interface{}
+	parent *templateScope
+	item   interface{}
+	index  int
+	inLoop bool
+}
+
+// loopScope returns the scope for one element of an {{#each}} block
+func (s *templateScope) loopScope(item interface{}, index int) *templateScope {
+	return &templateScope{parent: s, item: item, index: index, inLoop: true}
+}
+
+// lookup resolves a prop path. Names are looked up in the current loop element
+// first and then in the enclosing scopes.
+func (s *templateScope) lookup(path string) (interface{}, bool) {
+	switch path {
+	case "@index", "@number":
+		for scope := s; scope != nil; scope = scope.parent {
+			if scope.inLoop {
+				if path == "@number" {
+					return scope.index + 1, true
+				}
+				return scope.index, true
+			}
+		}
+		return nil, false
+	}
+
+	names := strings.Split(path, ".")
+
+	var value interface{}
+	found := false
+	if names[0] == "this" {
+		value, found = s.item, s.inLoop
+		if !found {
+			value, found = s.rootProps(), true
+		}
+	} else {
+		for scope := s; scope != nil && !found; scope = scope.parent {
+			if scope.inLoop {
+				if fields, ok := scope.item.(map[string]interface{}); ok {
+					value, found = fields[names[0]]
+				}
+			} else {
+				value, found = scope.props[names[0]]
+			}
+		}
+	}
+
+	for _, name := range names[1:] {
+		if !found {
+			break
+		}
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, found = fields[name]
+	}
+
+	return value, found
+}
+
+// rootProps returns the component's props
+func (s *templateScope) rootProps() map[string]interface{} {
+	for scope := s; scope != nil; scope = scope.parent {
+		if !scope.inLoop {
+			return scope.props
+		}
+	}
+	return nil
+}
+
+// templateReport lists the placeholders a render could not resolve and the
+// props the template never refers to
+type templateReport struct {
+	unresolved []string
+	unused     []string
+}
+
+// templateContext connects a render to the document it is rendered into
+type templateContext struct {
+	// funcs resolves {{name:arg:...}} placeholders
+	funcs map[string]templateFunc
+	// hyperlink returns the relationship ID for an external link target
+	hyperlink func(target string) (string, error)
+	// note adds a footnote or endnote and returns the run that refers to it
+	note func(kind noteKind, spans []textSpan, rPr *etree.Element) (*etree.Element, error)
+	// lockControls locks the content controls the render fills
+	lockControls bool
+}
+
+// renderTemplate renders a parsed component fragment in place
+func renderTemplate(root *etree.Element, props map[string]interface{}, ctx templateContext) (*templateReport, error) {
+	if err := bindBlocks(root); err != nil {
+		return nil, err
+	}
+
+	referenced := referencedProps(root)
+
+	r := &templateRenderer{templateContext: ctx, seen: make(map[string]bool)}
+	if err := r.render(root, &templateScope{props: props}); err != nil {
+		return nil, err
+	}
+
+	ensureCellParagraphs(root)
+
+	report := &templateReport{unresolved: r.unresolved}
+	for name := range props {
+		if !referenced[name] {
+			report.unused = append(report.unused, name)
+		}
+	}
+	sort.Strings(report.unused)
+	return report, nil
+}
+
+// referencedProps collects the names a template refers to in its placeholders,
+// block markers, function arguments and content controls
+func referencedProps(root *etree.Element) map[string]bool {
+	referenced := make(map[string]bool)
+	collect := func(text string) {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			for _, name := range propNamePattern.FindAllString(match[1], -1) {
+				referenced[name] = true
+			}
+		}
+	}
+
+	for _, element := range append([]*etree.Element{root}, root.FindElements(".//*")...) {
+		if element.Tag == blockTag {
+			collect("{{" + element.SelectAttrValue("expr", "") + "}}")
+			continue
+		}
+		if element.FullTag() == "w:sdt" {
+			if name, _, bindable := contentControlProp(element); bindable {
+				collect("{{" + name + "}}")
+			}
+		}
+		for _, attr := range element.Attr {
+			collect(attr.Value)
+		}
+		for _, token := range element.Child {
+			if text, ok := token.(*etree.CharData); ok {
+				collect(text.Data)
+			}
+		}
+	}
+	return referenced
+}
+
+// templateRenderer expands blocks and placeholders
+type templateRenderer struct {
+	templateContext
+	// unresolved lists placeholders without a value, in document order
+	unresolved []string
+	seen       map[string]bool
+}
+
+// addUnresolved records a placeholder that could not be resolved
+func (r *templateRenderer) addUnresolved(placeholder string) {
+	if !r.seen[placeholder] {
+		r.seen[placeholder] = true
+		r.unresolved = append(r.unresolved, placeholder)
+	}
+}
+
+// render substitutes placeholders in an element's attributes and text and
+// expands the blocks among its descendants
+func (r *templateRenderer) render(element *etree.Element, scope *templateScope) error {
+	for i := range element.Attr {
+		value, err := r.substitute(element.Attr[i].Value, scope)
+		if err != nil {
+			return err
+		}
+		element.Attr[i].Value = value
+	}
+
+	children := append([]etree.Token(nil), element.Child...)
+	for _, token := range children {
+		switch child := token.(type) {
+		case *etree.CharData:
+			text, err := r.substitute(child.Data, scope)
+			if err != nil {
+				return err
+			}
+			child.Data = text
+		case *etree.Element:
+			if child.FullTag() == "w:r" {
+				expanded, err := r.renderRichRun(child, scope)
+				if err != nil {
+					return err
+				}
+				if expanded {
+					continue
+				}
+			}
+
+			var err error
+			switch {
+			case child.Tag == blockTag:
+				err = r.renderBlock(child, scope)
+			case child.FullTag() == "w:sdt":
+				err = r.renderContentControl(child, scope)
+			default:
+				err = r.render(child, scope)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if element.FullTag() == "w:t" {
+		preserveSpace(element)
+	}
+	return nil
+}
+
+// renderBlock replaces a block with its rendered content
+func (r *templateRenderer) renderBlock(block *etree.Element, scope *templateScope) error {
+	kind := block.SelectAttrValue("kind", "")
+	expr := block.SelectAttrValue("expr", "")
+	value, _ := scope.lookup(expr)
+
+	switch kind {
+	case "if", "unless":
+		if isTruthy(value) == (kind == "if") {
+			if err := r.render(block, scope); err != nil {
+				return err
+			}
+			unwrap(block, block)
+		}
+	case "each":
+		items, err := loopItems(expr, value)
+		if err != nil {
+			return err
+		}
+		for i, item := range items {
+			iteration := block.Copy()
+			if err := r.render(iteration, scope.loopScope(item, i)); err != nil {
+				return err
+			}
+			unwrap(iteration, block)
+		}
+	}
+
+	block.Parent().RemoveChild(block)
+	return nil
+}
+
+// substitute replaces the placeholders in text
+func (r *templateRenderer) substitute(text string, scope *templateScope) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var substituteErr error
+	result := placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if substituteErr != nil {
+			return placeholder
+		}
+
+		body := strings.TrimSpace(placeholderPattern.FindStringSubmatch(placeholder)[1])
+
+		if blockMarkerPattern.MatchString(placeholder) {
+			substituteErr = fmt.Errorf("block marker %s must be in document text", placeholder)
+			return placeholder
+		}
+
+		if match := templateFuncPattern.FindStringSubmatch(body); match != nil {
+			fn, exists := r.funcs[match[1]]
+			if !exists {
+				r.addUnresolved(placeholder)
+				return placeholder
+			}
+			value, err := fn(strings.Split(match[2], ":"), scope)
+			if err != nil {
+				substituteErr = err
+				return placeholder
+			}
+			return value
+		}
+
+		path, fallback, err := parseExpression(body)
+		if err != nil {
+			substituteErr = fmt.Errorf("invalid placeholder %s: %w", placeholder, err)
+			return placeholder
+		}
+
+		value, found := scope.lookup(path)
+		if (value == nil || value == "") && fallback != nil {
+			return *fallback
+		}
+		if !found || value == nil {
+			r.addUnresolved(placeholder)
+		}
+		return formatValue(value)
+	})
+
+	return result, substituteErr
+}
+
+// parseExpression splits a placeholder into its prop path and optional default
+func parseExpression(expr string) (string, *string, error) {
+	path, filter, hasFilter := strings.Cut(expr, "|")
+	path = strings.TrimSpace(path)
+	if !propPathPattern.MatchString(path) {
+		return "", nil, fmt.Errorf("%q is not a prop name", path)
+	}
+	if !hasFilter {
+		return path, nil, nil
+	}
+
+	filter = strings.TrimSpace(filter)
+	name, arg, _ := strings.Cut(filter, " ")
+	if name != "default" {
+		return "", nil, fmt.Errorf("unknown filter %q", name)
+	}
+	fallback := unquote(strings.TrimSpace(arg))
+	return path, &fallback, nil
+}
+
+// unquote strips straight or typographic quotes, which Word substitutes as you type
+func unquote(s string) string {
+	for _, pair := range [][2]string{{`"`, `"`}, {`'`, `'`}, {"“", "”"}, {"‘", "’"}} {
+		if len(s) >= len(pair[0])+len(pair[1]) && strings.HasPrefix(s, pair[0]) && strings.HasSuffix(s, pair[1]) {
+			return s[len(pair[0]) : len(s)-len(pair[1])]
+		}
+	}
+	return s
+}
+
+// formatValue converts a prop value to document text
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		if spans, ok, err := richTextSpans(v); ok && err == nil {
+			return spansText(spans)
+		}
+		return fmt.Sprintf("%v", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// isTruthy reports whether a prop counts as set for {{#if}}: missing values,
+// false, zero, empty strings and empty arrays or objects do not
+func isTruthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() != 0
+	}
+	return true
+}
+
+// loopItems returns the elements an {{#each}} block iterates over
+func loopItems(expr string, value interface{}) ([]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if items, ok := value.([]interface{}); ok {
+		return items, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("{{#each %s}} requires an array prop, got %T", expr, value)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// unwrap moves the content of block in front of anchor
+func unwrap(block, anchor *etree.Element) {
+	parent := anchor.Parent()
+	for _, token := range append([]etree.Token(nil), block.Child...) {
+		block.RemoveChild(token)
+		parent.InsertChild(anchor, token)
+	}
+}
+
+// preserveSpace marks a w:t whose text starts or ends with whitespace, which
+// Word would otherwise drop
+func preserveSpace(t *etree.Element) {
+	text := t.Text()
+	if text != strings.TrimSpace(text) {
+		t.CreateAttr("xml:space", "preserve")
+	}
+}
+
+// blockMarker is a run holding a single block marker
+type blockMarker struct {
+	run      *etree.Element
+	open     bool
+	kind     string
+	expr     string
+	position int
+}
+
+// bindBlocks moves the content of every block into a block element, so that
+// blocks can be expanded by walking the tree
+func bindBlocks(root *etree.Element) error {
+	isolateBlockMarkers(root)
+
+	var markers []blockMarker
+	for _, run := range root.FindElements(".//w:r") {
+		if marker, ok := parseBlockMarker(run); ok {
+			marker.position = len(markers)
+			markers = append(markers, marker)
+		}
+	}
+
+	type block struct{ open, close blockMarker }
+	var blocks []block
+	var stack []blockMarker
+	for _, marker := range markers {
+		if marker.open {
+			stack = append(stack, marker)
+			continue
+		}
+		if len(stack) == 0 {
+			return fmt.Errorf("{{/%s}} has no matching {{#%s}}", marker.kind, marker.kind)
+		}
+		open := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if open.kind != marker.kind {
+			return fmt.Errorf("{{/%s}} closes {{#%s %s}}", marker.kind, open.kind, open.expr)
+		}
+		if !propPathPattern.MatchString(open.expr) {
+			return fmt.Errorf("{{#%s %s}} does not name a prop", open.kind, open.expr)
+		}
+		blocks = append(blocks, block{open, marker})
+	}
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return fmt.Errorf("{{#%s %s}} is not closed", open.kind, open.expr)
+	}
+
+	// Outer blocks are bound first so that an inner block covering the same
+	// paragraph ends up inside the outer one
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].open.position < blocks[j].open.position
+	})
+	for _, b := range blocks {
+		wrapBlock(b.open, b.close)
+	}
+
+	return nil
+}
+
+// wrapBlock moves the elements a block covers into a block element and
+// removes the block's markers
+func wrapBlock(open, close blockMarker) {
+	scope := commonAncestor(open.run, close.run)
+	first := childOnPath(scope, open.run)
+	last := childOnPath(scope, close.run)
+	trimBoundaries := true
+
+	switch {
+	case scope.FullTag() == "w:tr":
+		// Markers in different cells repeat or remove the whole row
+		first, last = scope, scope
+		scope = scope.Parent()
+		trimBoundaries = false
+	case scope.FullTag() == "w:p" && first == firstContent(scope) && last == lastContent(scope):
+		// Markers around all of a paragraph's text cover the paragraph
+		first, last = scope, scope
+		scope = scope.Parent()
+		trimBoundaries = false
+	}
+
+	block := etree.NewElement(blockTag)
+	block.CreateAttr("kind", open.kind)
+	block.CreateAttr("expr", open.expr)
+
+	covered := append([]etree.Token(nil), scope.Child[first.Index():last.Index()+1]...)
+	scope.InsertChild(first, block)
+	for _, token := range covered {
+		scope.RemoveChild(token)
+		block.AddChild(token)
+	}
+
+	open.run.Parent().RemoveChild(open.run)
+	close.run.Parent().RemoveChild(close.run)
+
+	// Drop paragraphs that only held a marker
+	if trimBoundaries {
+		for _, boundary := range []*etree.Element{first, last} {
+			if boundary.Parent() == block && boundary.FullTag() == "w:p" && firstContent(boundary) == nil {
+				block.RemoveChild(boundary)
+			}
+		}
+	}
+}
+
+// firstContent returns the first child of a paragraph that is not a property,
+// bookmark or proofing mark
+func firstContent(p *etree.Element) *etree.Element {
+	for _, child := range p.ChildElements() {
+		if !isParagraphMarkup(child) {
+			return child
+		}
+	}
+	return nil
+}
+
+// lastContent returns the last child of a paragraph that is not a property,
+// bookmark or proofing mark
+func lastContent(p *etree.Element) *etree.Element {
+	children := p.ChildElements()
+	for i := len(children) - 1; i >= 0; i-- {
+		if !isParagraphMarkup(children[i]) {
+			return children[i]
+		}
+	}
+	return nil
+}
+
+// isParagraphMarkup reports whether a paragraph child carries no content
+func isParagraphMarkup(element *etree.Element) bool {
+	switch element.FullTag() {
+	case "w:pPr", "w:bookmarkStart", "w:bookmarkEnd", "w:proofErr":
+		return true
+	}
+	return false
+}
+
+// commonAncestor returns the deepest element that contains both a and b
+func commonAncestor(a, b *etree.Element) *etree.Element {
+	ancestors := make(map[*etree.Element]bool)
+	for element := a.Parent(); element != nil; element = element.Parent() {
+		ancestors[element] = true
+	}
+	for element := b.Parent(); element != nil; element = element.Parent() {
+		if ancestors[element] {
+			return element
+		}
+	}
+	return nil
+}
+
+// childOnPath returns the child of ancestor that contains element
+func childOnPath(ancestor, element *etree.Element) *etree.Element {
+	for element.Parent() != ancestor {
+		element = element.Parent()
+	}
+	return element
+}
+
+// isolateBlockMarkers splits runs so that every block marker is alone in a
+// run of its own, keeping the run's formatting for the surrounding text
+func isolateBlockMarkers(root *etree.Element) {
+	for _, run := range root.FindElements(".//w:r") {
+		hasMarker := false
+		for _, t := range run.SelectElements("w:t") {
+			if blockMarkerPattern.MatchString(t.Text()) {
+				hasMarker = true
+			}
+		}
+		if hasMarker {
+			splitRunAtMarkers(run)
+		}
+	}
+}
+
+// splitRunAtMarkers replaces a run with runs of its text between and at each block marker
+func splitRunAtMarkers(run *etree.Element) {
+	rPr := run.SelectElement("w:rPr")
+	splitRun(run, blockMarkerPattern, func(marker string) ([]*etree.Element, bool) {
+		markerRun := newRun(rPr)
+		addRunText(markerRun, marker)
+		return []*etree.Element{markerRun}, true
+	})
+}
+
+// splitRun replaces a run with runs of its text between the matches of pattern
+// and the elements replace returns for each match; matches replace declines
+// stay in the text. The run's formatting is kept for the surrounding text.
+// It returns the elements that took the run's place.
+func splitRun(run *etree.Element, pattern *regexp.Regexp, replace func(match string) ([]*etree.Element, bool)) []*etree.Element {
+	rPr := run.SelectElement("w:rPr")
+
+	var pieces []*etree.Element
+	current := newRun(rPr)
+	flush := func() {
+		if hasRunContent(current) {
+			pieces = append(pieces, current)
+		}
+		current = newRun(rPr)
+	}
+
+	for _, child := range run.ChildElements() {
+		if child == rPr {
+			continue
+		}
+		if child.FullTag() != "w:t" {
+			current.AddChild(child.Copy())
+			continue
+		}
+
+		text := child.Text()
+		last := 0
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			replacement, ok := replace(text[loc[0]:loc[1]])
+			if !ok {
+				continue
+			}
+			if before := text[last:loc[0]]; before != "" {
+				addRunText(current, before)
+			}
+			flush()
+			pieces = append(pieces, replacement...)
+			last = loc[1]
+		}
+		if after := text[last:]; after != "" {
+			addRunText(current, after)
+		}
+	}
+	flush()
+
+	parent := run.Parent()
+	for _, piece := range pieces {
+		parent.InsertChild(run, piece)
+	}
+	parent.RemoveChild(run)
+	return pieces
+}
+
+// newRun creates an empty run with a copy of the given run properties
+func newRun(rPr *etree.Element) *etree.Element {
+	run := etree.NewElement("w:r")
+	if rPr != nil {
+		run.AddChild(rPr.Copy())
+	}
+	return run
+}
+
+// addRunText appends a w:t holding text to a run
+func addRunText(run *etree.Element, text string) {
+	t := run.CreateElement("w:t")
+	t.SetText(text)
+	preserveSpace(t)
+}
+
+// parseBlockMarker reports whether a run holds only a block marker
+func parseBlockMarker(run *etree.Element) (blockMarker, bool) {
+	var text *etree.Element
+	for _, child := range run.ChildElements() {
+		switch {
+		case child.FullTag() == "w:rPr":
+		case child.FullTag() == "w:t" && text == nil:
+			text = child
+		default:
+			return blockMarker{}, false
+		}
+	}
+	if text == nil {
+		return blockMarker{}, false
+	}
+
+	value := strings.TrimSpace(text.Text())
+	match := blockMarkerPattern.FindStringSubmatch(value)
+	if match == nil || match[0] != value {
+		return blockMarker{}, false
+	}
+	return blockMarker{run: run, open: match[1] == "#", kind: match[2], expr: match[3]}, true
+}
+
+// ensureCellParagraphs adds an empty paragraph to table cells left without
+// one, which Word requires
+func ensureCellParagraphs(root *etree.Element) {
+	for _, cell := range root.FindElements(".//w:tc") {
+		if cell.SelectElement("w:p") == nil {
+			cell.CreateElement("w:p")
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// tocInstruction is the field code of the table of contents: heading levels
+// 1-3 as hyperlinks, without page numbers in web view, plus paragraphs with
+// outline levels
+const tocInstruction = ` TOC \o "1-3" \h \z \u `
+
+// maxHeadingLevel is the deepest heading level the table of contents lists
+const maxHeadingLevel = 3
+
+// settingsPart holds the document settings, such as w:updateFields
+const settingsPart = "word/settings.xml"
+
+// headingStylePattern matches the paragraph styles of headings the table of
+// contents lists
+var headingStylePattern = regexp.MustCompile(`^Heading([1-3])$`)
+
+// lvlTextPattern matches the level references in a numbering level's text
+var lvlTextPattern = regexp.MustCompile(`%([1-9])`)
+
+// settingsAfterUpdateFields are the w:settings children that follow
+// w:updateFields in schema order
+var settingsAfterUpdateFields = map[string]bool{
+	"w:hdrShapeDefaults": true, "w:footnotePr": true, "w:endnotePr": true, "w:compat": true,
+	"w:docVars": true, "w:rsids": true, "m:mathPr": true, "w:attachedSchema": true,
+	"w:themeFontLang": true, "w:clrSchemeMapping": true, "w:doNotIncludeSubdocsInStats": true,
+	"w:doNotAutoCompressPictures": true, "w:forceUpgrade": true, "w:captions": true,
+	"w:readModeInkLockDown": true, "w:smartTagType": true, "sl:schemaLibrary": true,
+	"w:shapeDefaults": true, "w:doNotEmbedSmartTags": true, "w:decimalSymbol": true,
+	"w:listSeparator": true,
+}
+
+// headingSpec is the Heading component: a paragraph in the shell's Heading1,
+// Heading2 or Heading3 style
+type headingSpec struct{}
+
+// headingProps are the props of a Heading component
+type headingProps struct {
+	// Text is a string or rich text
+	Text  interface{} `json:"text"`
+	Level int         `json:"level"`
+}
+
+// build renders the heading paragraph. Its bookmark is added with the table
+// of contents, since only then is the document order known.
+func (headingSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	var heading headingProps
+	if err := decodeProps(props, &heading); err != nil {
+		return nil, nil, fmt.Errorf("invalid heading props: %w", err)
+	}
+	if heading.Level < 1 || heading.Level > maxHeadingLevel {
+		return nil, nil, fmt.Errorf("heading level must be between 1 and %d, got %d", maxHeadingLevel, heading.Level)
+	}
+
+	report := &templateReport{}
+	if heading.Text == nil {
+		report.unresolved = append(report.unresolved, "{{ text }}")
+	}
+
+	p := etree.NewElement("w:p")
+	setParagraphStyle(p, fmt.Sprintf("Heading%d", heading.Level))
+	r := &templateRenderer{templateContext: a.spanContext(), seen: make(map[string]bool)}
+	runs, err := r.valueRuns(heading.Text, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, run := range runs {
+		p.AddChild(run)
+	}
+	return []*etree.Element{p}, report, nil
+}
+
+// tocSpec is the TOC component: a table of contents field listing the
+// document's headings
+type tocSpec struct{}
+
+// tocProps are the props of a TOC component
+type tocProps struct {
+	// Title is shown above the table of contents in the TOCHeading style
+	Title string `json:"title,omitempty"`
+}
+
+// build renders the title and a placeholder paragraph that
+// finishTableOfContents replaces with the field
+func (tocSpec) build(a *assembly, props map[string]interface{}) ([]*etree.Element, *templateReport, error) {
+	var toc tocProps
+	if err := decodeProps(props, &toc); err != nil {
+		return nil, nil, fmt.Errorf("invalid TOC props: %w", err)
+	}
+
+	var elements []*etree.Element
+	if toc.Title != "" {
+		title := etree.NewElement("w:p")
+		setParagraphStyle(title, "TOCHeading")
+		addSpanText(title.CreateElement("w:r"), toc.Title)
+		elements = append(elements, title)
+	}
+
+	placeholder := etree.NewElement("w:p")
+	a.tableOfContents = append(a.tableOfContents, placeholder)
+	return append(elements, placeholder), &templateReport{}, nil
+}
+
+// tocEntry is one heading listed in the table of contents
+type tocEntry struct {
+	level    int
+	number   string
+	text     string
+	bookmark string
+}
+
+// finishTableOfContents bookmarks every heading in the document and fills
+// each TOC with an entry per heading, so the table is usable before its field
+// is updated. Word recalculates the page numbers when the document is opened.
+func (a *assembly) finishTableOfContents() error {
+	if len(a.tableOfContents) == 0 {
+		return nil
+	}
+
+	numbers, err := a.headingNumbers()
+	if err != nil {
+		return err
+	}
+
+	bookmarks := newBookmarkAllocator(a.body)
+	var entries []tocEntry
+	for _, p := range elementsInOrder(a.body, "w:p") {
+		level := headingLevel(p)
+		if level == 0 {
+			continue
+		}
+		entry := tocEntry{level: level, number: numbers.next(p), text: paragraphText(p)}
+		entry.bookmark = bookmarks.wrap(p)
+		entries = append(entries, entry)
+	}
+
+	for _, placeholder := range a.tableOfContents {
+		parent := placeholder.Parent()
+		for _, p := range tocParagraphs(entries) {
+			parent.InsertChild(placeholder, p)
+		}
+		parent.RemoveChild(placeholder)
+	}
+
+	// Ask Word to refresh the fields, and so the page numbers, on opening
+	return a.docx.updatePart(settingsPart, func(root *etree.Element) error {
+		updateFields := etree.NewElement("w:updateFields")
+		updateFields.CreateAttr("w:val", "true")
+		if existing := root.SelectElement("w:updateFields"); existing != nil {
+			root.RemoveChild(existing)
+		}
+		for _, child := range root.ChildElements() {
+			if settingsAfterUpdateFields[child.FullTag()] {
+				root.InsertChild(child, updateFields)
+				return nil
+			}
+		}
+		root.AddChild(updateFields)
+		return nil
+	})
+}
+
+// headingLevel returns the heading level of a paragraph, or 0 if its style is
+// not one the table of contents lists
+func headingLevel(p *etree.Element) int {
+	pStyle := p.FindElement("w:pPr/w:pStyle")
+	if pStyle == nil {
+		return 0
+	}
+	match := headingStylePattern.FindStringSubmatch(pStyle.SelectAttrValue("w:val", ""))
+	if match == nil {
+		return 0
+	}
+	level, _ := strconv.Atoi(match[1])
+	return level
+}
+
+// paragraphText returns the visible text of a paragraph
+func paragraphText(p *etree.Element) string {
+	var text strings.Builder
+	for _, element := range elementsInOrder(p, "w:t") {
+		text.WriteString(element.Text())
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// tocParagraphs builds the paragraphs of a TOC field. The field begins in the
+// first entry and ends after the last; without headings it holds Word's own
+// "no entries" text.
+func tocParagraphs(entries []tocEntry) []*etree.Element {
+	if len(entries) == 0 {
+		p := etree.NewElement("w:p")
+		addFieldStart(p, tocInstruction)
+		p.CreateElement("w:r").CreateElement("w:t").SetText("No table of contents entries found.")
+		addFieldChar(p, "end")
+		return []*etree.Element{p}
+	}
+
+	paragraphs := make([]*etree.Element, 0, len(entries))
+	for i, entry := range entries {
+		p := etree.NewElement("w:p")
+		setParagraphStyle(p, fmt.Sprintf("TOC%d", entry.level))
+		if i == 0 {
+			addFieldStart(p, tocInstruction)
+		}
+
+		hyperlink := p.CreateElement("w:hyperlink")
+		hyperlink.CreateAttr("w:anchor", entry.bookmark)
+		hyperlink.CreateAttr("w:history", "1")
+		if entry.number != "" {
+			addRunText(tocRun(hyperlink), entry.number)
+			tocRun(hyperlink).CreateElement("w:tab")
+		}
+		addRunText(tocRun(hyperlink), entry.text)
+		tocRun(hyperlink).CreateElement("w:tab")
+		addFieldStart(hyperlink, fmt.Sprintf(" PAGEREF %s \\h ", entry.bookmark))
+		addFieldChar(hyperlink, "end")
+
+		if i == len(entries)-1 {
+			addFieldChar(p, "end")
+		}
+		paragraphs = append(paragraphs, p)
+	}
+	return paragraphs
+}
+
+// tocRun appends a run that is not spell checked, as Word writes TOC entries
+func tocRun(parent *etree.Element) *etree.Element {
+	run := parent.CreateElement("w:r")
+	run.CreateElement("w:rPr").CreateElement("w:noProof")
+	return run
+}
+
+// addFieldStart appends the runs that begin a complex field up to its result
+func addFieldStart(parent *etree.Element, instruction string) {
+	addFieldChar(parent, "begin")
+	instrText := tocRun(parent).CreateElement("w:instrText")
+	instrText.CreateAttr("xml:space", "preserve")
+	instrText.SetText(instruction)
+	addFieldChar(parent, "separate")
+}
+
+// addFieldChar appends a run holding a complex field character
+func addFieldChar(parent *etree.Element, fieldCharType string) {
+	tocRun(parent).CreateElement("w:fldChar").CreateAttr("w:fldCharType", fieldCharType)
+}
+
+// bookmarkAllocator hands out bookmark IDs and _Toc names that are not yet
+// used in the document
+type bookmarkAllocator struct {
+	nextID int
+	names  map[string]bool
+	next   int
+}
+
+// newBookmarkAllocator collects the bookmarks already in the document
+func newBookmarkAllocator(root *etree.Element) *bookmarkAllocator {
+	b := &bookmarkAllocator{names: make(map[string]bool), next: 1}
+	for _, bookmark := range elementsInOrder(root, "w:bookmarkStart") {
+		b.names[bookmark.SelectAttrValue("w:name", "")] = true
+		if id, err := strconv.Atoi(bookmark.SelectAttrValue("w:id", "")); err == nil && id >= b.nextID {
+			b.nextID = id + 1
+		}
+	}
+	return b
+}
+
+// wrap bookmarks the content of a paragraph and returns the bookmark's name
+func (b *bookmarkAllocator) wrap(p *etree.Element) string {
+	name := fmt.Sprintf("_Toc%09d", b.next)
+	for b.names[name] {
+		b.next++
+		name = fmt.Sprintf("_Toc%09d", b.next)
+	}
+	b.names[name] = true
+	id := strconv.Itoa(b.nextID)
+	b.nextID++
+
+	start := etree.NewElement("w:bookmarkStart")
+	start.CreateAttr("w:id", id)
+	start.CreateAttr("w:name", name)
+	if pPr := p.SelectElement("w:pPr"); pPr != nil {
+		p.InsertChildAt(pPr.Index()+1, start)
+	} else {
+		p.InsertChildAt(0, start)
+	}
+	p.CreateElement("w:bookmarkEnd").CreateAttr("w:id", id)
+	return name
+}
+
+// headingNumbering computes the numbers Word shows in front of headings whose
+// style is numbered, such as "2.1", so they can be listed in the table of
+// contents before its field is updated
+type headingNumbering struct {
+	// levels holds the numbering of each heading level, if it has any
+	levels map[int]*numberingLevel
+	// counters holds the current count of every level of each list
+	counters map[string][]int
+}
+
+// numberingLevel is the numbering of a heading style
+type numberingLevel struct {
+	numID string
+	ilvl  int
+	// texts holds w:lvlText of the list's levels, "" where a level is not decimal
+	texts []string
+	// starts holds w:start of the list's levels
+	starts []int
+}
+
+// headingNumbers reads how the shell numbers the Heading1-3 styles
+func (a *assembly) headingNumbers() (*headingNumbering, error) {
+	numbering := &headingNumbering{levels: make(map[int]*numberingLevel), counters: make(map[string][]int)}
+
+	styles, numberingRoot := etree.NewDocument(), etree.NewDocument()
+	stylesXML, hasStyles := a.docx[stylesPart]
+	numberingXML, hasNumbering := a.docx[numberingPart]
+	if !hasStyles || !hasNumbering {
+		return numbering, nil
+	}
+	if err := styles.ReadFromBytes(stylesXML); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", stylesPart, err)
+	}
+	if err := numberingRoot.ReadFromBytes(numberingXML); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", numberingPart, err)
+	}
+
+	for level := 1; level <= maxHeadingLevel; level++ {
+		numPr := styles.FindElement(fmt.Sprintf("//w:style[@w:styleId='Heading%d']/w:pPr/w:numPr", level))
+		if numPr == nil {
+			continue
+		}
+		numID := numPr.FindElement("w:numId")
+		if numID == nil || numID.SelectAttrValue("w:val", "0") == "0" {
+			continue
+		}
+		ilvl := 0
+		if element := numPr.FindElement("w:ilvl"); element != nil {
+			ilvl, _ = strconv.Atoi(element.SelectAttrValue("w:val", "0"))
+		}
+
+		num := numberingRoot.FindElement(fmt.Sprintf("//w:num[@w:numId='%s']/w:abstractNumId", numID.SelectAttrValue("w:val", "")))
+		if num == nil {
+			continue
+		}
+		abstract := numberingRoot.FindElement(fmt.Sprintf("//w:abstractNum[@w:abstractNumId='%s']", num.SelectAttrValue("w:val", "")))
+		if abstract == nil {
+			continue
+		}
+
+		numbered := &numberingLevel{numID: numID.SelectAttrValue("w:val", ""), ilvl: ilvl}
+		for _, lvl := range abstract.SelectElements("w:lvl") {
+			text := ""
+			if format := lvl.FindElement("w:numFmt"); format == nil || format.SelectAttrValue("w:val", "") == "decimal" {
+				if lvlText := lvl.FindElement("w:lvlText"); lvlText != nil {
+					text = lvlText.SelectAttrValue("w:val", "")
+				}
+			}
+			start := 1
+			if element := lvl.FindElement("w:start"); element != nil {
+				start, _ = strconv.Atoi(element.SelectAttrValue("w:val", "1"))
+			}
+			numbered.texts = append(numbered.texts, text)
+			numbered.starts = append(numbered.starts, start)
+		}
+		if ilvl < len(numbered.texts) {
+			numbering.levels[level] = numbered
+		}
+	}
+	return numbering, nil
+}
+
+// next counts a heading and returns its number, or "" if it is not numbered
+func (n *headingNumbering) next(p *etree.Element) string {
+	numbered := n.levels[headingLevel(p)]
+	if numbered == nil || p.FindElement("w:pPr/w:numPr") != nil {
+		return ""
+	}
+
+	counters := n.counters[numbered.numID]
+	if counters == nil {
+		counters = make([]int, len(numbered.texts))
+		for i := range counters {
+			counters[i] = numbered.starts[i] - 1
+		}
+		n.counters[numbered.numID] = counters
+	}
+	counters[numbered.ilvl]++
+	for i := numbered.ilvl + 1; i < len(counters); i++ {
+		counters[i] = numbered.starts[i] - 1
+	}
+
+	number := numbered.texts[numbered.ilvl]
+	for _, reference := range lvlTextPattern.FindAllStringSubmatch(number, -1) {
+		i := int(reference[1][0] - '1')
+		if i >= len(counters) || numbered.texts[i] == "" {
+			// Only decimal numbers are reproduced
+			return ""
+		}
+		// A level that has not started yet shows its start value
+		number = strings.Replace(number, reference[0], strconv.Itoa(max(counters[i], numbered.starts[i])), 1)
+	}
+	return number
+}
@@ -1,22 +1,71 @@
 package docgen
 
-import "docgen-service/internal/validator"
+import (
+	"io/fs"
+
+	"github.com/beevik/etree"
+
+	"docgen-service/internal/validator"
+)
 
 // DocumentPlan represents the top-level JSON structure for document generation
 type DocumentPlan struct {
+	// Template names the registry template to render with; empty means the default
+	Template string              `json:"template,omitempty"`
 	DocProps DocProps            `json:"doc_props"`
 	Body     []ComponentInstance `json:"body"`
 }
 
 // DocProps contains metadata about the document to be generated
 type DocProps struct {
-	Filename string `json:"filename"`
+	Filename    string `json:"filename"`
+	Title       string `json:"title,omitempty"`
+	Subject     string `json:"subject,omitempty"`
+	Creator     string `json:"creator,omitempty"`
+	Keywords    string `json:"keywords,omitempty"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Revision    int    `json:"revision,omitempty"`
+	// Created and Modified are RFC 3339 timestamps or YYYY-MM-DD dates
+	Created  string `json:"created,omitempty"`
+	Modified string `json:"modified,omitempty"`
+	// Header and Footer are repeated at the top and bottom of every page
+	Header *HeaderFooter `json:"header,omitempty"`
+	Footer *HeaderFooter `json:"footer,omitempty"`
+	// BoundProps names the props written to the DocGen custom XML part for
+	// content controls to bind to; empty writes every prop when controls are bound
+	BoundProps []string `json:"bound_props,omitempty"`
+}
+
+// HeaderFooter is the content of the page header or footer. Text is a
+// template: {{ page }} and {{ pages }} become page number fields, the core
+// document properties are available as {{ title }}, {{ subject }} etc., and
+// the props of body components by component name, e.g.
+// {{ DocumentSubject.document_subject }}. In JSON it may also be given as a
+// plain string.
+type HeaderFooter struct {
+	Text string `json:"text"`
+	// Align is left, center or right; empty keeps the style's alignment
+	Align string `json:"align,omitempty"`
 }
 
 // ComponentInstance represents a single component to be rendered in the document
 type ComponentInstance struct {
 	Component string                 `json:"component"`
 	Props     map[string]interface{} `json:"props"`
+	// Slot names the shell insertion point to render into; empty means DefaultSlot
+	Slot string `json:"slot,omitempty"`
+	// LockControls locks the content controls the component fills against editing
+	LockControls bool `json:"lock_controls,omitempty"`
+}
+
+// AssembleResult is a generated document together with its content hash
+type AssembleResult struct {
+	Document []byte
+	// SHA256 is the hex-encoded SHA-256 digest of Document
+	SHA256 string
+	// Warnings lists the template mismatches found outside strict mode
+	Warnings []*TemplateMismatchError
 }
 
 // InMemoryDocx represents a DOCX file loaded into memory as a map of file paths to content
@@ -24,7 +73,26 @@ type InMemoryDocx map[string][]byte
 
 // Engine holds the loaded shell document and component library
 type Engine struct {
-	shell      InMemoryDocx
+	shell InMemoryDocx
+	// document is the shell's word/document.xml parsed at load; it is never
+	// modified, assemblies work on copies
+	document   *etree.Document
 	components map[string]string
-	validator  *validator.Validator
+	// trees holds each component template parsed at load, wrapped in a
+	// temporary root; like document it is only ever copied
+	trees map[string]*etree.Element
+	// resources holds the parts directory components bring along, by name
+	resources map[string]*componentResources
+	// specs holds the components built from metadata rather than templates
+	specs map[string]ComponentSpec
+	// versions holds the loaded component of each version of a component
+	versions componentVersions
+	// unlistedVersions maps the versions the schema has no rules for to the
+	// component name they are validated as
+	unlistedVersions map[string]string
+	validator        *validator.Validator
+	// media holds the files image props may reference by path
+	media fs.FS
+	// strict makes template mismatches fail assembly unless a request overrides it
+	strict bool
 }
\ No newline at end of file
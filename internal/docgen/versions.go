@@ -0,0 +1,186 @@
+package docgen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"docgen-service/internal/validator"
+)
+
+// A component may exist in several versions side by side, so documents that
+// have been issued keep their layout when the component changes. Each version
+// is a component of its own, named <Name>@<N>:
+//
+//	TestBlock.component.xml      version 1
+//	TestBlock@2.component.xml    version 2
+//	TestBlock@3/document.xml     version 3
+//
+// A component without a version is version 1. Plans pin a version with
+// "component": "TestBlock@2"; "TestBlock" selects the latest version. Plans
+// are validated against the schema's rules for the version they resolve to,
+// which the schema names like the component file: TestBlock for version 1,
+// TestBlock@2 for version 2. A version the schema does not list is validated
+// against the rules of the component's name, so adding a version file does
+// not require a schema change unless its props differ.
+
+// componentRefPattern matches component references, capturing the name and
+// the version, if any
+var componentRefPattern = regexp.MustCompile(`^([^@]+)(?:@([1-9][0-9]*))?$`)
+
+// parseComponentRef splits a component reference into its name and version,
+// which is 0 when the reference does not pin one
+func parseComponentRef(ref string) (string, int, bool) {
+	match := componentRefPattern.FindStringSubmatch(ref)
+	if match == nil {
+		return "", 0, false
+	}
+	if match[2] == "" {
+		return match[1], 0, true
+	}
+	version, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return match[1], version, true
+}
+
+// componentVersions maps component names to the loaded component of each of
+// their versions
+type componentVersions map[string]map[int]string
+
+// indexComponentVersions groups the loaded components by name and version
+func indexComponentVersions(loaded []string) (componentVersions, error) {
+	versions := make(componentVersions)
+	for _, key := range loaded {
+		name, version, ok := parseComponentRef(key)
+		if !ok {
+			return nil, fmt.Errorf("invalid component name %q: versions are written as <Name>@<N>", key)
+		}
+		if version == 0 {
+			version = 1
+		}
+		if versions[name] == nil {
+			versions[name] = make(map[int]string)
+		}
+		if existing, exists := versions[name][version]; exists {
+			return nil, fmt.Errorf("version %d of component %s is defined by both %s and %s", version, name, existing, key)
+		}
+		versions[name][version] = key
+	}
+	return versions, nil
+}
+
+// latest returns the highest version of a component
+func (v componentVersions) latest(name string) int {
+	latest := 0
+	for version := range v[name] {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// unlistedVersions finds the component versions the schema does not list,
+// which are validated against the rules of the component's name
+func unlistedVersions(versions componentVersions, val *validator.Validator) map[string]string {
+	unlisted := make(map[string]string)
+	for name, byVersion := range versions {
+		for _, key := range byVersion {
+			if key != name && !val.AcceptsComponent(key) {
+				unlisted[key] = name
+			}
+		}
+	}
+	return unlisted
+}
+
+// resolveComponent returns the loaded component a plan's reference selects:
+// the version it pins, or the latest version of the component
+func (e *Engine) resolveComponent(ref string) (string, error) {
+	name, version, ok := parseComponentRef(ref)
+	if !ok {
+		return "", &ComponentNotFoundError{ComponentName: ref}
+	}
+	if _, indexed := e.versions[name]; !indexed && version == 0 {
+		// Engines built without loading have no index; look the name up as is
+		return ref, nil
+	}
+	if version == 0 {
+		version = e.versions.latest(name)
+	}
+	key, exists := e.versions[name][version]
+	if !exists {
+		return "", &ComponentNotFoundError{ComponentName: ref}
+	}
+	return key, nil
+}
+
+// componentName returns the name of a referenced component without its version
+func componentName(ref string) string {
+	if name, _, ok := parseComponentRef(ref); ok {
+		return name
+	}
+	return ref
+}
+
+// GetComponentVersions returns the sorted versions of every loaded component
+func (e *Engine) GetComponentVersions() map[string][]int {
+	versions := make(map[string][]int, len(e.versions))
+	for name, byVersion := range e.versions {
+		for version := range byVersion {
+			versions[name] = append(versions[name], version)
+		}
+		sort.Ints(versions[name])
+	}
+	return versions
+}
+
+// pinComponentVersions returns a copy of a plan whose component references
+// name the loaded component they resolve to, so the schema's rules for that
+// version apply, or the component's name when the schema has no rules for the
+// version. References to unknown components are left for the schema to reject.
+func (e *Engine) pinComponentVersions(plan map[string]interface{}) map[string]interface{} {
+	body, ok := plan["body"].([]interface{})
+	if !ok {
+		return plan
+	}
+
+	pinned := make([]interface{}, len(body))
+	for i, item := range body {
+		pinned[i] = item
+		instance, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ref, ok := instance["component"].(string)
+		if !ok {
+			continue
+		}
+		key, err := e.resolveComponent(ref)
+		if err != nil {
+			continue
+		}
+		if name, unlisted := e.unlistedVersions[key]; unlisted {
+			key = name
+		}
+		if key == ref {
+			continue
+		}
+		copied := make(map[string]interface{}, len(instance))
+		for field, value := range instance {
+			copied[field] = value
+		}
+		copied["component"] = key
+		pinned[i] = copied
+	}
+
+	copied := make(map[string]interface{}, len(plan))
+	for field, value := range plan {
+		copied[field] = value
+	}
+	copied["body"] = pinned
+	return copied
+}
@@ -2,6 +2,11 @@ package validator
 
 import (
 	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"cuelang.org/go/cue"
@@ -30,10 +35,38 @@ type Validator struct {
 
 // New creates a new validator instance by loading the CUE schema from the specified path
 func New(schemaPath string) (*Validator, error) {
+	source, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CUE schema: %w", err)
+	}
+	return compile(schemaPath, source)
+}
+
+// NewFS creates a new validator instance by loading the CUE schema at
+// schemaPath in fsys
+func NewFS(fsys fs.FS, schemaPath string) (*Validator, error) {
+	source, err := fs.ReadFile(fsys, schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CUE schema: %w", err)
+	}
+	return compile(schemaPath, source)
+}
+
+// compile builds a validator from the source of a CUE schema. The CUE loader
+// reads files from disk, so the source is presented to it as an overlay file
+// in a directory that does not exist.
+func compile(schemaPath string, source []byte) (*Validator, error) {
 	ctx := cuecontext.New()
 
+	dir := filepath.Join(os.TempDir(), "docgen-schema")
+	file := filepath.Join(dir, path.Base(filepath.ToSlash(schemaPath)))
+	config := &load.Config{
+		Dir:     dir,
+		Overlay: map[string]load.Source{file: load.FromBytes(source)},
+	}
+
 	// Load the CUE configuration
-	buildInstances := load.Instances([]string{schemaPath}, nil)
+	buildInstances := load.Instances([]string{file}, config)
 	if len(buildInstances) == 0 {
 		return nil, fmt.Errorf("no CUE instances found at path: %s", schemaPath)
 	}
@@ -49,6 +82,11 @@ func New(schemaPath string) (*Validator, error) {
 		return nil, fmt.Errorf("failed to build CUE schema: %w", err)
 	}
 
+	// Plans are validated against #DocumentPlan, so a schema without it is unusable
+	if !schema.LookupPath(cue.ParsePath("#DocumentPlan")).Exists() {
+		return nil, fmt.Errorf("CUE schema %s does not define #DocumentPlan", schemaPath)
+	}
+
 	return &Validator{
 		ctx:    ctx,
 		schema: schema,
@@ -58,7 +96,7 @@ func New(schemaPath string) (*Validator, error) {
 // Validate validates a document plan against the CUE schema
 func (v *Validator) Validate(plan map[string]interface{}) *ValidationResult {
 	// Convert the plan to a CUE value
-	planValue := v.ctx.Encode(plan)
+	planValue := v.ctx.Encode(integralNumbers(plan))
 	if err := planValue.Err(); err != nil {
 		return &ValidationResult{
 			Valid: false,
@@ -96,6 +134,49 @@ func (v *Validator) Validate(plan map[string]interface{}) *ValidationResult {
 	}
 }
 
+// AcceptsComponent reports whether the schema allows name as the component of
+// a body instance
+func (v *Validator) AcceptsComponent(name string) bool {
+	component := v.schema.LookupPath(cue.ParsePath("#DocumentPlan.body")).LookupPath(cue.MakePath(cue.AnyIndex, cue.Str("component")))
+	if !component.Exists() {
+		return false
+	}
+	return component.Unify(v.ctx.Encode(name)).Validate(cue.Concrete(true)) == nil
+}
+
+// integralNumbers returns a copy of a value decoded from JSON in which whole
+// numbers are ints. JSON decoding makes every number a float64, which CUE
+// encodes as a float that int constraints such as revision?: int reject.
+func integralNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = integralNumbers(item)
+		}
+		return copied
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = integralNumbers(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
 // extractValidationErrors converts CUE errors to structured validation errors
 func extractValidationErrors(err error) []ValidationError {
 	var validationErrors []ValidationError
@@ -208,7 +289,8 @@ func (v *Validator) validateComposition(plan map[string]interface{}) []Validatio
 			continue
 		}
 
-		if componentType == "DocumentTitle" {
+		// Every version of the title counts, e.g. DocumentTitle@2
+		if name, _, _ := strings.Cut(componentType, "@"); name == "DocumentTitle" {
 			titleCount++
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"testing"
+	"testing/fstest"
 )
 
 func TestValidatorInitialization(t *testing.T) {
@@ -19,6 +20,43 @@ func TestValidatorInitialization(t *testing.T) {
 	}
 }
 
+func TestValidatorFromFS(t *testing.T) {
+	schema, err := os.ReadFile("../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	fsys := fstest.MapFS{"schemas/rules.cue": {Data: schema}}
+
+	validator, err := NewFS(fsys, "schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to initialize validator from FS: %v", err)
+	}
+	result := validator.Validate(map[string]interface{}{
+		"doc_props": map[string]interface{}{"filename": "fs.docx"},
+		"body": []interface{}{
+			map[string]interface{}{"component": "DocumentTitle", "props": map[string]interface{}{"document_title": "Loaded from an FS"}},
+		},
+	})
+	if !result.Valid {
+		t.Errorf("Expected plan to be valid, got errors: %v", result.Errors)
+	}
+
+	if _, err := NewFS(fsys, "schemas/missing.cue"); err == nil {
+		t.Error("Expected error for a schema missing from the FS, but got none")
+	}
+}
+
+func TestValidatorRequiresDocumentPlan(t *testing.T) {
+	schemaPath := t.TempDir() + "/schema.cue"
+	if err := os.WriteFile(schemaPath, []byte("package docgen\n\n#Plan: {body: [...]}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	if _, err := New(schemaPath); err == nil {
+		t.Fatal("Expected a schema without #DocumentPlan to be rejected")
+	}
+}
+
 func TestValidatorWithValidPlans(t *testing.T) {
 	schemaPath := "../../assets/schemas/rules.cue"
 	validator, err := New(schemaPath)
@@ -267,6 +305,630 @@ func TestValidatorSpecificValidationRules(t *testing.T) {
 			valid:   false,
 			errText: "document_title",
 		},
+		{
+			name: "ValidImageBlockWithInlineImage",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Title",
+						},
+					},
+					map[string]interface{}{
+						"component": "ImageBlock",
+						"props": map[string]interface{}{
+							"image": map[string]interface{}{
+								"filename":       "logo.png",
+								"content_base64": "iVBORw0KGgo=",
+								"auto_size":      true,
+							},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidImageBlockFileType",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Title",
+						},
+					},
+					map[string]interface{}{
+						"component": "ImageBlock",
+						"props": map[string]interface{}{
+							"image": map[string]interface{}{
+								"path": "diagram.svg", // Unsupported image type
+							},
+						},
+					},
+				},
+			},
+			valid:   false,
+			errText: "image",
+		},
+		{
+			name: "ValidDocProps",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"filename": "report.docx",
+					"title":    "Test Report",
+					"creator":  "Jane Engineer",
+					"revision": 3,
+					"created":  "2025-01-02T03:04:05Z",
+					"modified": "2025-01-03",
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidDocPropsTimestamp",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"created": "January 2nd", // Not RFC 3339 or YYYY-MM-DD
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+				},
+			},
+			valid:   false,
+			errText: "created",
+		},
+		{
+			name: "ValidRichTextProp",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "TestBlock",
+						"props": map[string]interface{}{
+							"tester_name":   "John Doe",
+							"test_date":     "12/25/2024",
+							"serial_number": "SN123456",
+							"test_result":   "PASS",
+							"additional_info": []interface{}{
+								"Tested per ",
+								map[string]interface{}{"text": "MIL-STD-810H", "bold": true},
+								map[string]interface{}{"break": true},
+								map[string]interface{}{"text": "Details", "link": "https://example.com/810h"},
+							},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidRichTextSpan",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "TestBlock",
+						"props": map[string]interface{}{
+							"tester_name":   "John Doe",
+							"test_date":     "12/25/2024",
+							"serial_number": "SN123456",
+							"test_result":   "PASS",
+							"additional_info": []interface{}{
+								map[string]interface{}{"text": "H2O", "vert_align": "lowered"}, // Not superscript or subscript
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidMeasurementTable",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "MeasurementTable",
+						"props": map[string]interface{}{
+							"rows": []interface{}{
+								map[string]interface{}{"parameter": "Supply voltage", "expected": "3.3 V", "actual": "3.31 V", "result": "PASS"},
+								map[string]interface{}{
+									"parameter":   []interface{}{"V", map[string]interface{}{"text": "ripple", "vert_align": "subscript"}},
+									"expected":    "< 50 mV",
+									"actual":      "62 mV",
+									"result":      "FAIL",
+									"cell_styles": map[string]interface{}{"actual": map[string]interface{}{"fill": "FFC7CE"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidMeasurementTableRow",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "MeasurementTable",
+						"props": map[string]interface{}{
+							"rows": []interface{}{
+								map[string]interface{}{"parameter": "Supply voltage", "expected": "3.3 V", "result": "OK"}, // Missing actual, unknown result
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "InvalidMeasurementTableEmpty",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "MeasurementTable",
+						"props": map[string]interface{}{
+							"rows": []interface{}{},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidNestedList",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "NumberedList",
+						"props": map[string]interface{}{
+							"items": []interface{}{
+								"Connect the supply",
+								map[string]interface{}{
+									"text":  "Measure ripple",
+									"items": []interface{}{"At no load", []interface{}{"At ", map[string]interface{}{"text": "full", "bold": true}, " load"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidListItem",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{"filename": "test.docx"},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "BulletList",
+						"props": map[string]interface{}{
+							"items": []interface{}{
+								map[string]interface{}{"label": "First"}, // Items need text
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidHeaderAndFooter",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"header": "{{ title }}",
+					"footer": map[string]interface{}{
+						"text":  "{{ DocumentSubject.document_subject }}, Page {{ page }} of {{ pages }}",
+						"align": "center",
+					},
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidFooterAlignment",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"footer": map[string]interface{}{"text": "Page {{ page }}", "align": "justify"}, // Not left, center or right
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidSections",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Section",
+						"props": map[string]interface{}{
+							"page_size":         "a4",
+							"orientation":       "landscape",
+							"margins":           map[string]interface{}{"left": 720, "right": 720, "top": 1080, "bottom": 1080},
+							"columns":           2,
+							"page_number_start": 1,
+						},
+					},
+					map[string]interface{}{
+						"component": "PageBreak",
+						"props":     map[string]interface{}{},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidSectionOrientation",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Section",
+						"props": map[string]interface{}{
+							"orientation": "sideways", // Not portrait or landscape
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "InvalidSectionColumns",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Section",
+						"props": map[string]interface{}{
+							"columns": 0, // At least one column
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "InvalidSectionMarginsWiderThanPage",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Section",
+						"props": map[string]interface{}{
+							"page_size": "a5",
+							"margins":   map[string]interface{}{"left": 4320, "right": 4320}, // 8640 of an 8391 wide page
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "InvalidSectionNegativeMargin",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Section",
+						"props": map[string]interface{}{
+							"margins": map[string]interface{}{"top": -720},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidTableOfContents",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "TOC",
+						"props": map[string]interface{}{
+							"title": "Contents",
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text":  "Scope",
+							"level": 1,
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text":  []interface{}{"Bench ", map[string]interface{}{"text": "Supply", "bold": true}},
+							"level": 2,
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidHeadingLevel",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text":  "Scope",
+							"level": 4, // The table of contents lists levels 1-3
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "InvalidEmptyHeading",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text":  "",
+							"level": 1,
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidFootnotes",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text": []interface{}{
+								map[string]interface{}{"text": "Vibration", "footnote": "Per MIL-STD-810H Method 514.8."},
+							},
+							"level": 1,
+						},
+					},
+					map[string]interface{}{
+						"component": "BulletList",
+						"props": map[string]interface{}{
+							"items": []interface{}{
+								[]interface{}{"IEC 60068-2-6", map[string]interface{}{"endnote": []interface{}{map[string]interface{}{"text": "Edition 7.0", "italic": true}}}},
+							},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidFootnoteWithLink",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props": map[string]interface{}{
+							"document_title": "Test Report",
+						},
+					},
+					map[string]interface{}{
+						"component": "Heading",
+						"props": map[string]interface{}{
+							"text": []interface{}{
+								map[string]interface{}{
+									"text":     "Vibration",
+									"footnote": []interface{}{map[string]interface{}{"text": "Standard", "link": "https://example.com"}}, // Notes cannot hold links
+								},
+							},
+							"level": 1,
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidLockedControls",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component":     "DocumentTitle",
+						"props":         map[string]interface{}{"document_title": "Test Report"},
+						"lock_controls": true,
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidLockControlsType",
+			plan: map[string]interface{}{
+				"body": []interface{}{
+					map[string]interface{}{
+						"component":     "DocumentTitle",
+						"props":         map[string]interface{}{"document_title": "Test Report"},
+						"lock_controls": "yes",
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidBoundProps",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"bound_props": []interface{}{"document_title", "tester_name"},
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props":     map[string]interface{}{"document_title": "Test Report"},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidBoundPropName",
+			plan: map[string]interface{}{
+				"doc_props": map[string]interface{}{
+					"bound_props": []interface{}{"document title"},
+				},
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props":     map[string]interface{}{"document_title": "Test Report"},
+					},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "ValidTemplate",
+			plan: map[string]interface{}{
+				"template": "test-report",
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props":     map[string]interface{}{"document_title": "Test Report"},
+					},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "InvalidTemplateName",
+			plan: map[string]interface{}{
+				"template": "test report",
+				"body": []interface{}{
+					map[string]interface{}{
+						"component": "DocumentTitle",
+						"props":     map[string]interface{}{"document_title": "Test Report"},
+					},
+				},
+			},
+			valid: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -293,6 +955,51 @@ func TestValidatorSpecificValidationRules(t *testing.T) {
 	}
 }
 
+func TestValidatorJSONNumbers(t *testing.T) {
+	validator, err := New("../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to initialize validator: %v", err)
+	}
+
+	// JSON decoding makes every number a float64; whole numbers must still
+	// satisfy int constraints
+	var plan map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"doc_props": {"filename": "numbers.docx", "revision": 2},
+		"body": [
+			{"component": "DocumentTitle", "props": {"document_title": "Numbers"}}
+		]
+	}`), &plan); err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+	if result := validator.Validate(plan); !result.Valid {
+		t.Errorf("Expected plan with JSON numbers to be valid, got errors: %v", result.Errors)
+	}
+
+	plan["doc_props"].(map[string]interface{})["revision"] = 1.5
+	if result := validator.Validate(plan); result.Valid {
+		t.Error("Expected a fractional revision to be rejected")
+	}
+}
+
+func TestValidatorAcceptsComponent(t *testing.T) {
+	validator, err := New("../../assets/schemas/rules.cue")
+	if err != nil {
+		t.Fatalf("Failed to initialize validator: %v", err)
+	}
+
+	for name, expected := range map[string]bool{
+		"TestBlock":   true,
+		"Heading":     true,
+		"TestBlock@2": false,
+		"Unknown":     false,
+	} {
+		if accepted := validator.AcceptsComponent(name); accepted != expected {
+			t.Errorf("AcceptsComponent(%q) = %t, expected %t", name, accepted, expected)
+		}
+	}
+}
+
 func TestValidatorNonExistentSchema(t *testing.T) {
 	_, err := New("/nonexistent/path/schema.cue")
 	if err == nil {
@@ -343,9 +1050,9 @@ func TestValidatorInvalidJSON(t *testing.T) {
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr ||
 		(len(s) > len(substr) &&
-		 (s[:len(substr)] == substr ||
-		  s[len(s)-len(substr):] == substr ||
-		  findSubstring(s, substr))))
+			(s[:len(substr)] == substr ||
+				s[len(s)-len(substr):] == substr ||
+				findSubstring(s, substr))))
 }
 
 func findSubstring(s, substr string) bool {
@@ -355,4 +1062,4 @@ func findSubstring(s, substr string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
@@ -227,7 +227,6 @@ DEPLOY_CMD=(
     "--cpu=$CPU"
     "--min-instances=$MIN_INSTANCES"
     "--max-instances=$MAX_INSTANCES"
-    "--set-env-vars=DOCGEN_SHELL_PATH=./assets/shell/template_shell.docx,DOCGEN_COMPONENTS_DIR=./assets/components/,DOCGEN_SCHEMA_PATH=./assets/schemas/rules.cue"
 )
 
 # Add authentication setting